@@ -11,6 +11,10 @@ import (
 	mapset "github.com/PROGNOSISTool/golang-set"
 )
 
+// A pseudo packet type for the output symbols reporting that the SUL exceeded our flow control or stream limits. Their
+// frame types are the ones of the offending frames, e.g. FCVIOLATION(?,?)[STREAM].
+const FlowControlViolationPacket qt.PacketType = 0xfc
+
 var packetTypeToString = map[qt.PacketType]string {
 	qt.VersionNegotiation: "VERNEG",
 	qt.Initial: "INITIAL",
@@ -19,6 +23,7 @@ var packetTypeToString = map[qt.PacketType]string {
 	qt.ZeroRTTProtected: "ZERO",
 	qt.ShortHeaderPacket: "SHORT",
 	qt.StatelessReset : "RESET",
+	FlowControlViolationPacket: "FCVIOLATION",
 }
 
 var stringToPacketType = map[string]qt.PacketType {
@@ -29,11 +34,13 @@ var stringToPacketType = map[string]qt.PacketType {
 	"ZERO": qt.ZeroRTTProtected,
 	"SHORT": qt.ShortHeaderPacket,
 	"RESET": qt.StatelessReset,
+	"FCVIOLATION": FlowControlViolationPacket,
 }
 
 type HeaderOptions struct {
 	PacketNumber *qt.PacketNumber
 	QUICVersion *uint32
+	PacketNumberLength *int // The number of bytes used to encode the packet number, when set
 }
 
 func (ho *HeaderOptions) String() string {
@@ -45,6 +52,9 @@ func (ho *HeaderOptions) String() string {
 	if ho.PacketNumber != nil {
 		packetNumber = fmt.Sprintf("%#d", *ho.PacketNumber)
 	}
+	if ho.PacketNumberLength != nil {
+		return packetNumber + "," + version + "," + strconv.Itoa(*ho.PacketNumberLength)
+	}
 	return packetNumber + "," + version
 }
 // INITIAL(25,0xff00001d)[ACK,CRYPTO]
@@ -52,10 +62,14 @@ func (ho *HeaderOptions) String() string {
 // PacketType: Initial
 // HeaderOptions: HeaderOptions{ PacketNumber: 25, QUICVersion: 0xff00001d }
 // frames: [ qt.AckFrame, qt.CryptoFrame ]
+//
+// Symbols joined with a +, e.g. INITIAL(?,?)[ACK]+HANDSHAKE(?,?)[CRYPTO], are sent coalesced in a single datagram.
+// The symbols that follow the first one are chained using Coalesced.
 type AbstractSymbol struct {
 	PacketType    qt.PacketType
 	HeaderOptions HeaderOptions
 	FrameTypes    mapset.Set // type: qt.FrameType
+	Coalesced     *AbstractSymbol
 }
 
 func (as *AbstractSymbol) String() string {
@@ -67,6 +81,9 @@ func (as *AbstractSymbol) String() string {
 	}
 	sort.Strings(frameStrings)
 	frameTypes := strings.Join(frameStrings, ",")
+	if as.Coalesced != nil {
+		return fmt.Sprintf("%v(%v)[%v]+%v", packetType, headerOptions, frameTypes, as.Coalesced.String())
+	}
 	return fmt.Sprintf("%v(%v)[%v]", packetType, headerOptions, frameTypes)
 }
 
@@ -79,6 +96,13 @@ func NewAbstractSymbol(packetType qt.PacketType, headerOptions HeaderOptions, fr
 }
 
 func NewAbstractSymbolFromString(message string) AbstractSymbol {
+	if symbols := strings.SplitN(message, "+", 2); len(symbols) == 2 {
+		as := NewAbstractSymbolFromString(symbols[0])
+		coalesced := NewAbstractSymbolFromString(symbols[1])
+		as.Coalesced = &coalesced
+		return as
+	}
+
 	messageStringRegex := regexp.MustCompile(`^([A-Z]+)(\(([0-9A-Za-zx,?]+)\))?\[([A-Z,_]+)\]$`)
 	subgroups := messageStringRegex.FindStringSubmatch(message)
 	// The GetPacketType is the second group, we can get the type with a map.
@@ -107,6 +131,14 @@ func NewAbstractSymbolFromString(message string) AbstractSymbol {
 				headerOptions.QUICVersion = &version32
 			}
 		}
+
+		// The optional third option is the Packet Number Length.
+		if len(headerOptionSlice) > 2 && headerOptionSlice[2] != "?" {
+			parsedLength, err := strconv.Atoi(headerOptionSlice[2])
+			if err == nil && parsedLength >= 1 && parsedLength <= 4 {
+				headerOptions.PacketNumberLength = &parsedLength
+			}
+		}
 	}
 
 	// The fifth group will be a CSV of frame types.
@@ -27,9 +27,17 @@ type Adapter struct {
 	stop                   chan bool
 	Logger                 *log.Logger
 
+	resumptionPolicy       string
+	grease                 qt.GreaseOptions
+	datagrams              bool   // Whether DATAGRAM is in the alphabet, i.e. max_datagram_frame_size is advertised
+	ackFrequency           AckFrequencyOptions // The values of the ACK_FREQUENCY frames sent for the ACK_FREQUENCY symbol
+	handshakeCompleted     bool   // Whether a HANDSHAKE_DONE frame was received in the current connection
+	newToken               []byte // The last token received in a NEW_TOKEN frame in the current connection
+
 	incomingLearnerSymbols qt.Broadcaster // Type: AbstractSymbol
 	incomingSulPackets     chan interface{}
 	outgoingSulPackets     chan interface{}
+	flowControlViolations  chan interface{}
 	outgoingPacket         *ConcreteSymbol
 	incomingPacketSet      ConcreteSet
 	incomingRequest        AbstractSymbol
@@ -37,7 +45,10 @@ type Adapter struct {
 	oracleTable            AbstractConcreteMap
 }
 
-func NewAdapter(adapterAddress string, sulAddress string, sulName string, http3 bool, httpPath string, tracing bool, waitTime time.Duration) (*Adapter, error) {
+func NewAdapter(adapterAddress string, sulAddress string, sulName string, http3 bool, httpPath string, tracing bool, waitTime time.Duration, resumptionPolicy string, grease qt.GreaseOptions, datagrams bool, ackFrequency AckFrequencyOptions) (*Adapter, error) {
+	if err := checkResumptionPolicy(resumptionPolicy); err != nil {
+		return nil, err
+	}
 	adapter := new(Adapter)
 
 	adapter.Logger = log.New(os.Stderr, "[ADAPTER] ", log.Lshortfile)
@@ -48,15 +59,24 @@ func NewAdapter(adapterAddress string, sulAddress string, sulName string, http3
 	adapter.Logger.Printf("HTTP Path: %v", httpPath)
 	adapter.Logger.Printf("TRACING: %v", tracing)
 	adapter.Logger.Printf("Wait Time: %v", waitTime)
+	adapter.Logger.Printf("Resumption Policy: %v", resumptionPolicy)
+	adapter.Logger.Printf("Grease: %+v", grease)
+	adapter.Logger.Printf("Datagrams: %v", datagrams)
+	adapter.Logger.Printf("ACK Frequency: %+v", ackFrequency)
 
 	adapter.incomingLearnerSymbols = qt.NewBroadcaster(1000)
 	adapter.httpPath = httpPath
 	adapter.http3 = http3
 	adapter.waitTime = waitTime
+	adapter.resumptionPolicy = resumptionPolicy
+	adapter.grease = grease
+	adapter.datagrams = datagrams
+	adapter.ackFrequency = ackFrequency
 	adapter.stop = make(chan bool, 1)
 	adapter.server = tcp.New(adapterAddress)
 
 	adapter.connection, _ = qt.NewDefaultConnection(sulAddress, sulName, nil, false, "hq", adapter.http3)
+	adapter.connection.SetGrease(adapter.grease)
 	if tracing {
 	    var err error
         adapter.pcap, err = qt.StartPcapCapture(adapter.connection, "")
@@ -74,6 +94,7 @@ func NewAdapter(adapterAddress string, sulAddress string, sulName string, http3
 
 	adapter.incomingSulPackets = adapter.connection.IncomingPackets.RegisterNewChan(1000)
 	adapter.outgoingSulPackets = adapter.connection.OutgoingPackets.RegisterNewChan(1000)
+	adapter.flowControlViolations = adapter.connection.FlowControlViolations.RegisterNewChan(1000)
 
 	adapter.outgoingPacket = nil
 	adapter.incomingPacketSet = *NewConcreteSet()
@@ -99,6 +120,9 @@ func NewAdapter(adapterAddress string, sulAddress string, sulName string, http3
 	} else {
 		adapter.agents.Add(&agents.HTTP09Agent{})
 	}
+	if adapter.datagrams {
+		adapter.agents.Add(&agents.DatagramAgent{})
+	}
 	adapter.agents.Get("SendingAgent").(*agents.SendingAgent).KeepDroppedEncryptionLevels = true
 	adapter.agents.Get("FlowControlAgent").(*agents.FlowControlAgent).DisableFrameSending = true
 	adapter.agents.Get("FlowControlAgent").(*agents.FlowControlAgent).DontSlideCreditWindow = true
@@ -124,56 +148,18 @@ func (a *Adapter) Run() {
 		select {
 		case i := <-incomingSymbolChannel:
 			as := i.(AbstractSymbol)
-			pnSpace := qt.PacketTypeToPNSpace[as.PacketType]
-			encLevel := qt.PacketTypeToEncryptionLevel[as.PacketType]
-
-			if as.HeaderOptions.QUICVersion != nil {
-				a.connection.Version = *as.HeaderOptions.QUICVersion
-			}
-
-			if as.HeaderOptions.PacketNumber != nil {
-				a.connection.PacketNumberLock.Lock()
-				a.connection.PacketNumber[pnSpace] = *as.HeaderOptions.PacketNumber
-				a.connection.PacketNumberLock.Unlock()
-			}
-
-			frameTypesSlice := []qt.FrameType{}
-			for _, frameType := range as.FrameTypes.ToSlice() {
-				frameTypesSlice = append(frameTypesSlice, frameType.(qt.FrameType))
-			}
-			for _, frameType := range frameTypesSlice {
-				switch frameType {
-				case qt.AckType:
-					a.agents.Get("AckAgent").(*agents.AckAgent).SendFromQueue <- pnSpace
-				case qt.PingType:
-					a.connection.FrameQueue.Submit(qt.QueuedFrame{Frame: new(qt.PingFrame), EncryptionLevel: encLevel})
-				case qt.CryptoType:
-					a.agents.Get("TLSAgent").(*agents.TLSAgent).SendFromQueue <- encLevel
-				case qt.PaddingFrameType:
-					a.connection.FrameQueue.Submit(qt.QueuedFrame{Frame: new(qt.PaddingFrame), EncryptionLevel: encLevel})
-				case qt.StreamType:
-					if len(a.connection.StreamQueue[qt.FrameRequest{FrameType: qt.StreamType, EncryptionLevel: qt.EncryptionLevel1RTT}]) == 0 {
-						if a.http3 {
-							a.agents.Get("HTTP3Agent").(*agents.HTTP3Agent).SendRequest(a.httpPath, "GET", "quic.tiferrei.com", nil)
-						} else {
-							a.agents.Get("HTTP09Agent").(*agents.HTTP09Agent).SendRequest(a.httpPath, "GET", "quic.tiferrei.com", nil)
-						}
-					}
-					time.Sleep(1 * time.Millisecond)
-					a.agents.Get("StreamAgent").(*agents.StreamAgent).SendFromQueue <- qt.FrameRequest{qt.StreamType, encLevel}
-				case qt.MaxDataType:
-				case qt.MaxStreamDataType:
-					a.agents.Get("FlowControlAgent").(*agents.FlowControlAgent).SendFromQueue <- qt.FrameRequest{frameType, encLevel}
-				case qt.HandshakeDoneType:
-					a.connection.FrameQueue.Submit(qt.QueuedFrame{Frame: new(qt.HandshakeDoneFrame), EncryptionLevel: encLevel})
-				default:
-					panic(fmt.Sprintf("Error: Frame Type '%v' not implemented!", frameType))
-				}
+			encLevels := []qt.EncryptionLevel{}
+			for s := &as; s != nil; s = s.Coalesced {
+				encLevels = append(encLevels, a.queueFrames(s))
 			}
 			// FIXME: This ensures the request gets queued before packets are sent. I'm not proud of it but it works.
 			time.Sleep(3 * time.Millisecond)
 			a.Logger.Printf("Submitting request: %v", as.String())
-			a.connection.PreparePacket.Submit(encLevel)
+			if len(encLevels) > 1 {
+				a.connection.PrepareCoalescedPackets.Submit(encLevels)
+			} else {
+				a.connection.PreparePacket.Submit(encLevels[0])
+			}
 		case o := <-a.incomingSulPackets:
 			var packetType qt.PacketType
 			version := &a.connection.Version
@@ -193,6 +179,12 @@ func (a *Adapter) Run() {
 				packetType = packet.GetHeader().GetPacketType()
 				// TODO: GetFrames() might not return a deterministic order. Idk yet.
 				for _, frame := range packet.GetFrames() {
+					switch f := frame.(type) {
+					case *qt.HandshakeDoneFrame:
+						a.handshakeCompleted = true
+					case *qt.NewTokenFrame:
+						a.newToken = f.Token
+					}
 					if frame.FrameType() != qt.PaddingFrameType {
 						// We don't want to pass PADDINGs to the learner.
 						frameTypes.Add(frame.FrameType())
@@ -210,28 +202,41 @@ func (a *Adapter) Run() {
 			concreteSymbol := NewConcreteSymbol(o.(qt.Packet))
 			a.incomingPacketSet.Add(concreteSymbol)
 			var packetNumber *qt.PacketNumber = nil
+			var packetNumberLength *int = nil
 			if concreteSymbol.Packet.GetHeader() != nil {
 			    pn := concreteSymbol.Packet.GetHeader().GetPacketNumber()
                 packetNumber = &pn
+                if pnLength := concreteSymbol.Packet.GetHeader().GetTruncatedPN().Length; pnLength > 0 {
+                    packetNumberLength = &pnLength
+                }
             }
 
 			if a.incomingRequest.HeaderOptions.PacketNumber == nil {
 				packetNumber = nil
 			}
 
+			if a.incomingRequest.HeaderOptions.PacketNumberLength == nil {
+				packetNumberLength = nil
+			}
+
 			if a.incomingRequest.HeaderOptions.QUICVersion == nil {
 				version = nil
 			}
 
 			abstractSymbol := NewAbstractSymbol(
 				packetType,
-				HeaderOptions{QUICVersion: version, PacketNumber: packetNumber},
+				HeaderOptions{QUICVersion: version, PacketNumber: packetNumber, PacketNumberLength: packetNumberLength},
 				frameTypes)
 			a.Logger.Printf("Got response: %v", abstractSymbol.String())
 			a.outgoingResponse.Add(abstractSymbol)
 		case o := <- a.outgoingSulPackets:
 			cs := NewConcreteSymbol(o.(qt.Packet))
 			a.outgoingPacket = &cs
+		case v := <-a.flowControlViolations:
+			violation := v.(qt.FlowControlViolation)
+			abstractSymbol := NewAbstractSymbol(FlowControlViolationPacket, HeaderOptions{}, mapset.NewSet(violation.FrameType))
+			a.Logger.Printf("Got flow control violation: %v (%s)", abstractSymbol.String(), violation.Reason)
+			a.outgoingResponse.Add(abstractSymbol)
 		case <-a.stop:
 			return
 		default:
@@ -240,6 +245,81 @@ func (a *Adapter) Run() {
 	}
 }
 
+// Queues the frames of the given abstract symbol and returns the encryption level of its packet.
+func (a *Adapter) queueFrames(as *AbstractSymbol) qt.EncryptionLevel {
+	pnSpace := qt.PacketTypeToPNSpace[as.PacketType]
+	encLevel := qt.PacketTypeToEncryptionLevel[as.PacketType]
+
+	if as.HeaderOptions.QUICVersion != nil {
+		a.connection.Version = *as.HeaderOptions.QUICVersion
+	}
+
+	a.connection.PacketNumberLock.Lock()
+	if as.HeaderOptions.PacketNumber != nil {
+		a.connection.PacketNumber[pnSpace] = *as.HeaderOptions.PacketNumber
+	}
+	if as.HeaderOptions.PacketNumberLength != nil {
+		a.connection.PacketNumberLength[pnSpace] = *as.HeaderOptions.PacketNumberLength
+	} else {
+		delete(a.connection.PacketNumberLength, pnSpace)
+	}
+	a.connection.PacketNumberLock.Unlock()
+
+	frameTypesSlice := []qt.FrameType{}
+	for _, frameType := range as.FrameTypes.ToSlice() {
+		frameTypesSlice = append(frameTypesSlice, frameType.(qt.FrameType))
+	}
+	for _, frameType := range frameTypesSlice {
+		switch frameType {
+		case qt.AckType:
+			a.agents.Get("AckAgent").(*agents.AckAgent).SendFromQueue <- pnSpace
+		case qt.PingType:
+			a.connection.FrameQueue.Submit(qt.QueuedFrame{Frame: new(qt.PingFrame), EncryptionLevel: encLevel})
+		case qt.CryptoType:
+			a.agents.Get("TLSAgent").(*agents.TLSAgent).SendFromQueue <- encLevel
+		case qt.PaddingFrameType:
+			a.connection.FrameQueue.Submit(qt.QueuedFrame{Frame: new(qt.PaddingFrame), EncryptionLevel: encLevel})
+		case qt.StreamType:
+			if len(a.connection.StreamQueue[qt.FrameRequest{FrameType: qt.StreamType, EncryptionLevel: qt.EncryptionLevel1RTT}]) == 0 {
+				if a.http3 {
+					a.agents.Get("HTTP3Agent").(*agents.HTTP3Agent).SendRequest(a.httpPath, "GET", "quic.tiferrei.com", nil)
+				} else {
+					a.agents.Get("HTTP09Agent").(*agents.HTTP09Agent).SendRequest(a.httpPath, "GET", "quic.tiferrei.com", nil)
+				}
+			}
+			time.Sleep(1 * time.Millisecond)
+			a.agents.Get("StreamAgent").(*agents.StreamAgent).SendFromQueue <- qt.FrameRequest{qt.StreamType, encLevel}
+		case qt.MaxDataType:
+		case qt.MaxStreamDataType:
+			a.agents.Get("FlowControlAgent").(*agents.FlowControlAgent).SendFromQueue <- qt.FrameRequest{frameType, encLevel}
+		case qt.HandshakeDoneType:
+			a.connection.FrameQueue.Submit(qt.QueuedFrame{Frame: new(qt.HandshakeDoneFrame), EncryptionLevel: encLevel})
+		case qt.DatagramType:
+			if !a.datagrams {
+				a.Logger.Printf("DATAGRAM is not in the alphabet, enable datagrams in the configuration\n")
+			} else if err := a.agents.Get("DatagramAgent").(*agents.DatagramAgent).QueueDatagram([]byte("DATAGRAM"), encLevel); err != nil {
+				a.Logger.Printf("Unable to queue DATAGRAM frame: %v", err)
+			}
+		case qt.AckFrequencyType:
+			err := a.agents.Get("AckAgent").(*agents.AckAgent).RequestAckFrequency(a.ackFrequency.AckElicitingThreshold, a.ackFrequency.MaxAckDelay, a.ackFrequency.ReorderingThreshold, encLevel)
+			if err != nil {
+				a.Logger.Printf("Unable to queue ACK_FREQUENCY frame: %v", err)
+			}
+		case qt.ImmediateAckType:
+			err := a.agents.Get("AckAgent").(*agents.AckAgent).RequestImmediateAck(encLevel)
+			if err != nil {
+				a.Logger.Printf("Unable to queue IMMEDIATE_ACK frame: %v", err)
+			}
+		case qt.GreaseType:
+			a.connection.FrameQueue.Submit(qt.QueuedFrame{Frame: qt.NewGreaseFrame(), EncryptionLevel: encLevel})
+		default:
+			panic(fmt.Sprintf("Error: Frame Type '%v' not implemented!", frameType))
+		}
+	}
+
+	return encLevel
+}
+
 func (a *Adapter) Stop() {
 	a.SaveOracleTable(fmt.Sprintf("oracleTable-%d.json", time.Now().Unix()))
 	a.SaveTrace(fmt.Sprintf("trace-%d.json", time.Now().Unix()))
@@ -252,13 +332,24 @@ func (a *Adapter) Reset(client *tcp.Client) {
 	a.Logger.Print("Received RESET command")
 	a.agents.Stop("SendingAgent")
 	a.agents.StopAll()
+	session := a.resumptionState()
 	a.connection.Close()
-	a.connection, _ = qt.NewDefaultConnection(a.connection.ConnectedIp().String(), a.connection.ServerName, nil, false, "hq", a.http3)
+	if session != nil {
+		a.connection, _ = qt.NewDefaultConnection(a.connection.ConnectedIp().String(), a.connection.ServerName, session.ResumptionTicket, false, "hq", a.http3)
+		a.connection.Token = session.Token
+		a.connection.RememberedParameters = session.TransportParameters
+	} else {
+		a.connection, _ = qt.NewDefaultConnection(a.connection.ConnectedIp().String(), a.connection.ServerName, nil, false, "hq", a.http3)
+	}
+	a.connection.SetGrease(a.grease)
+	a.handshakeCompleted = false
+	a.newToken = nil
 	if a.trace != nil {
 		a.trace.AttachTo(a.connection)
 	}
 	a.incomingSulPackets = a.connection.IncomingPackets.RegisterNewChan(1000)
 	a.outgoingSulPackets = a.connection.OutgoingPackets.RegisterNewChan(1000)
+	a.flowControlViolations = a.connection.FlowControlViolations.RegisterNewChan(1000)
 	a.outgoingPacket = nil
 	a.incomingPacketSet = *NewConcreteSet()
 	a.outgoingResponse = *NewAbstractSet()
@@ -282,6 +373,9 @@ func (a *Adapter) Reset(client *tcp.Client) {
 	} else {
 		a.agents.Add(&agents.HTTP09Agent{})
 	}
+	if a.datagrams {
+		a.agents.Add(&agents.DatagramAgent{})
+	}
 	a.agents.Get("SendingAgent").(*agents.SendingAgent).KeepDroppedEncryptionLevels = true
 	a.agents.Get("FlowControlAgent").(*agents.FlowControlAgent).DontSlideCreditWindow = true
 	a.agents.Get("FlowControlAgent").(*agents.FlowControlAgent).DisableFrameSending = true
@@ -335,12 +429,17 @@ func (a *Adapter) handleNewAbstractQuery(client *tcp.Client, query []string) {
 		a.incomingRequest = NewAbstractSymbolFromString(message)
 		abstractInputs = append(abstractInputs, a.incomingRequest)
 
-		// If we don't have the requested encryption level, skip and return EMPTY.
-		if a.connection.CryptoState(qt.PacketTypeToEncryptionLevel[a.incomingRequest.PacketType]) != nil {
+		// If we don't have the requested encryption levels, skip and return EMPTY.
+		available := true
+		for s := &a.incomingRequest; s != nil; s = s.Coalesced {
+			if a.connection.CryptoState(qt.PacketTypeToEncryptionLevel[s.PacketType]) == nil {
+				a.Logger.Printf("Unable to send packet at " + qt.PacketTypeToEncryptionLevel[s.PacketType].String() + " EL.")
+				available = false
+			}
+		}
+		if available {
 			a.incomingLearnerSymbols.Submit(a.incomingRequest)
 			time.Sleep(a.waitTime)
-		} else {
-			a.Logger.Printf("Unable to send packet at " + qt.PacketTypeToEncryptionLevel[a.incomingRequest.PacketType].String() + " EL.")
 		}
 
 		abstractOutputs = append(abstractOutputs, a.outgoingResponse)
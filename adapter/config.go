@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"time"
 
+	qt "github.com/PROGNOSISTool/adapter-quic"
 	"gopkg.in/yaml.v3"
 )
 
@@ -13,9 +14,21 @@ type Config struct {
     SulAddress string `yaml:"sulAddress"`
     SulName string `yaml:"sulName"`
     HTTP3 bool `yaml:"HTTP3"`
+    HTTP3Alphabet bool `yaml:"http3Alphabet"`
     HttpPath string `yaml:"httpPath"`
     Tracing  bool          `yaml:"tracing"`
     WaitTime time.Duration `yaml:"WaitTime"`
+    ResumptionPolicy string `yaml:"resumptionPolicy"`
+    Grease qt.GreaseOptions
+    Datagrams bool `yaml:"datagrams"` // Adds DATAGRAM to the alphabet and advertises max_datagram_frame_size
+    AckFrequency AckFrequencyOptions
+}
+
+// The values of the ACK_FREQUENCY frames sent when the learner sends the ACK_FREQUENCY symbol.
+type AckFrequencyOptions struct {
+    AckElicitingThreshold uint64
+    MaxAckDelay           time.Duration
+    ReorderingThreshold   uint64
 }
 
 func newConfig() Config {
@@ -28,6 +41,8 @@ func newConfig() Config {
         HttpPath:       "/index.html",
         Tracing:        false,
         WaitTime:       waitTime,
+        ResumptionPolicy: ResumptionNever,
+        AckFrequency:     AckFrequencyOptions{10, 100 * time.Millisecond, 0},
     }
 
     return c
@@ -43,9 +58,18 @@ func GetConfig(path string) *Config {
             SulAddress string     `yaml:"sulAddress"`
             SulName string        `yaml:"sulName"`
             HTTP3 bool            `yaml:"http3"`
+            HTTP3Alphabet bool    `yaml:"http3Alphabet"`
             HttpPath string       `yaml:"httpPath"`
             Tracing  bool         `yaml:"tracing"`
             WaitTime string       `yaml:"waitTime"`
+            ResumptionPolicy string `yaml:"resumptionPolicy"`
+            GreaseTransportParameters bool `yaml:"greaseTransportParameters"`
+            GreaseVersion bool    `yaml:"greaseVersion"`
+            GreaseQuicBit bool    `yaml:"greaseQuicBit"`
+            Datagrams bool        `yaml:"datagrams"`
+            AckElicitingThreshold *uint64 `yaml:"ackElicitingThreshold"`
+            MaxAckDelay string    `yaml:"maxAckDelay"`
+            ReorderingThreshold *uint64 `yaml:"reorderingThreshold"`
         }
 
         type aliasConfig struct {
@@ -61,8 +85,27 @@ func GetConfig(path string) *Config {
             config.SulAddress = alias.Adapter.SulAddress
             config.SulName = alias.Adapter.SulName
             config.HTTP3 = alias.Adapter.HTTP3
+            config.HTTP3Alphabet = alias.Adapter.HTTP3Alphabet
             config.HttpPath = alias.Adapter.HttpPath
             config.Tracing = alias.Adapter.Tracing
+            if alias.Adapter.ResumptionPolicy != "" {
+                config.ResumptionPolicy = alias.Adapter.ResumptionPolicy
+            }
+            config.Grease = qt.GreaseOptions{
+                TransportParameters: alias.Adapter.GreaseTransportParameters,
+                Version:             alias.Adapter.GreaseVersion,
+                QuicBit:             alias.Adapter.GreaseQuicBit,
+            }
+            config.Datagrams = alias.Adapter.Datagrams
+            if alias.Adapter.AckElicitingThreshold != nil {
+                config.AckFrequency.AckElicitingThreshold = *alias.Adapter.AckElicitingThreshold
+            }
+            if maxAckDelay, err := time.ParseDuration(alias.Adapter.MaxAckDelay); err == nil {
+                config.AckFrequency.MaxAckDelay = maxAckDelay
+            }
+            if alias.Adapter.ReorderingThreshold != nil {
+                config.AckFrequency.ReorderingThreshold = *alias.Adapter.ReorderingThreshold
+            }
 
             waitTime, err := time.ParseDuration(alias.Adapter.WaitTime)
             if err == nil {
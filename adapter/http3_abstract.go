@@ -0,0 +1,143 @@
+package adapter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PROGNOSISTool/adapter-quic/http3"
+	"github.com/PROGNOSISTool/adapter-quic/qpack"
+	mapset "github.com/PROGNOSISTool/golang-set"
+)
+
+// The streams of the HTTP/3 symbols that are not request streams.
+const (
+	HTTP3ControlStream = "CONTROL"
+	HTTP3PushStream    = "PUSH"
+	HTTP3EncoderStream = "ENCODER"
+	HTTP3DecoderStream = "DECODER"
+	HTTP3Connection    = "CLOSE" // The pseudo stream of the symbols reporting that the connection was closed
+)
+
+// The elements of the HTTP/3 symbols that are not frames.
+const (
+	HTTP3Open         = "OPEN"         // The stream was opened with its type, as unidirectional streams are
+	HTTP3Instructions = "INSTRUCTIONS" // QPACK instructions were received on an encoder or decoder stream
+	HTTP3Reset        = "RESET"        // A RESET_STREAM frame was received for the stream
+	HTTP3StopSending  = "STOP_SENDING" // A STOP_SENDING frame was received for the stream
+	HTTP3Unknown      = "UNKNOWN"      // A frame of an unknown or reserved type was received
+	HTTP3Transport    = "TRANSPORT"    // The connection was closed with a QUIC error
+)
+
+var http3FrameTypeToString = map[uint64]string{
+	http3.FrameTypeDATA:                    "DATA",
+	http3.FrameTypeHEADERS:                 "HEADERS",
+	http3.FrameTypeCANCEL_PUSH:             "CANCEL_PUSH",
+	http3.FrameTypeSETTINGS:                "SETTINGS",
+	http3.FrameTypePUSH_PROMISE:            "PUSH_PROMISE",
+	http3.FrameTypeGOAWAY:                  "GOAWAY",
+	http3.FrameTypeMAX_PUSH_ID:             "MAX_PUSH_ID",
+	http3.FrameTypePRIORITY_UPDATE_REQUEST: "PRIORITY_UPDATE",
+	http3.FrameTypePRIORITY_UPDATE_PUSH:    "PRIORITY_UPDATE",
+}
+
+var http3StreamTypeToString = map[uint64]string{
+	http3.StreamTypeControl: HTTP3ControlStream,
+	http3.StreamTypePush:    HTTP3PushStream,
+	qpack.StreamTypeEncoder: HTTP3EncoderStream,
+	qpack.StreamTypeDecoder: HTTP3DecoderStream,
+}
+
+// H3(0,FIN)[DATA,HEADERS]
+// Is represented as:
+// Stream: "0"
+// Fin: true
+// Elements: [ "HEADERS", "DATA" ]
+//
+// An HTTP3Symbol describes what is sent or received on a stream of the HTTP/3 layer. The stream is either a request
+// stream, identified by its ID, or a unidirectional stream identified by its type, e.g. CONTROL. The elements are the
+// types of the frames sent or received on the stream, and the actions applying to it, such as OPEN. When inputs are
+// concretised, the elements are sent in the order of http3InputOrder.
+type HTTP3Symbol struct {
+	Stream   string
+	Fin      bool
+	Elements mapset.Set // type: string
+}
+
+func (s *HTTP3Symbol) String() string {
+	elements := []string{}
+	for _, e := range s.Elements.ToSlice() {
+		elements = append(elements, e.(string))
+	}
+	sort.Strings(elements)
+	stream := s.Stream
+	if s.Fin {
+		stream += ",FIN"
+	}
+	return fmt.Sprintf("H3(%v)[%v]", stream, strings.Join(elements, ","))
+}
+
+// Returns the ID of the request stream of the symbol, if it is one.
+func (s *HTTP3Symbol) StreamID() (uint64, bool) {
+	id, err := strconv.ParseUint(s.Stream, 10, 62)
+	return id, err == nil
+}
+
+func NewHTTP3Symbol(stream string, fin bool, elements ...string) HTTP3Symbol {
+	set := mapset.NewSet()
+	for _, e := range elements {
+		set.Add(e)
+	}
+	return HTTP3Symbol{stream, fin, set}
+}
+
+var http3SymbolRegex = regexp.MustCompile(`^H3\(([0-9A-Z_]+)(,FIN)?\)\[([A-Z_,]*)\]$`)
+
+func NewHTTP3SymbolFromString(message string) (HTTP3Symbol, error) {
+	subgroups := http3SymbolRegex.FindStringSubmatch(message)
+	if subgroups == nil {
+		return HTTP3Symbol{}, fmt.Errorf("malformed HTTP/3 symbol %q", message)
+	}
+	var elements []string
+	if subgroups[3] != "" {
+		elements = strings.Split(subgroups[3], ",")
+	}
+	return NewHTTP3Symbol(subgroups[1], subgroups[2] != "", elements...), nil
+}
+
+// An HTTP3Set gathers the HTTP/3 symbols received in response to an input, one per stream.
+type HTTP3Set struct {
+	symbols map[string]*HTTP3Symbol
+}
+
+func NewHTTP3Set() *HTTP3Set {
+	return &HTTP3Set{make(map[string]*HTTP3Symbol)}
+}
+
+// Adds the elements received on the given stream to the symbol of the stream.
+func (hs *HTTP3Set) Add(stream string, fin bool, elements ...string) {
+	symbol, ok := hs.symbols[stream]
+	if !ok {
+		s := NewHTTP3Symbol(stream, fin)
+		symbol = &s
+		hs.symbols[stream] = symbol
+	}
+	symbol.Fin = symbol.Fin || fin
+	for _, e := range elements {
+		symbol.Elements.Add(e)
+	}
+}
+
+func (hs *HTTP3Set) String() string {
+	if len(hs.symbols) == 0 {
+		return "{}"
+	}
+	stringSlice := []string{}
+	for _, symbol := range hs.symbols {
+		stringSlice = append(stringSlice, symbol.String())
+	}
+	sort.Strings(stringSlice)
+	return fmt.Sprintf("{%v}", strings.Join(stringSlice, ","))
+}
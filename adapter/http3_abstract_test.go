@@ -0,0 +1,47 @@
+package adapter
+
+import (
+	"testing"
+)
+
+func TestHTTP3Symbol_RoundTrip(t *testing.T) {
+	for _, message := range []string{"H3(CONTROL)[OPEN,SETTINGS]", "H3(0,FIN)[HEADERS]", "H3(4)[DATA,HEADERS]", "H3(QPACK_ENCODER)[]"} {
+		symbol, err := NewHTTP3SymbolFromString(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if symbol.String() != message {
+			t.Errorf("Expected %s, got %s", message, symbol.String())
+		}
+	}
+
+	symbol, _ := NewHTTP3SymbolFromString("H3(8,FIN)[HEADERS,DATA]")
+	if id, ok := symbol.StreamID(); !ok || id != 8 || !symbol.Fin || symbol.String() != "H3(8,FIN)[DATA,HEADERS]" {
+		t.Errorf("Unexpected symbol %s on stream %d", symbol.String(), id)
+	}
+	symbol, _ = NewHTTP3SymbolFromString("H3(CONTROL)[SETTINGS]")
+	if _, ok := symbol.StreamID(); ok {
+		t.Error("Expected the control stream not to be a request stream")
+	}
+}
+
+func TestNewHTTP3SymbolFromString_Malformed(t *testing.T) {
+	for _, message := range []string{"", "H3(0)", "H3()[DATA]", "H3(0,FIN)[data]", "INITIAL(0,0)[CRYPTO]", "H3(0)[DATA] "} {
+		if _, err := NewHTTP3SymbolFromString(message); err == nil {
+			t.Errorf("Expected %q to be rejected", message)
+		}
+	}
+}
+
+func TestHTTP3Set_String(t *testing.T) {
+	set := NewHTTP3Set()
+	if set.String() != "{}" {
+		t.Errorf("Expected an empty set, got %s", set.String())
+	}
+	set.Add("CONTROL", false, "SETTINGS")
+	set.Add("0", false, "HEADERS")
+	set.Add("0", true, "DATA")
+	if expected := "{H3(0,FIN)[DATA,HEADERS],H3(CONTROL)[SETTINGS]}"; set.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, set.String())
+	}
+}
@@ -0,0 +1,369 @@
+package adapter
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	qt "github.com/PROGNOSISTool/adapter-quic"
+	"github.com/PROGNOSISTool/adapter-quic/agents"
+	"github.com/PROGNOSISTool/adapter-quic/http3"
+	"github.com/PROGNOSISTool/adapter-quic/qpack"
+	tcp "github.com/PROGNOSISTool/tcp_server"
+)
+
+// The streams of the client used by the inputs on unidirectional streams.
+var http3ClientStreams = map[string]uint64{
+	HTTP3ControlStream: 2,
+	HTTP3EncoderStream: 6,
+	HTTP3DecoderStream: 10,
+}
+
+// The order in which the elements of an input are sent on its stream.
+var http3InputOrder = []string{HTTP3Open, "SETTINGS", "HEADERS", "DATA", "GOAWAY"}
+
+const http3HandshakeTimeout = 10 * time.Second
+
+// The state of the parsing of a stream of the server, or of a request stream.
+type http3StreamState struct {
+	stream      string // The stream of the symbols, empty until the type of a unidirectional stream is known
+	offset      uint64 // The number of bytes parsed
+	finReported bool
+	reset       bool
+	stopSending bool
+}
+
+// The HTTP3Adapter exposes the HTTP/3 layer of the SUL to the learner, on top of a QUIC handshake completed for each
+// query. Its inputs are HTTP3Symbol describing the frames to send on a stream, e.g. H3(CONTROL)[OPEN,SETTINGS] opens
+// the control stream and sends a SETTINGS frame on it, or H3(0,FIN)[HEADERS] sends a GET request on stream 0. Its
+// outputs are the HTTP3Symbol describing the frames parsed on each stream of the server, and how the connection was
+// closed, e.g. H3(CLOSE)[H3_FRAME_UNEXPECTED].
+type HTTP3Adapter struct {
+	connection *qt.Connection
+	agents     *agents.ConnectionAgents
+	trace      *qt.Trace
+	server     *tcp.Server
+	stop       chan bool
+	Logger     *log.Logger
+
+	sulAddress string
+	sulName    string
+	httpPath   string
+	waitTime   time.Duration
+	tracing    bool
+
+	connected       bool // Whether the QUIC handshake of the current connection completed
+	encoder         *qpack.Encoder
+	streams         map[uint64]*http3StreamState
+	incomingPackets chan interface{}
+	oracleTable     map[string]string
+}
+
+func NewHTTP3Adapter(adapterAddress string, sulAddress string, sulName string, httpPath string, tracing bool, waitTime time.Duration) *HTTP3Adapter {
+	adapter := new(HTTP3Adapter)
+	adapter.Logger = log.New(os.Stderr, "[HTTP3 ADAPTER] ", log.Lshortfile)
+	adapter.Logger.Printf("Adapter Address: %v", adapterAddress)
+	adapter.Logger.Printf("SUL Address: %v", sulAddress)
+	adapter.Logger.Printf("SUL Name: %v", sulName)
+	adapter.Logger.Printf("HTTP Path: %v", httpPath)
+	adapter.Logger.Printf("TRACING: %v", tracing)
+	adapter.Logger.Printf("Wait Time: %v", waitTime)
+
+	adapter.sulAddress = sulAddress
+	adapter.sulName = sulName
+	adapter.httpPath = httpPath
+	adapter.waitTime = waitTime
+	adapter.tracing = tracing
+	adapter.stop = make(chan bool, 1)
+	adapter.oracleTable = make(map[string]string)
+	adapter.server = tcp.New(adapterAddress)
+	adapter.server.OnNewMessage(adapter.handleNewServerInput)
+	return adapter
+}
+
+func (a *HTTP3Adapter) Run() {
+	go a.server.Listen()
+	a.Logger.Printf("Server now listening.")
+	<-a.stop
+}
+
+func (a *HTTP3Adapter) Stop() {
+	writeJson(fmt.Sprintf("http3OracleTable-%d.json", time.Now().Unix()), a.oracleTable)
+	a.SaveTrace(fmt.Sprintf("trace-%d.json", time.Now().Unix()))
+	if a.agents != nil {
+		a.agents.StopAll()
+	}
+	a.stop <- true
+}
+
+// Opens a new connection to the SUL and completes the QUIC handshake. The frames sent by the SUL right after the
+// handshake, e.g. on its control stream, are not reported to the learner, as they do not depend on its inputs.
+func (a *HTTP3Adapter) connect() {
+	if a.agents != nil {
+		a.agents.StopAll()
+		a.connection.Close()
+	}
+	a.connected = false
+	a.encoder = qpack.NewEncoder()
+	a.streams = make(map[uint64]*http3StreamState)
+
+	var err error
+	a.connection, err = qt.NewDefaultConnection(a.sulAddress, a.sulName, nil, false, "hq", true)
+	if err != nil {
+		a.Logger.Printf("Unable to connect to the SUL: %v", err)
+		a.agents = nil
+		return
+	}
+	a.connection.TLSTPHandler.MaxUniStreams = 8
+	if a.tracing {
+		if a.trace == nil {
+			a.trace = qt.NewTrace("HTTP3Adapter", 1, a.sulAddress)
+			a.trace.StartedAt = time.Now().Unix()
+		}
+		a.trace.AttachTo(a.connection)
+	}
+	a.incomingPackets = a.connection.IncomingPackets.RegisterNewChan(1000)
+
+	a.agents = agents.AttachAgentsToConnection(a.connection, agents.GetDefaultAgents()...)
+	handshakeAgent := &agents.HandshakeAgent{TLSAgent: a.agents.Get("TLSAgent").(*agents.TLSAgent), SocketAgent: a.agents.Get("SocketAgent").(*agents.SocketAgent)}
+	a.agents.Add(handshakeAgent)
+	a.agents.Get("SendingAgent").(*agents.SendingAgent).FrameProducer = a.agents.GetFrameProducingAgents()
+
+	handshakeStatus := handshakeAgent.HandshakeStatus.RegisterNewChan(10)
+	handshakeAgent.InitiateHandshake()
+	select {
+	case i := <-handshakeStatus:
+		status := i.(agents.HandshakeStatus)
+		a.connected = status.Completed
+		if !status.Completed {
+			a.Logger.Printf("QUIC handshake failed: %v", status.Error)
+		}
+	case <-time.After(http3HandshakeTimeout):
+		a.Logger.Printf("QUIC handshake timed out")
+	}
+	if a.connected {
+		time.Sleep(a.waitTime)
+		a.Logger.Printf("Received after the handshake: %v", a.observe().String())
+	}
+}
+
+func (a *HTTP3Adapter) handleNewServerInput(client *tcp.Client, message string) {
+	message = strings.TrimSuffix(message, "\n")
+	message = strings.TrimSuffix(message, "\r")
+	query := strings.Split(message, " ")
+	a.Logger.Printf("Server input: %v", query)
+	if len(query) == 1 {
+		switch query[0] {
+		case "START":
+			a.connect()
+			return
+		case "RESET":
+			a.Logger.Print("Received RESET command")
+			a.connect()
+			a.Logger.Print("Finished RESET mechanism")
+			if err := client.Send("DONE\n"); err != nil {
+				a.Logger.Printf("Unable to send DONE to the learner: %v\n", err)
+			}
+			return
+		case "STOP":
+			a.Stop()
+			_ = client.Close()
+			os.Exit(0)
+		}
+	}
+	a.handleNewAbstractQuery(client, query)
+}
+
+func (a *HTTP3Adapter) handleNewAbstractQuery(client *tcp.Client, query []string) {
+	outputs := []string{}
+	for _, message := range query {
+		output := NewHTTP3Set()
+		input, err := NewHTTP3SymbolFromString(message)
+		if err != nil {
+			a.Logger.Print(err.Error())
+		} else if a.connected {
+			a.Logger.Printf("Submitting request: %v", input.String())
+			a.send(&input)
+			time.Sleep(a.waitTime)
+			output = a.observe()
+			a.Logger.Printf("Got response: %v", output.String())
+		} else {
+			a.Logger.Printf("No connection established, unable to send %v", message)
+		}
+		outputs = append(outputs, output.String())
+	}
+
+	result := strings.Join(outputs, " ")
+	a.oracleTable[strings.Join(query, " ")] = result
+	if err := client.Send(result + "\n"); err != nil {
+		a.Logger.Printf("Unable to send the outputs to the learner: %v\n", err)
+	}
+}
+
+// Sends the elements of the input on its stream, in the order of http3InputOrder.
+func (a *HTTP3Adapter) send(input *HTTP3Symbol) {
+	streamID, ok := input.StreamID()
+	if !ok {
+		if streamID, ok = http3ClientStreams[input.Stream]; !ok {
+			a.Logger.Printf("Unable to send on stream %v", input.Stream)
+			return
+		}
+	}
+	buffer := new(bytes.Buffer)
+	for _, element := range http3InputOrder {
+		if !input.Elements.Contains(element) {
+			continue
+		}
+		switch element {
+		case HTTP3Open:
+			switch input.Stream {
+			case HTTP3ControlStream:
+				buffer.WriteByte(http3.StreamTypeControl)
+			case HTTP3EncoderStream:
+				buffer.WriteByte(qpack.StreamTypeEncoder)
+			case HTTP3DecoderStream:
+				buffer.WriteByte(qpack.StreamTypeDecoder)
+			}
+		case "SETTINGS":
+			http3.NewSETTINGS(nil).WriteTo(buffer)
+		case "HEADERS":
+			headers := []qpack.HeaderField{{":method", "GET"}, {":scheme", "https"}, {":authority", a.sulName}, {":path", a.httpPath}}
+			block, _ := a.encoder.Encode(streamID, headers)
+			http3.NewHEADERS(block).WriteTo(buffer)
+		case "DATA":
+			http3.NewDATA([]byte("DATA")).WriteTo(buffer)
+		case "GOAWAY":
+			http3.NewGOAWAY(0).WriteTo(buffer)
+		}
+	}
+	for _, element := range input.Elements.ToSlice() {
+		if !contains(http3InputOrder, element.(string)) {
+			a.Logger.Printf("Input element %v is not implemented", element)
+		}
+	}
+	if buffer.Len() > 0 || input.Fin {
+		a.connection.Streams.Send(streamID, buffer.Bytes(), input.Fin)
+	}
+}
+
+// Returns the symbols received since the last call, by parsing the new data received on each stream and the frames
+// received that close the connection.
+func (a *HTTP3Adapter) observe() *HTTP3Set {
+	output := NewHTTP3Set()
+	for {
+		select {
+		case i := <-a.incomingPackets:
+			if framer, ok := i.(qt.Framer); ok {
+				for _, f := range framer.GetAll(qt.ApplicationCloseType) {
+					output.Add(HTTP3Connection, false, http3.ErrorCodeName(f.(*qt.ApplicationCloseFrame).ErrorCode))
+				}
+				if framer.Contains(qt.ConnectionCloseType) {
+					output.Add(HTTP3Connection, false, HTTP3Transport)
+				}
+			}
+			continue
+		default:
+		}
+		break
+	}
+	for streamID, stream := range a.connection.Streams.GetAll() {
+		if qt.IsUniClient(streamID) {
+			continue
+		}
+		state, ok := a.streams[streamID]
+		if !ok {
+			state = &http3StreamState{}
+			if qt.IsBidi(streamID) {
+				state.stream = fmt.Sprint(streamID)
+			}
+			a.streams[streamID] = state
+		}
+		a.observeStream(output, streamID, stream, state)
+	}
+	return output
+}
+
+func (a *HTTP3Adapter) observeStream(output *HTTP3Set, streamID uint64, stream *qt.Stream, state *http3StreamState) {
+	data, fin, _ := stream.ReceivedData(state.offset, math.MaxInt32)
+	r := bytes.NewReader(data)
+	var elements []string
+	if state.stream == "" {
+		streamType, err := qt.ReadVarInt(r)
+		if err != nil {
+			return
+		}
+		name, ok := http3StreamTypeToString[streamType.Value]
+		if !ok { // Streams of unknown types, e.g. reserved ones, are ignored
+			state.stream = HTTP3Unknown
+		} else if name == HTTP3PushStream {
+			if _, err := qt.ReadVarInt(r); err != nil { // The push ID
+				return
+			}
+		}
+		if ok {
+			state.stream = name
+			elements = append(elements, HTTP3Open)
+		}
+	}
+
+	switch state.stream {
+	case HTTP3Unknown:
+		r.Seek(0, 2)
+	case HTTP3EncoderStream, HTTP3DecoderStream:
+		if r.Len() > 0 {
+			elements = append(elements, HTTP3Instructions)
+			r.Seek(0, 2)
+		}
+	default:
+		for r.Len() > 0 {
+			start := r.Len()
+			frameType, err1 := qt.ReadVarInt(r)
+			length, err2 := qt.ReadVarInt(r)
+			if err1 != nil || err2 != nil || uint64(r.Len()) < length.Value {
+				r.Seek(int64(len(data)-start), 0)
+				break
+			}
+			r.Seek(int64(length.Value), 1)
+			if name, ok := http3FrameTypeToString[frameType.Value]; ok {
+				elements = append(elements, name)
+			} else {
+				elements = append(elements, HTTP3Unknown)
+			}
+		}
+	}
+	state.offset += uint64(len(data) - r.Len())
+
+	reportFin := fin && r.Len() == 0 && !state.finReported
+	state.finReported = state.finReported || reportFin
+	if _, reset := stream.ResetReceived(); reset && !state.reset {
+		state.reset = true
+		elements = append(elements, HTTP3Reset)
+	}
+	if _, stopSending := stream.StopSendingReceived(); stopSending && !state.stopSending {
+		state.stopSending = true
+		elements = append(elements, HTTP3StopSending)
+	}
+	if state.stream != HTTP3Unknown && (len(elements) > 0 || reportFin) {
+		output.Add(state.stream, reportFin, elements...)
+	}
+}
+
+func (a *HTTP3Adapter) SaveTrace(filename string) {
+	if a.trace != nil && a.connection != nil {
+		a.trace.Complete(a.connection)
+		writeJson(filename, a.trace)
+	}
+}
+
+func contains(slice []string, s string) bool {
+	for _, e := range slice {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package adapter
+
+import (
+	"fmt"
+
+	qt "github.com/PROGNOSISTool/adapter-quic"
+)
+
+// The resumption policies decide which state of a connection is carried into the next one when the adapter is RESET.
+const (
+	ResumptionNever          = "never"           // Every connection starts from scratch
+	ResumptionAlways         = "always"          // The state learned in the previous connection is always carried
+	ResumptionAfterHandshake = "after_handshake" // The state is only carried when the previous connection completed its handshake
+)
+
+func checkResumptionPolicy(policy string) error {
+	switch policy {
+	case ResumptionNever, ResumptionAlways, ResumptionAfterHandshake:
+		return nil
+	}
+	return fmt.Errorf("unknown resumption policy '%s'", policy)
+}
+
+// Returns the session ticket, server transport parameters and NEW_TOKEN token learned in the current connection that
+// should be used in the next one according to the resumption policy, or nil if it should start from scratch. When no
+// ticket was received, the ticket the current connection was started with is carried again.
+func (a *Adapter) resumptionState() *qt.SessionEntry {
+	switch a.resumptionPolicy {
+	case ResumptionNever:
+		return nil
+	case ResumptionAfterHandshake:
+		if !a.handshakeCompleted {
+			a.Logger.Print("Handshake was not completed, starting the next connection from scratch")
+			return nil
+		}
+	}
+
+	session := &qt.SessionEntry{Token: a.newToken}
+	if ticket := a.connection.Tls.ResumptionTicket(); len(ticket) > 0 {
+		session.ResumptionTicket = append([]byte{}, ticket...)
+		session.TransportParameters = a.connection.TLSTPHandler.ReceivedParameters
+	} else if len(a.connection.ResumptionTicket) > 0 { // Keeps the ticket inherited from an earlier connection
+		session.ResumptionTicket = a.connection.ResumptionTicket
+		session.TransportParameters = a.connection.RememberedParameters
+	}
+	a.Logger.Printf("Carrying a %d-byte session ticket and a %d-byte token into the next connection", len(session.ResumptionTicket), len(session.Token))
+	return session
+}
@@ -1,19 +1,41 @@
 package agents
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	. "github.com/PROGNOSISTool/adapter-quic"
 )
 
+const (
+	DefaultAckElicitingThreshold = 1
+	DefaultMaxAckDelay           = 25 * time.Millisecond
+	DefaultReorderingThreshold   = 1
+)
+
 // The AckAgent is in charge of queuing ACK frames in response to receiving packets that need to be acknowledged as well
 // as answering to PATH_CHALLENGE frames. Both can be disabled independently for a finer control on its behaviour.
+//
+// By default, every ack-eliciting packet is acknowledged immediately. When DelayAcks is set, acknowledgements in the
+// application data space follow the ACK frequency extension: an ACK is sent once more than AckElicitingThreshold
+// ack-eliciting packets are received, once ReorderingThreshold packets are missing, when an IMMEDIATE_ACK frame is
+// received or when MaxAckDelay expires. Setting MinAckDelay advertises the min_ack_delay transport parameter, which
+// allows the peer to send ACK_FREQUENCY frames. These frames update the thresholds and enable DelayAcks, and are ignored
+// when min_ack_delay was not advertised.
 type AckAgent struct {
 	FrameProducingAgent
-	DisableAcks         map[PNSpace]bool
-	TotalDataAcked      map[PNSpace]uint64
-	SendFromQueue		chan PNSpace
-	DisablePathResponse bool
+	DisableAcks           map[PNSpace]bool
+	TotalDataAcked        map[PNSpace]uint64
+	SendFromQueue         chan PNSpace
+	DisablePathResponse   bool
+	DelayAcks             bool
+	MinAckDelay           time.Duration
+	AckElicitingThreshold uint64
+	MaxAckDelay           time.Duration
+	ReorderingThreshold   uint64
+	ackFrequencySequence  uint64
+	receivedAckFrequency  *AckFrequencyFrame
 }
 
 func (a *AckAgent) Run(conn *Connection) {
@@ -24,6 +46,27 @@ func (a *AckAgent) Run(conn *Connection) {
 		a.DisableAcks = make(map[PNSpace]bool)
 	}
 	a.TotalDataAcked = make(map[PNSpace]uint64)
+	if a.AckElicitingThreshold == 0 && a.MaxAckDelay == 0 && a.ReorderingThreshold == 0 {
+		a.AckElicitingThreshold = DefaultAckElicitingThreshold
+		a.MaxAckDelay = DefaultMaxAckDelay
+		a.ReorderingThreshold = DefaultReorderingThreshold
+	}
+	if a.MinAckDelay > 0 {
+		conn.TLSTPHandler.MinAckDelay = uint64(a.MinAckDelay / time.Microsecond)
+	}
+
+	var unackedElicitingPackets uint64
+	var largestReceived PacketNumber
+	packetReceived := false // Whether largestReceived was set by a packet of the application data space
+	ackTimer := time.NewTimer(0)
+	<-ackTimer.C
+	ackTimerArmed := false
+	stopAckTimer := func() {
+		if ackTimerArmed && !ackTimer.Stop() {
+			<-ackTimer.C
+		}
+		ackTimerArmed = false
+	}
 
 	recvdTimestamps := make(map[PNSpace]map[PacketNumber]time.Time)
 	for _, space := range []PNSpace{PNSpaceInitial, PNSpaceHandshake, PNSpaceAppData} {
@@ -42,23 +85,48 @@ func (a *AckAgent) Run(conn *Connection) {
 					pn := p.GetHeader().GetPacketNumber()
 					for _, number := range conn.AckQueue[p.PNSpace()] {
 						if number == pn {
-							a.Logger.Printf("Received duplicate packet number %d in PN space %s\n", pn, p.PNSpace().String())
-							// TODO: This should be flagged somewhere, and placed in a more general ErrorAgent
+							a.Logger.Printf("Received duplicate packet number %d in PN space %s\n", pn, p.PNSpace().String()) // Reported by the ConformanceAgent
 						}
 					}
 
 					conn.AckQueue[p.PNSpace()] = append(conn.AckQueue[p.PNSpace()], pn)
 					recvdTimestamps[p.PNSpace()][p.GetHeader().GetPacketNumber()] = p.ReceiveContext().Timestamp
 
+					immediateAck := false
 					if framePacket, ok := p.(Framer); ok {
 						if pathChallenge := framePacket.GetFirst(PathChallengeType); !a.DisablePathResponse && pathChallenge != nil {
 							conn.FrameQueue.Submit(QueuedFrame{&PathResponse{pathChallenge.(*PathChallenge).Data}, p.EncryptionLevel()})
 						}
+						for _, f := range framePacket.GetAll(AckFrequencyType) {
+							a.handleAckFrequency(f.(*AckFrequencyFrame))
+						}
+						immediateAck = framePacket.Contains(ImmediateAckType)
+					}
+
+					outOfOrder := false
+					if p.PNSpace() == PNSpaceAppData {
+						if packetReceived && (pn < largestReceived || (a.ReorderingThreshold > 0 && uint64(pn - largestReceived) > a.ReorderingThreshold)) {
+							outOfOrder = a.ReorderingThreshold > 0
+						}
+						if !packetReceived || pn > largestReceived {
+							largestReceived = pn
+							packetReceived = true
+						}
 					}
 
 					if !a.DisableAcks[p.PNSpace()] && p.ShouldBeAcknowledged() {
-						a.conn.PreparePacket.Submit(p.EncryptionLevel())
 						a.TotalDataAcked[p.PNSpace()] += uint64(len(p.Encode(p.EncodePayload()))) // TODO: See following todo
+						if !a.DelayAcks || p.PNSpace() != PNSpaceAppData {
+							a.conn.PreparePacket.Submit(p.EncryptionLevel())
+						} else {
+							unackedElicitingPackets++
+							if immediateAck || outOfOrder || unackedElicitingPackets > a.AckElicitingThreshold {
+								a.conn.PreparePacket.Submit(p.EncryptionLevel())
+							} else if !ackTimerArmed {
+								ackTimer.Reset(a.MaxAckDelay)
+								ackTimerArmed = true
+							}
+						}
 					}
 				}
 			case args := <-a.requestFrame: // TODO: Keep track of the ACKs and their packet to shorten the ack blocks once received by the peer
@@ -74,6 +142,10 @@ func (a *AckAgent) Run(conn *Connection) {
 						f.AckDelay = uint64((time.Now().Sub(lRTimestamp).Round(time.Microsecond) / time.Microsecond) >> conn.TLSTPHandler.AckDelayExponent)
 					}
 					if args.availableSpace >= int(f.FrameLength()) {
+						if pnSpace == PNSpaceAppData {
+							unackedElicitingPackets = 0
+							stopAckTimer()
+						}
 						a.frames <- []Frame{f}
 					} else {
 						a.conn.PreparePacket.Submit(args.level)
@@ -93,9 +165,59 @@ func (a *AckAgent) Run(conn *Connection) {
 					Frame:           ackFrame,
 					EncryptionLevel: PNSpaceToEncryptionLevel[pnSpace],
 				})
+			case <-ackTimer.C:
+				ackTimerArmed = false
+				if unackedElicitingPackets > 0 {
+					a.conn.PreparePacket.Submit(EncryptionLevel1RTT)
+				}
 			case <-a.close:
+				stopAckTimer()
 				return
 			}
 		}
 	}()
 }
+
+func (a *AckAgent) handleAckFrequency(f *AckFrequencyFrame) {
+	if a.conn.TLSTPHandler.MinAckDelay == 0 {
+		a.Logger.Println("Ignoring an ACK_FREQUENCY frame received without advertising min_ack_delay")
+		return
+	} else if f.RequestedMaxAckDelay < a.conn.TLSTPHandler.MinAckDelay {
+		a.Logger.Printf("Received an ACK_FREQUENCY frame requesting a max ack delay of %dus, lower than the advertised min_ack_delay\n", f.RequestedMaxAckDelay)
+	}
+	if a.receivedAckFrequency != nil && f.SequenceNumber <= a.receivedAckFrequency.SequenceNumber {
+		a.Logger.Printf("Ignoring ACK_FREQUENCY frame with sequence number %d\n", f.SequenceNumber)
+		return
+	}
+	a.receivedAckFrequency = f
+	a.DelayAcks = true
+	a.AckElicitingThreshold = f.AckElicitingThreshold
+	a.MaxAckDelay = time.Duration(f.RequestedMaxAckDelay) * time.Microsecond
+	a.ReorderingThreshold = f.ReorderingThreshold
+	a.Logger.Printf("Now acknowledging after %d ack-eliciting packets, %s or %d missing packets\n", a.AckElicitingThreshold, a.MaxAckDelay, a.ReorderingThreshold)
+}
+
+// Queues an ACK_FREQUENCY frame at the given encryption level, requesting the peer to send an ACK after receiving more
+// than ackElicitingThreshold ack-eliciting packets, after maxAckDelay or after reorderingThreshold missing packets. It
+// returns an error if the peer did not advertise min_ack_delay or if the requested delay is lower than this value.
+func (a *AckAgent) RequestAckFrequency(ackElicitingThreshold uint64, maxAckDelay time.Duration, reorderingThreshold uint64, level EncryptionLevel) error {
+	if a.conn.TLSTPHandler.ReceivedParameters == nil || a.conn.TLSTPHandler.ReceivedParameters.MinAckDelay == 0 {
+		return errors.New("peer does not support the ACK frequency extension")
+	}
+	requestedMaxAckDelay := uint64(maxAckDelay / time.Microsecond)
+	if min := a.conn.TLSTPHandler.ReceivedParameters.MinAckDelay; requestedMaxAckDelay < min {
+		return fmt.Errorf("requested max ack delay of %dus is lower than the peer min_ack_delay of %dus", requestedMaxAckDelay, min)
+	}
+	a.conn.FrameQueue.Submit(QueuedFrame{&AckFrequencyFrame{a.ackFrequencySequence, ackElicitingThreshold, requestedMaxAckDelay, reorderingThreshold}, level})
+	a.ackFrequencySequence++
+	return nil
+}
+
+// Queues an IMMEDIATE_ACK frame at the given encryption level.
+func (a *AckAgent) RequestImmediateAck(level EncryptionLevel) error {
+	if a.conn.TLSTPHandler.ReceivedParameters == nil || a.conn.TLSTPHandler.ReceivedParameters.MinAckDelay == 0 {
+		return errors.New("peer does not support the ACK frequency extension")
+	}
+	a.conn.FrameQueue.Submit(QueuedFrame{new(ImmediateAckFrame), level})
+	return nil
+}
@@ -6,6 +6,7 @@
 package agents
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
 	"log"
@@ -224,15 +225,31 @@ func (c *ConnectionAgents) AddHTTPAgent() HTTPAgent {
 	return agent
 }
 
+// Opens a new bidirectional stream, see StreamAgent.OpenStream.
+func (c *ConnectionAgents) OpenStream() *StreamHandle {
+	return c.Get("StreamAgent").(*StreamAgent).OpenStream()
+}
+
+// Opens a new unidirectional stream, see StreamAgent.OpenUniStream.
+func (c *ConnectionAgents) OpenUniStream() *StreamHandle {
+	return c.Get("StreamAgent").(*StreamAgent).OpenUniStream()
+}
+
+// Returns the next stream opened by the peer, see StreamAgent.AcceptStream.
+func (c *ConnectionAgents) AcceptStream(ctx context.Context) (*StreamHandle, error) {
+	return c.Get("StreamAgent").(*StreamAgent).AcceptStream(ctx)
+}
+
 // Returns the agents needed for a basic QUIC connection to operate
 func GetDefaultAgents() []Agent {
 	fc := &FlowControlAgent{}
+	tls := &TLSAgent{}
 	return []Agent{
 		&QLogAgent{},
 		&SocketAgent{},
 		&ParsingAgent{},
 		&BufferAgent{},
-		&TLSAgent{},
+		tls,
 		&AckAgent{},
 		&SendingAgent{MTU: 1200},
 		&RecoveryAgent{TimerValue: 500 * time.Millisecond},
@@ -241,6 +258,8 @@ func GetDefaultAgents() []Agent {
 		fc,
 		&StreamAgent{FlowControlAgent: fc},
 		&ClosingAgent{},
+		&SessionStoreAgent{TLSAgent: tls},
+		&ConformanceAgent{},
 	}
 }
 
@@ -0,0 +1,209 @@
+package agents
+
+import (
+	"fmt"
+
+	. "github.com/PROGNOSISTool/adapter-quic"
+	"github.com/PROGNOSISTool/adapter-quic/qlog"
+)
+
+// The frames that can be carried in Initial and Handshake packets, see RFC 9000 Section 12.4.
+var handshakeFrameTypes = map[FrameType]bool{
+	PaddingFrameType:    true,
+	PingType:            true,
+	AckType:             true,
+	AckECNType:          true,
+	CryptoType:          true,
+	ConnectionCloseType: true,
+}
+
+// The ConformanceAgent is responsible of checking the behaviour of the peer against a catalogue of MUST-level rules of
+// RFC 9000. It looks at the packets received and at the transport parameters of the peer. The violations of these rules,
+// of the stream states and of our flow control limits are recorded in the ConformanceReport of the connection and in its
+// qlog trace. The agent does not react to them.
+type ConformanceAgent struct {
+	BaseAgent
+	conn                *Connection
+	packetsSent         map[PNSpace]map[PacketNumber]bool
+	packetsReceived     map[PNSpace]map[PacketNumber]bool
+	activeConnectionIds map[uint64]bool
+}
+
+func (a *ConformanceAgent) Run(conn *Connection) {
+	a.Init("ConformanceAgent", conn.OriginalDestinationCID)
+	a.conn = conn
+	a.packetsSent = make(map[PNSpace]map[PacketNumber]bool)
+	a.packetsReceived = make(map[PNSpace]map[PacketNumber]bool)
+	for _, space := range []PNSpace{PNSpaceInitial, PNSpaceHandshake, PNSpaceAppData} {
+		a.packetsSent[space] = make(map[PacketNumber]bool)
+		a.packetsReceived[space] = make(map[PacketNumber]bool)
+	}
+	a.activeConnectionIds = map[uint64]bool{0: true}
+
+	incomingPackets := conn.IncomingPackets.RegisterNewChan(1000)
+	outgoingPackets := conn.OutgoingPackets.RegisterNewChan(1000)
+	tpReceived := conn.TransportParameters.RegisterNewChan(10)
+	streamViolations := conn.StreamViolations.RegisterNewChan(1000)
+	flowControlViolations := conn.FlowControlViolations.RegisterNewChan(1000)
+
+	go func() {
+		defer a.Logger.Println("Agent terminated")
+		defer close(a.closed)
+		for {
+			select {
+			case i := <-incomingPackets:
+				// The packets sent are accounted first, so that ACK frames are checked against all of them
+			drain:
+				for {
+					select {
+					case o, ok := <-outgoingPackets:
+						if !ok {
+							break drain
+						}
+						a.packetSent(o.(Packet))
+					default:
+						break drain
+					}
+				}
+				a.checkPacket(i.(Packet))
+			case i := <-outgoingPackets:
+				a.packetSent(i.(Packet))
+			case i := <-tpReceived:
+				a.checkTransportParameters(i.(QuicTransportParameters))
+			case i := <-streamViolations:
+				v := i.(StreamViolation)
+				a.report(RuleStreamState, v.ErrorCode, nil, "%s frame on stream %d: %s", v.FrameType.String(), v.StreamId, v.Reason)
+			case i := <-flowControlViolations:
+				v := i.(FlowControlViolation)
+				rule := RuleFlowControlLimitExceeded
+				if v.ErrorCode == ERR_STREAM_LIMIT_ERROR {
+					rule = RuleStreamLimitExceeded
+				}
+				a.report(rule, v.ErrorCode, nil, "%s frame on stream %d: %s", v.FrameType.String(), v.StreamId, v.Reason)
+			case <-a.close:
+				return
+			}
+		}
+	}()
+}
+
+func (a *ConformanceAgent) report(rule string, errorCode uint64, packet Packet, format string, args ...interface{}) {
+	v := ConformanceViolation{Rule: rule, Description: fmt.Sprintf(format, args...), ErrorCode: errorCode}
+	if packet != nil {
+		v.Packet = packet.ShortString()
+	}
+	a.Logger.Printf("Violation of rule %s: %s\n", v.Rule, v.Description)
+	a.conn.ConformanceReport.Add(v)
+	a.conn.QLogEvents <- a.conn.QLogTrace.NewEvent(qlog.Categories.Conformance.Category, qlog.Categories.Conformance.ViolationDetected, v)
+}
+
+func (a *ConformanceAgent) packetSent(p Packet) {
+	framer, ok := p.(Framer)
+	if !ok {
+		return
+	}
+	a.packetsSent[p.PNSpace()][p.GetHeader().GetPacketNumber()] = true
+	for _, f := range framer.GetAll(RetireConnectionIdType) {
+		delete(a.activeConnectionIds, f.(*RetireConnectionId).SequenceNumber)
+	}
+}
+
+func (a *ConformanceAgent) checkPacket(p Packet) {
+	if p.PNSpace() == PNSpaceNoSpace {
+		return
+	}
+
+	switch h := p.GetHeader().(type) {
+	case *LongHeader:
+		if h.LowerBits&0x0c != 0 {
+			a.report(RuleReservedBitsSet, ERR_PROTOCOL_VIOLATION, p, "reserved bits of the long header are 0x%x", (h.LowerBits&0x0c)>>2)
+		}
+	case *ShortHeader:
+		if h.ReservedBits != 0 {
+			a.report(RuleReservedBitsSet, ERR_PROTOCOL_VIOLATION, p, "reserved bits of the short header are 0x%x", h.ReservedBits)
+		}
+	}
+	if p.GetHeader().GetPacketType() == ZeroRTTProtected {
+		a.report(RulePacketTypeNotAllowed, ERR_PROTOCOL_VIOLATION, p, "servers must not send 0-RTT packets")
+	}
+
+	pn := p.GetHeader().GetPacketNumber()
+	if a.packetsReceived[p.PNSpace()][pn] {
+		a.report(RulePacketNumberReused, ERR_PROTOCOL_VIOLATION, p, "packet number %d was already received in %s", pn, p.PNSpace().String())
+	}
+	a.packetsReceived[p.PNSpace()][pn] = true
+
+	framer, ok := p.(Framer)
+	if !ok {
+		return
+	}
+	for _, f := range framer.GetFrames() {
+		if (p.PNSpace() == PNSpaceInitial || p.PNSpace() == PNSpaceHandshake) && !handshakeFrameTypes[f.FrameType()] {
+			a.report(RuleFrameNotAllowed, ERR_PROTOCOL_VIOLATION, p, "%s frame is not allowed in %s packets", f.FrameType().String(), p.GetHeader().GetPacketType().String())
+		}
+		switch frame := f.(type) {
+		case *AckFrame:
+			a.checkAck(p, frame)
+		case *AckECNFrame:
+			a.checkAck(p, &frame.AckFrame)
+		case *NewConnectionIdFrame:
+			a.checkConnectionIdLimit(p, frame)
+		}
+	}
+}
+
+func (a *ConformanceAgent) checkAck(p Packet, ack *AckFrame) {
+	sent := a.packetsSent[p.PNSpace()]
+	for _, r := range ack.GetAckedRanges() {
+		count := uint64(0)
+		for pn := range sent {
+			if r[0] <= pn && pn <= r[1] {
+				count++
+			}
+		}
+		if count < uint64(r[1]-r[0])+1 {
+			a.report(RuleUnsentPacketAcknowledged, ERR_PROTOCOL_VIOLATION, p, "range [%d, %d] acknowledges %d packets that were not sent", r[0], r[1], uint64(r[1]-r[0])+1-count)
+		}
+	}
+}
+
+func (a *ConformanceAgent) checkConnectionIdLimit(p Packet, f *NewConnectionIdFrame) {
+	for sequence := range a.activeConnectionIds {
+		if sequence < f.RetirePriorTo {
+			delete(a.activeConnectionIds, sequence)
+		}
+	}
+	if f.Sequence >= f.RetirePriorTo {
+		a.activeConnectionIds[f.Sequence] = true
+	}
+	limit := a.conn.TLSTPHandler.QuicTransportParameters.ActiveConnectionIdLimit
+	if limit < 2 {
+		limit = 2
+	}
+	if uint64(len(a.activeConnectionIds)) > limit {
+		a.report(RuleConnectionIdLimitExceeded, ERR_CONNECTION_ID_LIMIT_ERROR, p, "%d connection IDs are active while the limit is %d", len(a.activeConnectionIds), limit)
+	}
+}
+
+func (a *ConformanceAgent) checkTransportParameters(p QuicTransportParameters) {
+	for _, t := range p.DuplicateParameters {
+		a.report(RuleDuplicateTransportParameter, ERR_TRANSPORT_PARAMETER_ERROR, nil, "transport parameter 0x%x was received more than once", uint64(t))
+	}
+	for _, name := range []string{"original_destination_connection_id", "initial_source_connection_id"} {
+		if _, present := p.ToJSON[name]; !present {
+			a.report(RuleInvalidTransportParameter, ERR_TRANSPORT_PARAMETER_ERROR, nil, "transport parameter %s is missing", name)
+		}
+	}
+	if _, present := p.ToJSON["ack_delay_exponent"]; present && p.AckDelayExponent > 20 {
+		a.report(RuleInvalidTransportParameter, ERR_TRANSPORT_PARAMETER_ERROR, nil, "ack_delay_exponent %d is above 20", p.AckDelayExponent)
+	}
+	if _, present := p.ToJSON["max_ack_delay"]; present && p.MaxAckDelay >= 1<<14 {
+		a.report(RuleInvalidTransportParameter, ERR_TRANSPORT_PARAMETER_ERROR, nil, "max_ack_delay %d is not below 2^14", p.MaxAckDelay)
+	}
+	if _, present := p.ToJSON["max_packet_size"]; present && p.MaxPacketSize < 1200 {
+		a.report(RuleInvalidTransportParameter, ERR_TRANSPORT_PARAMETER_ERROR, nil, "max_udp_payload_size %d is below 1200", p.MaxPacketSize)
+	}
+	if _, present := p.ToJSON["active_connection_id_limit"]; present && p.ActiveConnectionIdLimit < 2 {
+		a.report(RuleInvalidTransportParameter, ERR_TRANSPORT_PARAMETER_ERROR, nil, "active_connection_id_limit %d is below 2", p.ActiveConnectionIdLimit)
+	}
+}
@@ -0,0 +1,34 @@
+package agents
+
+import (
+	"testing"
+
+	. "github.com/PROGNOSISTool/adapter-quic"
+	"github.com/PROGNOSISTool/adapter-quic/qlog"
+)
+
+func newTestConformanceAgent() *ConformanceAgent {
+	a := &ConformanceAgent{}
+	a.Init("ConformanceAgent", nil)
+	a.conn = &Connection{ConformanceReport: &ConformanceReport{}, QLogTrace: &qlog.Trace{}, QLogEvents: make(chan *qlog.Event, 100)}
+	a.packetsSent = make(map[PNSpace]map[PacketNumber]bool)
+	a.packetsReceived = map[PNSpace]map[PacketNumber]bool{PNSpaceAppData: make(map[PacketNumber]bool)}
+	return a
+}
+
+func TestConformanceAgent_PacketNumbers(t *testing.T) {
+	a := newTestConformanceAgent()
+	for _, pn := range []PacketNumber{0, 2, 3, 1, 3} {
+		p := new(ProtectedPacket)
+		p.Header = &ShortHeader{PacketNumber: pn}
+		a.checkPacket(p)
+	}
+
+	violations := a.conn.ConformanceReport.Violations()
+	if len(violations) != 1 {
+		t.Fatalf("expected only the reused packet number to be reported, got %v", violations)
+	}
+	if violations[0].Rule != RulePacketNumberReused {
+		t.Errorf("expected packet number 3 to be reported as %s, got %s", RulePacketNumberReused, violations[0].Rule)
+	}
+}
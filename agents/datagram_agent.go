@@ -0,0 +1,81 @@
+package agents
+
+import (
+	"errors"
+	"fmt"
+
+	. "github.com/PROGNOSISTool/adapter-quic"
+)
+
+// The DatagramAgent handles the unreliable DATAGRAM frames of RFC 9221. The content of each DATAGRAM frame received is
+// broadcast using DatagramReceived. Support for receiving DATAGRAM frames is advertised using the
+// max_datagram_frame_size transport parameter, which is set to MaxDatagramFrameSize if the agent is started before the
+// handshake. Datagrams can be sent using SendDatagram and QueueDatagram when the peer advertised its support.
+type DatagramAgent struct {
+	BaseAgent
+	conn                 *Connection
+	MaxDatagramFrameSize uint64
+	DatagramReceived     Broadcaster //type: []byte
+}
+
+func (a *DatagramAgent) Run(conn *Connection) {
+	a.Init("DatagramAgent", conn.OriginalDestinationCID)
+	a.conn = conn
+	a.DatagramReceived = NewBroadcaster(1000)
+
+	if a.MaxDatagramFrameSize == 0 {
+		a.MaxDatagramFrameSize = 65535
+	}
+	if conn.TLSTPHandler.MaxDatagramFrameSize == 0 {
+		conn.TLSTPHandler.MaxDatagramFrameSize = a.MaxDatagramFrameSize
+	}
+
+	incomingPackets := conn.IncomingPackets.RegisterNewChan(1000)
+
+	go func() {
+		defer a.Logger.Println("Agent terminated")
+		defer close(a.closed)
+
+		for {
+			select {
+			case i := <-incomingPackets:
+				switch p := i.(type) {
+				case Framer:
+					for _, f := range p.GetAll(DatagramType) {
+						datagram := f.(*DatagramFrame)
+						if uint64(datagram.FrameLength()) > conn.TLSTPHandler.MaxDatagramFrameSize {
+							a.Logger.Printf("Received a %d-byte DATAGRAM frame in packet %s, larger than the advertised limit of %d bytes\n", datagram.FrameLength(), p.ShortString(), conn.TLSTPHandler.MaxDatagramFrameSize)
+						}
+						a.Logger.Printf("Received a DATAGRAM frame of %d bytes in packet %s\n", len(datagram.Data), p.ShortString())
+						a.DatagramReceived.Submit(datagram.Data)
+					}
+				}
+			case <-a.close:
+				return
+			}
+		}
+	}()
+}
+
+// Queues a DATAGRAM frame carrying the given data at the given encryption level, without triggering the sending of a
+// packet. It returns an error if the peer does not support DATAGRAM frames or if the frame would exceed its limit.
+func (a *DatagramAgent) QueueDatagram(data []byte, level EncryptionLevel) error {
+	frame := NewDatagramFrame(data)
+	if a.conn.TLSTPHandler.ReceivedParameters == nil || a.conn.TLSTPHandler.ReceivedParameters.MaxDatagramFrameSize == 0 {
+		return errors.New("peer does not support receiving DATAGRAM frames")
+	}
+	if max := a.conn.TLSTPHandler.ReceivedParameters.MaxDatagramFrameSize; uint64(frame.FrameLength()) > max {
+		return fmt.Errorf("DATAGRAM frame of %d bytes exceeds the peer limit of %d bytes", frame.FrameLength(), max)
+	}
+	a.conn.FrameQueue.Submit(QueuedFrame{frame, level})
+	return nil
+}
+
+// Sends a DATAGRAM frame carrying the given data at the best application data encryption level available.
+func (a *DatagramAgent) SendDatagram(data []byte) error {
+	if err := a.QueueDatagram(data, EncryptionLevelBestAppData); err != nil {
+		return err
+	}
+	a.conn.PreparePacket.Submit(EncryptionLevelBestAppData)
+	return nil
+}
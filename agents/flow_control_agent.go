@@ -1,7 +1,10 @@
 package agents
 
 import (
+	"fmt"
 	"math"
+	"sync"
+	"time"
 
 	. "github.com/PROGNOSISTool/adapter-quic"
 )
@@ -20,6 +23,20 @@ func max(a, b uint64) uint64 {
 	return b
 }
 
+const DefaultMaxReceiveWindow = 16 * 1024 * 1024
+
+// A receive window is moved forward as data is consumed. When auto-tuned, its size is doubled each time it is moved
+// forward in less than a few RTTs, i.e. when it limits the throughput.
+type receiveWindow struct {
+	size        uint64
+	epochStart  time.Time
+	epochOffset uint64
+}
+
+func newReceiveWindow(size uint64) *receiveWindow {
+	return &receiveWindow{size: size, epochStart: time.Now()}
+}
+
 type reserveCreditArgs struct {
 	StreamId uint64
 	Credit   uint64
@@ -44,6 +61,15 @@ func (f *FlowControlLimits) Copy(tp *QuicTransportParameters) {
 	f.MaxStreamDataUni = tp.MaxStreamDataUni
 }
 
+// The FlowControlAgent is responsible of reserving credits for the data we send and of sliding the credit window of the
+// peer as data is consumed. It also checks that the peer respects the data and stream limits we advertised, in the
+// transport parameters and in the MAX_* frames sent. Violations are submitted to the FlowControlViolations of the
+// connection and can close the connection as a conformant client would when CloseOnViolation is set.
+//
+// Unless DontSlideCreditWindow is set, MAX_DATA and MAX_STREAM_DATA frames are sent once WindowUpdateThreshold of a
+// window has been consumed, and MAX_STREAMS frames once WindowUpdateThreshold of the initial stream limit has been
+// completed by the peer. AutoTuneWindows grows the windows up to MaxReceiveWindow to sustain the throughput of the peer.
+// DATA_BLOCKED, STREAM_DATA_BLOCKED and STREAMS_BLOCKED frames are sent once per limit of the peer that blocks us.
 type FlowControlAgent struct {
 	FrameProducingAgent
 	LocalFC               FlowControlLimits
@@ -51,8 +77,20 @@ type FlowControlAgent struct {
 	DisableFrameSending   bool
 	SendFromQueue		  chan FrameRequest
 	DontSlideCreditWindow bool
+	CloseOnViolation      bool
+	AutoTuneWindows       bool
+	WindowUpdateThreshold float64 // The fraction of a window to consume before raising its limit, 0 raises it on every frame
+	MaxReceiveWindow      uint64  // Caps the growth of auto-tuned windows, DefaultMaxReceiveWindow when unset
 	reserveCredit         chan reserveCreditArgs
 	creditsReserved       chan uint64
+	closing               bool
+	connectionWindow      *receiveWindow
+	streamWindows         map[uint64]*receiveWindow
+	streamsConsumed       map[uint64]uint64
+	dataConsumed          uint64
+	peerStreams           map[uint64]bool
+	creditLock            sync.Mutex
+	creditUpdated         chan struct{}
 }
 
 func (a *FlowControlAgent) InitStreamLimits(stream *Stream, streamId uint64) {
@@ -78,14 +116,24 @@ func (a *FlowControlAgent) InitStreamLimits(stream *Stream, streamId uint64) {
 	}
 }
 
-func (a *FlowControlAgent) Run(conn *Connection) { // TODO: Report violation of our limits by the other peer
+func (a *FlowControlAgent) Run(conn *Connection) {
 	a.Init("FlowControlAgent", conn.OriginalDestinationCID)
 	a.FrameProducingAgent.InitFPA(conn)
 	a.reserveCredit = make(chan reserveCreditArgs)
 	a.creditsReserved = make(chan uint64)
 	a.SendFromQueue = make(chan FrameRequest, 100)
+	a.closing = false
+	a.connectionWindow = nil
+	a.streamWindows = make(map[uint64]*receiveWindow)
+	a.streamsConsumed = make(map[uint64]uint64)
+	a.dataConsumed = 0
+	a.peerStreams = make(map[uint64]bool)
+	a.creditLock.Lock()
+	a.creditUpdated = make(chan struct{})
+	a.creditLock.Unlock()
 
 	incomingPackets := conn.IncomingPackets.RegisterNewChan(1000)
+	outgoingPackets := conn.OutgoingPackets.RegisterNewChan(1000)
 	tpReceived := conn.TransportParameters.RegisterNewChan(1)
 
 	blockedStreams := make(map[uint64]bool)
@@ -97,8 +145,18 @@ func (a *FlowControlAgent) Run(conn *Connection) { // TODO: Report violation of
 	var dataLimitsChanged bool
 	var uniStreamsBlocked bool
 	var bidiStreamsBlocked bool
+	var bidiLimitChanged bool
+	var uniLimitChanged bool
 	var ready bool
 
+	tpLocal := conn.TLSTPHandler.QuicTransportParameters
+	a.LocalFC.Copy(&tpLocal) // Our limits are known before the handshake and are checked from the first packet
+
+	if conn.RememberedParameters != nil { // Use the limits remembered from a previous connection for 0-RTT
+		a.RemoteFC.Copy(conn.RememberedParameters)
+		ready = true
+	}
+
 	go func() {
 		defer a.Logger.Println("Agent terminated")
 		defer close(a.closed)
@@ -110,9 +168,11 @@ func (a *FlowControlAgent) Run(conn *Connection) { // TODO: Report violation of
 				a.LocalFC.Copy(&tpLocal)
 				a.RemoteFC.Copy(&tpRemote)
 				ready = true
+				a.notifyCreditUpdated()
 			case i := <-incomingPackets:
 				switch p := i.(type) {
 				case *ProtectedPacket:
+					creditRaised := p.Contains(MaxDataType) || p.Contains(MaxStreamDataType) || p.Contains(MaxStreamsType)
 					for _, f := range p.GetFrames() {
 						switch ft := f.(type) {
 						case *MaxDataFrame:
@@ -143,8 +203,7 @@ func (a *FlowControlAgent) Run(conn *Connection) { // TODO: Report violation of
 							a.Logger.Printf("Number of %s is now %d\n", ft.StreamsType.String(), ft.MaximumStreams)
 						case *MaxStreamDataFrame:
 							stream := conn.Streams.Get(ft.StreamId)
-							if IsUniServer(ft.StreamId) {
-								// TODO: Report flow control error
+							if IsUniServer(ft.StreamId) { // Reported as a stream state violation
 								break
 							}
 							if stream.WriteLimit > ft.MaximumStreamData {
@@ -155,21 +214,43 @@ func (a *FlowControlAgent) Run(conn *Connection) { // TODO: Report violation of
 								delete(blockedStreams, ft.StreamId)
 							}
 							stream.WriteLimit = ft.MaximumStreamData
-							a.Logger.Printf("Stream %d write limit is now %d bytes\n", stream.WriteLimit)
+							a.Logger.Printf("Stream %d write limit is now %d bytes\n", ft.StreamId, stream.WriteLimit)
+						case *StreamDataBlockedFrame:
+							a.checkStreamsLimit(ft, ft.StreamId)
+						case *ResetStream:
+							if !a.checkStreamsLimit(ft, ft.StreamId) || IsUniClient(ft.StreamId) {
+								break
+							}
+							stream := conn.Streams.Get(ft.StreamId)
+							a.InitStreamLimits(stream, ft.StreamId)
+							if ft.FinalSize > stream.ReadLimit {
+								a.violation(ft, ft.StreamId, ERR_FLOW_CONTROL_ERROR, "final size %d exceeds the stream limit of %d bytes", ft.FinalSize, stream.ReadLimit)
+								break
+							}
+							if ft.FinalSize > stream.ReadBufferOffset {
+								if dataRead+ft.FinalSize-stream.ReadBufferOffset > a.LocalFC.MaxData {
+									a.violation(ft, ft.StreamId, ERR_FLOW_CONTROL_ERROR, "final size %d exceeds the connection limit of %d bytes", ft.FinalSize, a.LocalFC.MaxData)
+									break
+								}
+								dataRead += ft.FinalSize - stream.ReadBufferOffset
+								stream.ReadBufferOffset = ft.FinalSize
+							}
+							a.peerStreams[ft.StreamId] = IsServer(ft.StreamId)
+							if !a.DontSlideCreditWindow {
+								if dataLimitRaised, _ := a.consume(stream, ft.StreamId, ft.FinalSize, false); dataLimitRaised {
+									dataLimitsChanged = true
+								}
+							}
 						case *StreamFrame:
 							stream := conn.Streams.Get(ft.StreamId)
 
-							if IsBidiServer(ft.StreamId) && (a.LocalFC.StreamsBidi == 0 || GetMaxBidiServer(a.LocalFC.StreamsBidi) < ft.StreamId) {
-								// TODO: Report flow control violation
-								break
-							} else if IsUniServer(ft.StreamId) && (a.LocalFC.StreamsUni == 0 || GetMaxUniServer(a.LocalFC.StreamsUni) < ft.StreamId) {
-								// TODO: Report flow control violation
+							if !a.checkStreamsLimit(ft, ft.StreamId) {
 								break
 							}
 
 							a.InitStreamLimits(stream, ft.StreamId)
 							if ft.Offset+ft.Length > stream.ReadLimit {
-								// TODO: Report flow control violation
+								a.violation(ft, ft.StreamId, ERR_FLOW_CONTROL_ERROR, "data up to offset %d exceeds the stream limit of %d bytes", ft.Offset+ft.Length, stream.ReadLimit)
 								break
 							}
 							bufSpaceRequired := (ft.Offset + ft.Length) - stream.ReadBufferOffset
@@ -177,20 +258,38 @@ func (a *FlowControlAgent) Run(conn *Connection) { // TODO: Report violation of
 								break // This is a retransmit
 							}
 							if dataRead+bufSpaceRequired > a.LocalFC.MaxData {
-								// TODO: Report flow control violation
+								a.violation(ft, ft.StreamId, ERR_FLOW_CONTROL_ERROR, "%d bytes received exceed the connection limit of %d bytes", dataRead+bufSpaceRequired, a.LocalFC.MaxData)
 								break
 							}
 							dataRead += bufSpaceRequired
-							if !a.DontSlideCreditWindow {
-								a.LocalFC.MaxData += bufSpaceRequired
+							stream.ReadBufferOffset = ft.Offset + ft.Length
+							a.peerStreams[ft.StreamId] = IsServer(ft.StreamId)
+						}
+					}
+					if !a.DontSlideCreditWindow {
+						for _, f := range p.GetAll(StreamType) {
+							streamId := f.(*StreamFrame).StreamId
+							stream := conn.Streams.Get(streamId)
+							dataLimitRaised, streamLimitRaised := a.consume(stream, streamId, stream.ReadOffset, true)
+							if dataLimitRaised {
 								dataLimitsChanged = true
-
-								stream.ReadLimit += bufSpaceRequired
-								streamsDataLimits[ft.StreamId] = stream.ReadLimit
+							}
+							if streamLimitRaised {
+								streamsDataLimits[streamId] = stream.ReadLimit
 							}
 						}
+						bidi, uni := a.updateStreamsLimits()
+						bidiLimitChanged = bidiLimitChanged || bidi
+						uniLimitChanged = uniLimitChanged || uni
+					}
+					if creditRaised {
+						a.notifyCreditUpdated()
 					}
 				}
+			case i := <-outgoingPackets:
+				if p, ok := i.(Framer); ok {
+					a.limitsSent(p)
+				}
 			case args := <-a.reserveCredit:
 				if !ready {
 					a.creditsReserved <- 0
@@ -198,14 +297,18 @@ func (a *FlowControlAgent) Run(conn *Connection) { // TODO: Report violation of
 				}
 
 				// First check that the stream can be opened
-				if IsBidiClient(args.StreamId) && !bidiStreamsBlocked && (a.RemoteFC.StreamsBidi == 0 || GetMaxBidiClient(a.RemoteFC.StreamsBidi) < args.StreamId) {
-					bidiStreamsBlocked = true
-					a.SubmitFrame(QueuedFrame{&StreamsBlockedFrame{BidiStreams, a.RemoteFC.StreamsBidi}, EncryptionLevelBestAppData})
+				if IsBidiClient(args.StreamId) && args.StreamId/4 >= a.RemoteFC.StreamsBidi {
+					if !bidiStreamsBlocked {
+						bidiStreamsBlocked = true
+						a.SubmitFrame(QueuedFrame{&StreamsBlockedFrame{BidiStreams, a.RemoteFC.StreamsBidi}, EncryptionLevelBestAppData})
+					}
 					a.creditsReserved <- 0
 					break
-				} else if IsUniClient(args.StreamId) && !uniStreamsBlocked && (a.RemoteFC.StreamsUni == 0 || GetMaxUniClient(a.RemoteFC.StreamsUni) < args.StreamId) {
-					uniStreamsBlocked = false
-					a.SubmitFrame(QueuedFrame{&StreamsBlockedFrame{UniStreams, a.RemoteFC.StreamsUni}, EncryptionLevelBestAppData})
+				} else if IsUniClient(args.StreamId) && args.StreamId/4 >= a.RemoteFC.StreamsUni {
+					if !uniStreamsBlocked {
+						uniStreamsBlocked = true
+						a.SubmitFrame(QueuedFrame{&StreamsBlockedFrame{UniStreams, a.RemoteFC.StreamsUni}, EncryptionLevelBestAppData})
+					}
 					a.creditsReserved <- 0
 					break
 				}
@@ -228,14 +331,14 @@ func (a *FlowControlAgent) Run(conn *Connection) { // TODO: Report violation of
 					}
 				}
 
-				if !blockedStreams[args.StreamId] && (stream.WriteReserved >= stream.WriteLimit || (creditReserved < args.Credit)) {
+				if !blockedStreams[args.StreamId] && (stream.WriteReserved >= stream.WriteLimit || stream.WriteReserved+args.Credit-creditReserved > stream.WriteLimit) {
 					blockedStreams[args.StreamId] = true
 					a.SubmitFrame(QueuedFrame{&StreamDataBlockedFrame{args.StreamId, stream.WriteLimit}, EncryptionLevelBestAppData})
 				}
 
-				if !dataBlocked && dataReserved >= a.LocalFC.MaxData {
+				if !dataBlocked && (dataReserved >= a.RemoteFC.MaxData || dataReserved+args.Credit-creditReserved > a.RemoteFC.MaxData) {
 					dataBlocked = true
-					a.SubmitFrame(QueuedFrame{&DataBlockedFrame{stream.WriteLimit}, EncryptionLevelBestAppData})
+					a.SubmitFrame(QueuedFrame{&DataBlockedFrame{a.RemoteFC.MaxData}, EncryptionLevelBestAppData})
 				}
 
 				a.creditsReserved <- creditReserved
@@ -253,17 +356,13 @@ func (a *FlowControlAgent) Run(conn *Connection) { // TODO: Report violation of
 					allFrames = append(allFrames, &MaxStreamDataFrame{streamId, limit})
 					delete(streamsDataLimits, streamId)
 				}
-				if dataBlocked {
-					allFrames = append(allFrames, &DataBlockedFrame{a.RemoteFC.MaxData})
-				}
-				if bidiStreamsBlocked {
-					allFrames = append(allFrames, &StreamsBlockedFrame{BidiStreams, a.RemoteFC.StreamsBidi})
+				if bidiLimitChanged {
+					allFrames = append(allFrames, &MaxStreamsFrame{BidiStreams, a.LocalFC.StreamsBidi})
+					bidiLimitChanged = false
 				}
-				if uniStreamsBlocked {
-					allFrames = append(allFrames, &StreamsBlockedFrame{UniStreams, a.RemoteFC.StreamsUni})
-				}
-				for streamId, _ := range blockedStreams {
-					allFrames = append(allFrames, &StreamDataBlockedFrame{streamId, conn.Streams.Get(streamId).WriteLimit})
+				if uniLimitChanged {
+					allFrames = append(allFrames, &MaxStreamsFrame{UniStreams, a.LocalFC.StreamsUni})
+					uniLimitChanged = false
 				}
 
 				var frames []Frame
@@ -309,6 +408,131 @@ func (a *FlowControlAgent) Run(conn *Connection) { // TODO: Report violation of
 	}()
 }
 
+// Accounts the data consumed on the stream up to the given offset and moves the receive windows forward. It returns
+// whether the limits of the connection and of the stream were raised. The window of the stream is left untouched when
+// updateStream is false, e.g. when the stream was reset.
+func (a *FlowControlAgent) consume(stream *Stream, streamId uint64, offset uint64, updateStream bool) (bool, bool) {
+	if offset <= a.streamsConsumed[streamId] {
+		return false, false
+	}
+	a.dataConsumed += offset - a.streamsConsumed[streamId]
+	a.streamsConsumed[streamId] = offset
+
+	now := time.Now()
+	if a.connectionWindow == nil {
+		a.connectionWindow = newReceiveWindow(a.LocalFC.MaxData)
+	}
+	var streamLimitRaised bool
+	if updateStream && stream.ReadLimit != math.MaxUint64 {
+		w, ok := a.streamWindows[streamId]
+		if !ok {
+			w = newReceiveWindow(stream.ReadLimit)
+			a.streamWindows[streamId] = w
+		}
+		streamLimitRaised = a.moveWindow(w, offset, &stream.ReadLimit, now)
+		if a.connectionWindow.size < w.size*3/2 { // The connection window must allow several streams to progress
+			a.connectionWindow.size = w.size * 3 / 2
+		}
+	}
+	dataLimitRaised := a.moveWindow(a.connectionWindow, a.dataConsumed, &a.LocalFC.MaxData, now)
+	return dataLimitRaised, streamLimitRaised
+}
+
+// Moves the window forward when enough of it has been consumed and raises the given limit accordingly.
+func (a *FlowControlAgent) moveWindow(w *receiveWindow, consumed uint64, limit *uint64, now time.Time) bool {
+	if *limit > consumed && float64(*limit-consumed) > float64(w.size)*(1-a.WindowUpdateThreshold) {
+		return false
+	}
+	if rtt := time.Duration(a.conn.SmoothedRTT) * time.Microsecond; a.AutoTuneWindows && rtt > 0 {
+		maxWindow := a.MaxReceiveWindow
+		if maxWindow == 0 {
+			maxWindow = DefaultMaxReceiveWindow
+		}
+		fraction := float64(consumed-w.epochOffset) / float64(w.size)
+		if now.Sub(w.epochStart) < time.Duration(4*fraction*float64(rtt)) && w.size < maxWindow {
+			w.size = min(2*w.size, maxWindow)
+			a.Logger.Printf("Receive window grown to %d bytes\n", w.size)
+		}
+	}
+	w.epochStart, w.epochOffset = now, consumed
+	if consumed+w.size <= *limit {
+		return false
+	}
+	*limit = consumed + w.size
+	return true
+}
+
+// Raises the number of streams the peer can open as it completes them, i.e. as the receiving part of its streams reach
+// a terminal state. It returns whether the limits of bidirectional and unidirectional streams were raised.
+func (a *FlowControlAgent) updateStreamsLimits() (bool, bool) {
+	completed := make(map[StreamsType]uint64)
+	for streamId, isPeerStream := range a.peerStreams {
+		if isPeerStream && a.conn.Streams.Get(streamId).RecvState >= RecvStateDataRecvd {
+			completed[StreamsType(IsUni(streamId))]++
+		}
+	}
+	raise := func(limit *uint64, initial uint64, completed uint64) bool {
+		step := uint64(a.WindowUpdateThreshold * float64(initial))
+		if step == 0 {
+			step = 1
+		}
+		if initial+completed < *limit+step {
+			return false
+		}
+		*limit = initial + completed
+		return true
+	}
+	tp := a.conn.TLSTPHandler.QuicTransportParameters
+	return raise(&a.LocalFC.StreamsBidi, tp.MaxBidiStreams, completed[BidiStreams]), raise(&a.LocalFC.StreamsUni, tp.MaxUniStreams, completed[UniStreams])
+}
+
+// Raises our limits according to the MAX_* frames sent, so that the peer is checked against the limits it may have
+// received.
+func (a *FlowControlAgent) limitsSent(p Framer) {
+	for _, f := range p.GetFrames() {
+		switch ft := f.(type) {
+		case *MaxDataFrame:
+			a.LocalFC.MaxData = max(a.LocalFC.MaxData, ft.MaximumData)
+		case *MaxStreamDataFrame:
+			stream := a.conn.Streams.Get(ft.StreamId)
+			a.InitStreamLimits(stream, ft.StreamId)
+			stream.ReadLimit = max(stream.ReadLimit, ft.MaximumStreamData)
+		case *MaxStreamsFrame:
+			if ft.StreamsType == BidiStreams {
+				a.LocalFC.StreamsBidi = max(a.LocalFC.StreamsBidi, ft.MaximumStreams)
+			} else {
+				a.LocalFC.StreamsUni = max(a.LocalFC.StreamsUni, ft.MaximumStreams)
+			}
+		}
+	}
+}
+
+// Returns whether the stream referenced by the frame is within the number of streams the peer can open.
+func (a *FlowControlAgent) checkStreamsLimit(f Frame, streamId uint64) bool {
+	if !IsServer(streamId) {
+		return true
+	}
+	limit := a.LocalFC.StreamsBidi
+	if IsUni(streamId) {
+		limit = a.LocalFC.StreamsUni
+	}
+	if streamId/4 >= limit {
+		a.violation(f, streamId, ERR_STREAM_LIMIT_ERROR, "stream %d exceeds the limit of %d %s", streamId, limit, StreamsType(IsUni(streamId)).String())
+		return false
+	}
+	return true
+}
+
+func (a *FlowControlAgent) violation(f Frame, streamId uint64, errorCode uint64, format string, args ...interface{}) {
+	v := FlowControlViolation{streamId, f.FrameType(), errorCode, fmt.Sprintf(format, args...)}
+	a.Logger.Printf("Peer violated our limits: %s\n", v.Error())
+	a.conn.FlowControlViolations.Submit(v)
+	if a.CloseOnViolation && !a.closing {
+		a.closing = true
+		a.conn.CloseConnection(true, errorCode, v.Reason)
+	}
+}
+
 // TODO: This is a common pattern in FrameProducingAgents. Should probably move this method to that type.
 func (a *FlowControlAgent) SubmitFrame(frame QueuedFrame) {
 	if a.DisableFrameSending {
@@ -319,6 +543,21 @@ func (a *FlowControlAgent) SubmitFrame(frame QueuedFrame) {
 	}
 }
 
+// Returns a channel that is closed as soon as the peer raises one of its limits, i.e. when a reservation that failed may
+// now succeed.
+func (a *FlowControlAgent) CreditUpdated() <-chan struct{} {
+	a.creditLock.Lock()
+	defer a.creditLock.Unlock()
+	return a.creditUpdated
+}
+
+func (a *FlowControlAgent) notifyCreditUpdated() {
+	a.creditLock.Lock()
+	defer a.creditLock.Unlock()
+	close(a.creditUpdated)
+	a.creditUpdated = make(chan struct{})
+}
+
 func (a *FlowControlAgent) ReserveCredit(streamId uint64, amount uint64) uint64 {
 	select {
 	case a.reserveCredit <- reserveCreditArgs{streamId, amount, false}:
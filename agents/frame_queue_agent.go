@@ -15,6 +15,8 @@ var FramePriority = map[FrameType]int{
 	AckECNType:             5,
 	CryptoType:             6,
 	PingType:               7,
+	GreaseType:             7,
+	ImmediateAckType:       7,
 	NewConnectionIdType:    8,
 	RetireConnectionIdType: 9,
 	PathChallengeType:      10,
@@ -29,8 +31,10 @@ var FramePriority = map[FrameType]int{
 	StreamsBlockedType:     19,
 	StreamsBlockedType + 1: 20,
 	NewTokenType:           21,
+	AckFrequencyType:       21,
 	StreamType:             22,
-	PaddingFrameType:       23,
+	DatagramType:           23,
+	PaddingFrameType:       24,
 }
 
 type item struct {
@@ -44,9 +44,9 @@ func (a *HTTP09Agent) Run(conn *Connection) {
 }
 
 func (a *HTTP09Agent) SendRequest(path, method, authority string, headers map[string]string) chan HTTPResponse {
-	streamID :=  a.conn.CurrentStreamID
+	streamID := a.conn.NewBidiStreamID()
 	a.conn.SendHTTP09GETRequest(path, streamID)
-	responseStream := a.conn.Streams.Get(a.conn.CurrentStreamID).ReadChan.RegisterNewChan(1000)
+	responseStream := a.conn.Streams.Get(streamID).ReadChan.RegisterNewChan(1000)
 	responseChan := make(chan HTTPResponse, 1)
 
 	go func() {
@@ -60,7 +60,6 @@ func (a *HTTP09Agent) SendRequest(path, method, authority string, headers map[st
 		a.httpResponseReceived.Submit(response)
 	}()
 
-	a.conn.CurrentStreamID += 4
 	return responseChan
 }
 
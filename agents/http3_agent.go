@@ -2,68 +2,110 @@ package agents
 
 import (
 	"bytes"
+	"fmt"
+	"io"
 	"math"
 
 	. "github.com/PROGNOSISTool/adapter-quic"
 	"github.com/PROGNOSISTool/adapter-quic/http3"
 )
 
-type HTTP3Response struct {
-	HTTP09Response
-	headers  []HTTPHeader
-
-	fin              bool
-	headersRemaining int
-	totalProcessed   uint64
-	totalReceived    uint64
-	responseChan	 chan HTTPResponse
+type HTTP3FrameReceived struct {
+	StreamID uint64
+	Frame    http3.HTTPFrame
 }
 
-func (r HTTP3Response) Complete() bool {
-	return r.fin && r.totalReceived > 0 && r.totalProcessed == r.totalReceived && r.headersRemaining == 0
+type requestSent struct {
+	streamID uint64
+	request  *HTTP3Request
+	response *HTTP3Response
 }
 
-func (r HTTP3Response) Headers() []HTTPHeader { return r.headers }
-
-type HTTP3FrameReceived struct {
-	StreamID uint64
-	Frame    http3.HTTPFrame
+type datagramSent struct {
+	streamID uint64
+	payload  []byte
+	err      chan error
 }
 
 type streamData struct {
 	streamID uint64
 	data     []byte
+	fin      bool // All the data of the stream was received
 }
 
 // The HTTP3 Agent is TODO
 type HTTP3Agent struct {
 	BaseAgent
-	conn                 *Connection
-	DisableQPACKStreams  bool
-	QPACK                QPACKAgent
-	QPACKEncoderOpts     uint32
-	httpResponseReceived Broadcaster //type: HTTP3Response
-	FrameReceived        Broadcaster //type: HTTP3FrameReceived
-	ReceivedSettings     *http3.SETTINGS
-	streamData           chan streamData
-	streamDataBuffer     map[uint64]*bytes.Buffer
-	responseBuffer       map[uint64]*HTTP3Response
-	controlStreamID      uint64
-	peerControlStreamID  uint64
+	conn                      *Connection
+	DisableQPACKStreams       bool
+	QPACK                     QPACKAgent
+	QPACKEncoderOpts          uint32
+	ControlStreamID           uint64          // Allocated by the connection when zero, i.e. 2 unless other streams are open
+	QPACKEncoderStreamID      uint64          // Allocated by the connection when zero, 6 after the control stream
+	QPACKDecoderStreamID      uint64          // Allocated by the connection when zero, 10 after the encoder stream
+	QPACKMaxTableCapacity     *uint64         // Advertised in SETTINGS_QPACK_MAX_TABLE_CAPACITY, 1024 when nil
+	QPACKBlockedStreams       *uint64         // Advertised in SETTINGS_QPACK_BLOCKED_STREAMS, 100 when nil
+	QPACKEncoderTableCapacity uint64          // The capacity used by our encoder within the limit of the peer, 1024 by default
+	MaxFieldSectionSize       uint64          // Advertised in SETTINGS_MAX_FIELD_SECTION_SIZE when not zero
+	AdditionalSettings        []http3.Setting // Sent after the other settings, e.g. to exercise unknown or reserved identifiers
+	MaxPushes                 uint64          // Allows the peer to push this number of responses when not zero
+	EnableDatagrams           bool            // Sends SETTINGS_H3_DATAGRAM and exchanges HTTP Datagrams using the Datagrams agent
+	Datagrams                 DatagramAgent
+	httpResponseReceived      Broadcaster //type: HTTP3Response
+	FrameReceived             Broadcaster //type: HTTP3FrameReceived
+	PushPromised              Broadcaster //type: HTTP3Push
+	PushReceived              Broadcaster //type: HTTP3Push
+	GoAwayReceived            Broadcaster //type: uint64
+	DatagramReceived          Broadcaster //type: HTTP3Datagram
+	CapsuleReceived           Broadcaster //type: HTTP3Capsule
+	ReceivedSettings          *http3.SETTINGS
+	requests                  chan requestSent
+	pendingRequests           []requestSent // The extended CONNECT requests waiting for the SETTINGS frame of the peer
+	datagrams                 chan datagramSent
+	streamData                chan streamData
+	streamDataBuffer          map[uint64]*bytes.Buffer
+	responseBuffer            map[uint64]*HTTP3Response
+	requestBuffer             map[uint64]*HTTP3Request
+	capsuleStreams            map[uint64]*bytes.Buffer // The capsules being received on the streams using the Capsule Protocol
+	headerSections            map[uint64][]*HTTP3Push  // The field sections being decoded on each stream, nil for HEADERS frames
+	pushes                    map[uint64]*HTTP3Push
+	pushStreams               map[uint64]*HTTP3Push
+	maxPushID                 uint64
+	maxPushIDSent             bool
+	allowPushes               chan uint64
+	cancelPush                chan uint64
+	goAwayID                  uint64 // The stream ID of the last GOAWAY frame received, HTTPNoStream when none was
+	goAwaySent                bool
+	goAwayPushID              uint64
+	goAway                    chan uint64
+	closing                   bool
+	peerControlStreamID       uint64
 }
 
 const (
 	HTTPNoStream uint64 = math.MaxUint64
+	http3BodyChunkSize  = 16384
 )
 
 func (a *HTTP3Agent) Run(conn *Connection) {
 	a.Init("HTTP3Agent", conn.OriginalDestinationCID)
 	a.conn = conn
-	a.QPACK = QPACKAgent{EncoderStreamID: 6, DecoderStreamID: 10, DisableStreams: a.DisableQPACKStreams}
+	a.ControlStreamID = conn.NewUniStreamID(a.ControlStreamID)
+	if a.DisableQPACKStreams {
+		a.QPACKEncoderTableCapacity = 0
+	} else if a.QPACKEncoderTableCapacity == 0 {
+		a.QPACKEncoderTableCapacity = 1024
+	}
+	a.QPACK = QPACKAgent{EncoderStreamID: a.QPACKEncoderStreamID, DecoderStreamID: a.QPACKDecoderStreamID, DisableStreams: a.DisableQPACKStreams, MaxTableCapacity: a.QPACKMaxTableCapacity, MaxBlockedStreams: a.QPACKBlockedStreams}
 	a.QPACK.Run(conn)
 
 	a.httpResponseReceived = NewBroadcaster(1000)
 	a.FrameReceived = NewBroadcaster(1000)
+	a.PushPromised = NewBroadcaster(1000)
+	a.PushReceived = NewBroadcaster(1000)
+	a.GoAwayReceived = NewBroadcaster(1000)
+	a.DatagramReceived = NewBroadcaster(1000)
+	a.CapsuleReceived = NewBroadcaster(1000)
 
 	frameReceived := a.FrameReceived.RegisterNewChan(1000)
 	incomingPackets := conn.IncomingPackets.RegisterNewChan(1000)
@@ -71,19 +113,34 @@ func (a *HTTP3Agent) Run(conn *Connection) {
 	encodedHeaders := a.QPACK.EncodedHeaders.RegisterNewChan(1000)
 	decodedHeaders := a.QPACK.DecodedHeaders.RegisterNewChan(1000)
 
-	a.controlStreamID = uint64(2)
 	a.peerControlStreamID = HTTPNoStream
 	peerControlStream := make(chan interface{}, 1000)
 	peerControlStreamBuffer := new(bytes.Buffer)
-	a.conn.Streams.Send(a.controlStreamID, []byte{http3.StreamTypeControl}, false)
-	a.sendFrameOnStream(http3.NewSETTINGS(nil), a.controlStreamID, false)
+	var datagramReceived chan interface{}
+	if a.EnableDatagrams {
+		a.Datagrams.Run(conn)
+		datagramReceived = a.Datagrams.DatagramReceived.RegisterNewChan(1000)
+	}
+	a.conn.Streams.Send(a.ControlStreamID, []byte{http3.StreamTypeControl}, false)
+	a.sendFrameOnStream(http3.NewSETTINGS(a.settings()), a.ControlStreamID, false)
 
+	a.requests = make(chan requestSent)
+	a.datagrams = make(chan datagramSent)
 	a.streamData = make(chan streamData)
 	a.streamDataBuffer = make(map[uint64]*bytes.Buffer)
 	a.responseBuffer = make(map[uint64]*HTTP3Response)
-
-	settingsHeaderTableSize := uint64(4096)
-	settingsQPACKBlockedStreams := uint64(100)
+	a.requestBuffer = make(map[uint64]*HTTP3Request)
+	a.capsuleStreams = make(map[uint64]*bytes.Buffer)
+	a.headerSections = make(map[uint64][]*HTTP3Push)
+	a.pushes = make(map[uint64]*HTTP3Push)
+	a.pushStreams = make(map[uint64]*HTTP3Push)
+	a.allowPushes = make(chan uint64, 10)
+	a.cancelPush = make(chan uint64, 10)
+	a.goAwayID = HTTPNoStream
+	a.goAway = make(chan uint64, 10)
+	if a.MaxPushes > 0 {
+		a.sendMaxPushID(a.MaxPushes - 1)
+	}
 
 	go func() {
 		defer a.Logger.Println("Agent terminated")
@@ -102,7 +159,7 @@ func (a *HTTP3Agent) Run(conn *Connection) {
 								a.Logger.Printf("Error when parsing stream type: %s\n", err.Error())
 							} else if httpStreamType.Value == http3.StreamTypeControl {
 								if a.peerControlStreamID != HTTPNoStream {
-									a.Logger.Printf("Peer attempted to open another control stream on stream %d\n", s.StreamId)
+									a.closeConnection(http3.H3_STREAM_CREATION_ERROR, "peer opened a second control stream on stream %d", s.StreamId)
 									continue
 								}
 								a.peerControlStreamID = s.StreamId
@@ -111,24 +168,60 @@ func (a *HTTP3Agent) Run(conn *Connection) {
 								}
 								conn.Streams.Get(s.StreamId).ReadChan.Register(peerControlStream)
 								a.Logger.Printf("Peer opened control stream on stream %d\n", s.StreamId)
+							} else if httpStreamType.Value == http3.StreamTypePush {
+								if _, ok := a.pushStreams[s.StreamId]; !ok {
+									a.pushStreamOpened(s.StreamId, stream, httpStreamType.Length)
+								}
 							} else {
 								a.Logger.Printf("Unknown stream type %d, ignoring it\n", httpStreamType.Value)
 							}
 						}
 					}
+					for _, f := range p.(Framer).GetAll(ResetStreamType) {
+						if f.(*ResetStream).StreamId == a.peerControlStreamID {
+							a.closeConnection(http3.H3_CLOSED_CRITICAL_STREAM, "control stream was reset")
+						}
+					}
+				}
+			case i, ok := <-peerControlStream:
+				if !ok {
+					a.closeConnection(http3.H3_CLOSED_CRITICAL_STREAM, "control stream was closed")
+					peerControlStream = nil
+					continue
 				}
-			case i := <-peerControlStream:
 				peerControlStreamBuffer.Write(i.([]byte))
 				a.attemptDecoding(a.peerControlStreamID, peerControlStreamBuffer)
+			case r := <-a.requests:
+				// An extended CONNECT request can only be checked once the SETTINGS frame of the peer is received
+				if r.request.Protocol != "" && a.ReceivedSettings == nil {
+					a.Logger.Printf("Waiting for the SETTINGS frame of the peer to send an extended CONNECT request on stream %d\n", r.streamID)
+					a.pendingRequests = append(a.pendingRequests, r)
+					continue
+				}
+				a.requestSent(r.streamID, r.request, r.response)
+			case d := <-a.datagrams:
+				d.err <- a.sendDatagram(d.streamID, d.payload)
 			case sd := <-a.streamData:
 				streamBuffer := a.streamDataBuffer[sd.streamID]
 				streamBuffer.Write(sd.data)
 				a.attemptDecoding(sd.streamID, streamBuffer)
+				if response, ok := a.responseBuffer[sd.streamID]; ok {
+					response.totalReceived += uint64(len(sd.data))
+					if sd.fin {
+						response.fin = true
+						a.checkResponse(response)
+						a.drain()
+					}
+				}
 			case i := <-frameReceived:
 				fr := i.(HTTP3FrameReceived)
 				a.Logger.Printf("Received a %s frame on stream %d\n", fr.Frame.Name(), fr.StreamID)
+				if !a.frameAllowed(fr) {
+					continue
+				}
 				switch f := fr.Frame.(type) {
 				case *http3.HEADERS:
+					a.headerSections[fr.StreamID] = append(a.headerSections[fr.StreamID], nil)
 					a.QPACK.DecodeHeaders <- EncodedHeaders{fr.StreamID, f.HeaderBlock}
 					var response *HTTP3Response
 					var ok bool
@@ -138,6 +231,9 @@ func (a *HTTP3Agent) Run(conn *Connection) {
 					}
 					response.headersRemaining++
 					response.totalProcessed += f.WireLength()
+					if !response.frameReceived(true) {
+						a.closeConnection(http3.H3_FRAME_UNEXPECTED, "invalid sequence of frames on stream %d", fr.StreamID)
+					}
 				case *http3.DATA:
 					var response *HTTP3Response
 					var ok bool
@@ -145,30 +241,37 @@ func (a *HTTP3Agent) Run(conn *Connection) {
 						a.Logger.Printf("%s frame for stream %d does not match any request\n", f.Name(), fr.StreamID)
 						continue
 					}
-					response.body = append(a.responseBuffer[fr.StreamID].body, f.Payload...)
+					if capsules, ok := a.capsuleStreams[fr.StreamID]; ok {
+						capsules.Write(f.Payload)
+						a.readCapsules(fr.StreamID, capsules)
+					} else {
+						response.body = append(a.responseBuffer[fr.StreamID].body, f.Payload...)
+					}
 					response.totalProcessed += f.WireLength()
+					if !response.frameReceived(false) {
+						a.closeConnection(http3.H3_FRAME_UNEXPECTED, "invalid sequence of frames on stream %d", fr.StreamID)
+					}
 					a.checkResponse(response)
+					a.drain()
 				case *http3.SETTINGS:
-					if a.ReceivedSettings != nil {
-						a.Logger.Printf("Received a SETTINGS frame for the second time!\n")
-						continue
-					}
 					a.ReceivedSettings = f
-					for _, s := range f.Settings {
-						if s.Identifier.Value == http3.SETTINGS_HEADER_TABLE_SIZE {
-							settingsHeaderTableSize = s.Value.Value
-						} else if s.Identifier.Value == http3.SETTINGS_QPACK_BLOCKED_STREAMS {
-							settingsQPACKBlockedStreams = s.Value.Value
-						}
+					a.settingsReceived(f)
+					for _, r := range a.pendingRequests {
+						a.requestSent(r.streamID, r.request, r.response)
 					}
-					dynamicTableSize := uint(1024)
-					if a.DisableQPACKStreams {
-						dynamicTableSize = 0
+					a.pendingRequests = nil
+				case *http3.PUSH_PROMISE:
+					a.pushPromiseReceived(fr.StreamID, f)
+					if response, ok := a.responseBuffer[fr.StreamID]; ok {
+						response.totalProcessed += f.WireLength()
 					}
-					if dynamicTableSize > uint(settingsHeaderTableSize) {
-						dynamicTableSize = uint(settingsHeaderTableSize)
+				case *http3.CANCEL_PUSH:
+					push := a.push(f.PushID.Value)
+					if a.checkPushID(push, "CANCEL_PUSH frame") {
+						push.CancelledByPeer = true
 					}
-					a.QPACK.InitEncoder(uint(settingsHeaderTableSize), dynamicTableSize, uint(settingsQPACKBlockedStreams), a.QPACKEncoderOpts)
+				case *http3.GOAWAY:
+					a.goAwayReceived(f.StreamID.Value)
 				default:
 					if response, ok := a.responseBuffer[fr.StreamID]; ok {
 						response.totalProcessed += f.WireLength()
@@ -177,6 +280,13 @@ func (a *HTTP3Agent) Run(conn *Connection) {
 				}
 			case i := <-decodedHeaders:
 				dHdrs := i.(DecodedHeaders)
+				if sections := a.headerSections[dHdrs.StreamID]; len(sections) > 0 {
+					a.headerSections[dHdrs.StreamID] = sections[1:]
+					if sections[0] != nil {
+						a.pushPromiseDecoded(sections[0], dHdrs.Headers)
+						continue
+					}
+				}
 				var response *HTTP3Response
 				var ok bool
 				if response, ok = a.responseBuffer[dHdrs.StreamID]; !ok {
@@ -184,18 +294,144 @@ func (a *HTTP3Agent) Run(conn *Connection) {
 					continue
 				}
 				response.headersRemaining--
-				response.headers = append(a.responseBuffer[dHdrs.StreamID].headers, dHdrs.Headers...)
+				if size := fieldSectionSize(dHdrs.Headers); a.MaxFieldSectionSize > 0 && size > a.MaxFieldSectionSize {
+					response.addError("field section of %d bytes exceeds the advertised maximum of %d bytes", size, a.MaxFieldSectionSize)
+				}
+				response.headersDecoded(dHdrs.Headers)
 				a.checkResponse(response)
+				a.drain()
 			case i := <-encodedHeaders:
 				eHdrs := i.(EncodedHeaders)
-				a.sendFrameOnStream(http3.NewHEADERS(eHdrs.Headers), eHdrs.StreamID, true)
+				request, ok := a.requestBuffer[eHdrs.StreamID]
+				if !ok { // The trailers of the request were encoded
+					a.sendFrameOnStream(http3.NewHEADERS(eHdrs.Headers), eHdrs.StreamID, true)
+					a.Logger.Printf("Sent a %d-byte long block of trailers on stream %d\n", len(eHdrs.Headers), eHdrs.StreamID)
+					continue
+				}
+				delete(a.requestBuffer, eHdrs.StreamID)
+				// The stream of a CONNECT request stays open to carry the data of the tunnel
+				a.sendFrameOnStream(http3.NewHEADERS(eHdrs.Headers), eHdrs.StreamID, request.Body == nil && len(request.Trailers) == 0 && request.Method != "CONNECT")
 				a.Logger.Printf("Sent a %d-byte long block of headers on stream %d\n", len(eHdrs.Headers), eHdrs.StreamID)
+				if request.Body != nil || len(request.Trailers) > 0 {
+					go a.sendBody(eHdrs.StreamID, request)
+				}
+			case maxPushID := <-a.allowPushes:
+				a.sendMaxPushID(maxPushID)
+			case pushID := <-a.cancelPush:
+				a.sendCancelPush(pushID)
+			case pushID := <-a.goAway:
+				a.sendGoAway(pushID)
+			case i := <-datagramReceived:
+				a.datagramReceived(i.([]byte))
 			case <-a.close:
+				for _, r := range a.pendingRequests {
+					a.refuse(r.response, "the agent is closed")
+				}
 				return
 			}
 		}
 	}()
 }
+// Returns the settings sent in our SETTINGS frame.
+func (a *HTTP3Agent) settings() []http3.Setting {
+	settings := []http3.Setting{
+		http3.NewSetting(http3.SETTINGS_QPACK_MAX_TABLE_CAPACITY, a.QPACK.maxTableCapacity),
+		http3.NewSetting(http3.SETTINGS_QPACK_BLOCKED_STREAMS, a.QPACK.maxBlockedStreams),
+	}
+	if a.MaxFieldSectionSize > 0 {
+		settings = append(settings, http3.NewSetting(http3.SETTINGS_MAX_FIELD_SECTION_SIZE, a.MaxFieldSectionSize))
+	}
+	if a.EnableDatagrams {
+		settings = append(settings, http3.NewSetting(http3.SETTINGS_H3_DATAGRAM, 1))
+	}
+	return append(settings, a.AdditionalSettings...)
+}
+// Validates the SETTINGS frame of the peer and configures the encoder accordingly. The settings omitted take their
+// default values, which disable the dynamic table of QPACK, see RFC 9204 Section 5.
+func (a *HTTP3Agent) settingsReceived(f *http3.SETTINGS) {
+	seen := make(map[uint64]bool)
+	for _, s := range f.Settings {
+		identifier, value := s.Identifier.Value, s.Value.Value
+		if seen[identifier] {
+			a.closeConnection(http3.H3_SETTINGS_ERROR, "setting %#x sent twice", identifier)
+			return
+		} else if http3.IsHTTP2Setting(identifier) {
+			a.closeConnection(http3.H3_SETTINGS_ERROR, "reserved setting %#x sent", identifier)
+			return
+		} else if (identifier == http3.SETTINGS_ENABLE_CONNECT_PROTOCOL || identifier == http3.SETTINGS_H3_DATAGRAM) && value > 1 {
+			a.closeConnection(http3.H3_SETTINGS_ERROR, "invalid value %d for setting %#x", value, identifier)
+			return
+		}
+		seen[identifier] = true
+	}
+	if v, _ := f.Get(http3.SETTINGS_H3_DATAGRAM); v == 1 && (a.conn.TLSTPHandler.ReceivedParameters == nil || a.conn.TLSTPHandler.ReceivedParameters.MaxDatagramFrameSize == 0) {
+		a.closeConnection(http3.H3_SETTINGS_ERROR, "SETTINGS_H3_DATAGRAM sent without the max_datagram_frame_size transport parameter")
+		return
+	}
+	maxTableCapacity, _ := f.Get(http3.SETTINGS_QPACK_MAX_TABLE_CAPACITY)
+	blockedStreams, _ := f.Get(http3.SETTINGS_QPACK_BLOCKED_STREAMS)
+	a.QPACK.InitEncoder(maxTableCapacity, a.QPACKEncoderTableCapacity, blockedStreams, a.QPACKEncoderOpts)
+}
+// Returns the size of the largest field section of the request and the maximum size allowed by the peer.
+func (a *HTTP3Agent) requestSize(request *HTTP3Request) (uint64, uint64) {
+	limit := uint64(math.MaxUint64)
+	if a.ReceivedSettings != nil {
+		if v, ok := a.ReceivedSettings.Get(http3.SETTINGS_MAX_FIELD_SECTION_SIZE); ok {
+			limit = v
+		}
+	}
+	size := fieldSectionSize(request.fields())
+	if trailersSize := fieldSectionSize(request.Trailers); trailersSize > size {
+		size = trailersSize
+	}
+	return size, limit
+}
+// Returns the size of a field section as defined in RFC 9114 Section 4.2.2.
+func fieldSectionSize(fields []HTTPHeader) uint64 {
+	var size uint64
+	for _, f := range fields {
+		size += uint64(len(f.Name) + len(f.Value) + 32)
+	}
+	return size
+}
+// Closes the connection with the given HTTP/3 error code, unless it is already being closed.
+func (a *HTTP3Agent) closeConnection(errorCode uint64, format string, args ...interface{}) {
+	if a.closing {
+		return
+	}
+	a.closing = true
+	reason := fmt.Sprintf(format, args...)
+	a.Logger.Printf("Closing the connection with %s: %s\n", http3.ErrorCodeName(errorCode), reason)
+	a.conn.CloseConnection(false, errorCode, reason)
+}
+// Returns whether the frame can be received on its stream, and closes the connection with the appropriate error
+// otherwise, see RFC 9114 Section 7.2 and RFC 9218 Section 7.1.
+func (a *HTTP3Agent) frameAllowed(fr HTTP3FrameReceived) bool {
+	frameType := fr.Frame.FrameType()
+	if fr.StreamID != a.peerControlStreamID {
+		_, pushStream := a.pushStreams[fr.StreamID]
+		if !http3.AllowedOnRequestStream(frameType, pushStream) {
+			a.closeConnection(http3.H3_FRAME_UNEXPECTED, "%s frame received on stream %d", fr.Frame.Name(), fr.StreamID)
+			return false
+		}
+		return true
+	}
+	if a.ReceivedSettings == nil && frameType != http3.FrameTypeSETTINGS {
+		a.closeConnection(http3.H3_MISSING_SETTINGS, "first frame of the control stream is a %s frame", fr.Frame.Name())
+		return false
+	}
+	switch {
+	case frameType == http3.FrameTypeSETTINGS && a.ReceivedSettings != nil:
+		a.closeConnection(http3.H3_FRAME_UNEXPECTED, "second SETTINGS frame received")
+	case frameType == http3.FrameTypeMAX_PUSH_ID, frameType == http3.FrameTypePRIORITY_UPDATE_REQUEST, frameType == http3.FrameTypePRIORITY_UPDATE_PUSH:
+		a.closeConnection(http3.H3_FRAME_UNEXPECTED, "%s frame received by a client", fr.Frame.Name())
+	case !http3.AllowedOnControlStream(frameType):
+		a.closeConnection(http3.H3_FRAME_UNEXPECTED, "%s frame received on the control stream", fr.Frame.Name())
+	default:
+		return true
+	}
+	return false
+}
 func (a *HTTP3Agent) sendFrameOnStream(frame http3.HTTPFrame, streamID uint64, fin bool) {
 	buf := new(bytes.Buffer)
 	frame.WriteTo(buf)
@@ -217,10 +453,70 @@ func (a *HTTP3Agent) attemptDecoding(streamID uint64, buffer *bytes.Buffer) {
 		}
 	}
 }
+// Sends the body of the request in DATA frames, followed by its trailers, and closes the stream.
+func (a *HTTP3Agent) sendBody(streamID uint64, request *HTTP3Request) {
+	if request.Body != nil {
+		buf := make([]byte, http3BodyChunkSize)
+		for {
+			n, err := request.Body.Read(buf)
+			if n > 0 {
+				a.sendFrameOnStream(http3.NewDATA(append([]byte{}, buf[:n]...)), streamID, false)
+			}
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				a.Logger.Printf("Error when reading the body of the request on stream %d: %s\n", streamID, err.Error())
+				break
+			}
+		}
+	}
+	if len(request.Trailers) > 0 {
+		a.QPACK.EncodeHeaders <- DecodedHeaders{streamID, request.Trailers}
+	} else {
+		a.conn.Streams.Send(streamID, nil, true)
+	}
+}
+// Pipes the data received on the stream of the response to the agent, starting with the data already received. The
+// response itself is only updated by the agent, which also learns from this goroutine when the stream is finished.
+func (a *HTTP3Agent) readResponse(stream *Stream, streamID uint64, response *HTTP3Response, initialData []byte) {
+	streamChan := stream.ReadChan.RegisterNewChan(1000)
+	received := response.totalReceived
+	dataReceived := func(data []byte) {
+		received += uint64(len(data))
+		a.streamData <- streamData{streamID, data, stream.ReadClosed || received == stream.ReadCloseOffset}
+	}
+	go func() {
+		defer func() {
+			if !stream.ReadChan.IsClosed() {
+				stream.ReadChan.Unregister(streamChan)
+			}
+		}()
+		if len(initialData) > 0 {
+			dataReceived(initialData)
+		}
+		for {
+			select {
+			case i := <-streamChan:
+				if i == nil {
+					return
+				}
+				dataReceived(i.([]byte))
+			case <-a.close:
+				return
+			}
+		}
+	}()
+}
 func (a *HTTP3Agent) checkResponse(response *HTTP3Response) {
-	if response.Complete() {
+	if response.Complete() && !response.delivered {
+		response.delivered = true
+		response.checkContentLength()
 		response.responseChan <- response
-		a.httpResponseReceived.Submit(*response)
+		if push, ok := a.pushStreams[response.streamID]; ok {
+			a.PushReceived.Submit(push.snapshot())
+		} else {
+			a.httpResponseReceived.Submit(*response)
+		}
 		a.Logger.Printf("A %d-byte long response on stream %d is complete\n", response.totalProcessed, response.streamID)
 	}
 }
@@ -233,52 +529,72 @@ func (a *HTTP3Agent) SendRequest(path, method, authority string, headers map[str
 		headers["user-agent"] = "QUIC-Tracker/" + GitCommit()
 	}
 
-	hdrs := []HTTPHeader{
-		{":method", method},
-		{":scheme", "https"},
-		{":authority", authority},
-		{":path", path},
-	}
+	request := HTTP3Request{Method: method, Authority: authority, Path: path}
 	for k, v := range headers {
-		hdrs = append(hdrs, HTTPHeader{k, v})
+		request.Headers = append(request.Headers, HTTPHeader{k, v})
+	}
+	return a.SendHTTP3Request(request)
+}
+
+// Sends the request on a new bidirectional stream. The headers are sent first, then the body in DATA frames as it is
+// read, and the trailers.
+func (a *HTTP3Agent) SendHTTP3Request(request HTTP3Request) chan HTTPResponse {
+	streamID := a.conn.NewBidiStreamID()
+	response := &HTTP3Response{HTTP09Response: HTTP09Response{streamID: streamID}, method: request.Method, responseChan: make(chan HTTPResponse, 1)}
+	select {
+	case a.requests <- requestSent{streamID, &request, response}:
+	case <-a.closed:
+		a.refuse(response, "the agent is closed")
 	}
+	return response.responseChan
+}
 
-	streamID := a.conn.CurrentStreamID
+// Checks that the request can be sent on the given stream, then encodes its headers and starts reading its response,
+// or refuses it. An extended CONNECT request is only checked once the SETTINGS frame of the peer is received.
+func (a *HTTP3Agent) requestSent(streamID uint64, request *HTTP3Request, response *HTTP3Response) {
+	if a.goAwaySent || streamID >= a.goAwayID {
+		a.Logger.Printf("The connection is going away, refusing to send a request on stream %d\n", streamID)
+		a.refuse(response, "the connection is going away")
+		return
+	}
+	// An extended CONNECT request can only be sent once the peer enabled it in its SETTINGS frame, see RFC 9220 Section 3
+	if request.Protocol != "" && a.peerSetting(http3.SETTINGS_ENABLE_CONNECT_PROTOCOL) != 1 {
+		a.Logger.Printf("Peer did not enable extended CONNECT, refusing to send a request on stream %d\n", streamID)
+		a.refuse(response, "extended CONNECT is not enabled by the peer")
+		return
+	}
+	if size, limit := a.requestSize(request); size > limit {
+		a.Logger.Printf("The request exceeds the maximum field section size of the peer, refusing to send it on stream %d\n", streamID)
+		a.refuse(response, fmt.Sprintf("field section of %d bytes exceeds the maximum of %d bytes of the peer", size, limit))
+		return
+	}
 	stream := a.conn.Streams.Get(streamID)
-	streamChan := stream.ReadChan.RegisterNewChan(1000)
 	a.streamDataBuffer[streamID] = new(bytes.Buffer)
-	response := &HTTP3Response{HTTP09Response: HTTP09Response{streamID: streamID}, responseChan: make(chan HTTPResponse, 1)}
 	a.responseBuffer[streamID] = response
+	a.requestBuffer[streamID] = request
+	if request.CapsuleProtocol {
+		a.capsuleStreams[streamID] = new(bytes.Buffer)
+	}
 
-	go func() { // Pipes the data from the response stream to the agent
-		defer func() {
-			if !stream.ReadChan.IsClosed() {
-				stream.ReadChan.Unregister(streamChan)
-			}
-		}()
-		for {
-			select {
-			case i := <-streamChan:
-				if i == nil {
-					return
-				}
-				data := i.([]byte)
-				a.streamData <- streamData{streamID, i.([]byte)}
-				response.totalReceived += uint64(len(data))
-				if stream.ReadClosed || response.totalReceived == stream.ReadCloseOffset {
-					response.fin = true
-					a.checkResponse(response)
-				}
-			case <-a.close:
-				return
-			}
+	a.readResponse(stream, streamID, response, nil)
+	a.QPACK.EncodeHeaders <- DecodedHeaders{streamID, request.fields()}
+}
 
-		}
-	}()
+// Changes the priority of the request sent on the given stream by sending a PRIORITY_UPDATE frame on the control
+// stream, see RFC 9218 Section 7.
+func (a *HTTP3Agent) UpdatePriority(streamID uint64, priority http3.Priority) {
+	a.sendFrameOnStream(http3.NewPRIORITY_UPDATE(false, streamID, priority), a.ControlStreamID, false)
+	a.Logger.Printf("Sent a PRIORITY_UPDATE frame for stream %d with priority %s\n", streamID, priority.String())
+}
 
-	a.QPACK.EncodeHeaders <- DecodedHeaders{streamID, hdrs}
-	a.conn.CurrentStreamID += 4
-	return response.responseChan
+// Returns the value of a setting sent by the peer, zero when it was omitted or its SETTINGS frame was not received. It
+// is only called by the agent, as the SETTINGS frame is recorded by its loop.
+func (a *HTTP3Agent) peerSetting(identifier uint64) uint64 {
+	if a.ReceivedSettings == nil {
+		return 0
+	}
+	value, _ := a.ReceivedSettings.Get(identifier)
+	return value
 }
 
 func (a *HTTP3Agent) HTTPResponseReceived() Broadcaster {
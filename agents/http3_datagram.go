@@ -0,0 +1,84 @@
+package agents
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/PROGNOSISTool/adapter-quic/http3"
+)
+
+// An HTTP3Datagram is an HTTP Datagram received for a request, either in a QUIC DATAGRAM frame or in a DATAGRAM
+// capsule on its stream.
+type HTTP3Datagram struct {
+	StreamID uint64
+	Payload  []byte
+	Capsule  bool
+}
+
+type HTTP3Capsule struct {
+	StreamID uint64
+	Capsule  http3.Capsule
+}
+
+// Processes the payload of a QUIC DATAGRAM frame, which starts with the quarter stream ID of its request, see RFC 9297
+// Section 2.1.
+func (a *HTTP3Agent) datagramReceived(data []byte) {
+	datagram, err := http3.ReadDatagram(data)
+	if err != nil {
+		a.closeConnection(http3.H3_DATAGRAM_ERROR, "invalid HTTP Datagram: %s", err.Error())
+		return
+	}
+	streamID := datagram.StreamID()
+	if _, ok := a.responseBuffer[streamID]; !ok {
+		a.Logger.Printf("Dropped a %d-byte HTTP Datagram for stream %d which does not match any request\n", len(datagram.Payload), streamID)
+		return
+	}
+	a.DatagramReceived.Submit(HTTP3Datagram{streamID, datagram.Payload, false})
+	a.Logger.Printf("Received a %d-byte HTTP Datagram for stream %d\n", len(datagram.Payload), streamID)
+}
+
+// Reads the complete capsules received on a stream using the Capsule Protocol.
+func (a *HTTP3Agent) readCapsules(streamID uint64, buffer *bytes.Buffer) {
+	for buffer.Len() > 0 {
+		r := bytes.NewReader(buffer.Bytes())
+		capsule, err := http3.ReadCapsule(r)
+		if err != nil {
+			return
+		}
+		buffer.Next(buffer.Len() - r.Len())
+		a.CapsuleReceived.Submit(HTTP3Capsule{streamID, capsule})
+		if capsule.Type == http3.CapsuleTypeDATAGRAM {
+			a.DatagramReceived.Submit(HTTP3Datagram{streamID, capsule.Value, true})
+		}
+		a.Logger.Printf("Received a capsule of type %#x and %d bytes on stream %d\n", capsule.Type, len(capsule.Value), streamID)
+	}
+}
+
+// Sends an HTTP Datagram for the request sent on the given stream in a QUIC DATAGRAM frame. It returns an error if HTTP
+// Datagrams were not enabled by both endpoints.
+func (a *HTTP3Agent) SendDatagram(streamID uint64, payload []byte) error {
+	if !a.EnableDatagrams {
+		return errors.New("HTTP Datagrams are not enabled")
+	}
+	d := datagramSent{streamID, payload, make(chan error, 1)}
+	select {
+	case a.datagrams <- d:
+		return <-d.err
+	case <-a.closed:
+		return errors.New("the agent is closed")
+	}
+}
+
+// Sends an HTTP Datagram once the agent checked that the peer enabled them in its SETTINGS frame.
+func (a *HTTP3Agent) sendDatagram(streamID uint64, payload []byte) error {
+	if a.peerSetting(http3.SETTINGS_H3_DATAGRAM) != 1 {
+		return errors.New("peer did not enable HTTP Datagrams")
+	}
+	return a.Datagrams.SendDatagram(http3.NewDatagram(streamID, payload).Encode())
+}
+
+// Sends a capsule in a DATA frame on the stream of a request using the Capsule Protocol.
+func (a *HTTP3Agent) SendCapsule(streamID uint64, capsule http3.Capsule) {
+	a.sendFrameOnStream(http3.NewDATA(capsule.Encode()), streamID, false)
+	a.Logger.Printf("Sent a capsule of type %#x and %d bytes on stream %d\n", capsule.Type, len(capsule.Value), streamID)
+}
@@ -0,0 +1,77 @@
+package agents
+
+import (
+	. "github.com/PROGNOSISTool/adapter-quic"
+	"github.com/PROGNOSISTool/adapter-quic/http3"
+)
+
+// Processes a GOAWAY frame received from the server, see RFC 9114 Section 5.2. The requests sent on streams with an
+// ID greater than or equal to the one indicated were not processed and are refused, the others are completed before
+// the connection is closed.
+func (a *HTTP3Agent) goAwayReceived(streamID uint64) {
+	if !IsBidiClient(streamID) {
+		a.closeConnection(http3.H3_ID_ERROR, "GOAWAY frame with stream ID %d which is not a client-initiated bidirectional stream", streamID)
+		return
+	}
+	if a.goAwayID != HTTPNoStream && streamID > a.goAwayID {
+		a.closeConnection(http3.H3_ID_ERROR, "GOAWAY frame increased the stream ID from %d to %d", a.goAwayID, streamID)
+		return
+	}
+	a.goAwayID = streamID
+	a.GoAwayReceived.Submit(streamID)
+	a.Logger.Printf("Received a GOAWAY frame with stream ID %d\n", streamID)
+
+	for id, response := range a.responseBuffer {
+		if _, ok := a.pushStreams[id]; !ok && id >= streamID && !response.delivered {
+			a.refuse(response, "request refused by a GOAWAY frame")
+		}
+	}
+	a.drain()
+}
+
+// Starts shutting down the connection gracefully by sending a GOAWAY frame with the given push ID. No new requests
+// are sent afterwards, and the pushes with an ID greater than or equal to it are cancelled. The connection is closed
+// once the responses to the requests already sent are received.
+func (a *HTTP3Agent) GoAway(pushID uint64) {
+	a.goAway <- pushID
+}
+
+func (a *HTTP3Agent) sendGoAway(pushID uint64) {
+	if a.goAwaySent && pushID > a.goAwayPushID {
+		a.Logger.Printf("Refusing to increase the push ID of the GOAWAY frame from %d to %d\n", a.goAwayPushID, pushID)
+		return
+	}
+	a.goAwaySent = true
+	a.goAwayPushID = pushID
+	a.sendFrameOnStream(http3.NewGOAWAY(pushID), a.ControlStreamID, false)
+	a.Logger.Printf("Sent a GOAWAY frame with push ID %d\n", pushID)
+
+	for id, push := range a.pushes {
+		if id >= pushID && !push.Cancelled && (push.response == nil || !push.response.delivered) {
+			a.sendCancelPush(id)
+		}
+	}
+	a.drain()
+}
+
+// Completes the response of a request that was not processed.
+func (a *HTTP3Agent) refuse(response *HTTP3Response, reason string) {
+	response.refused = true
+	response.delivered = true
+	response.addError(reason)
+	response.responseChan <- response
+}
+
+// Closes the connection with H3_NO_ERROR when it is going away and all the responses to the requests sent were
+// received. It is only called by the agent, as it reads the state of all the responses.
+func (a *HTTP3Agent) drain() {
+	if a.goAwayID == HTTPNoStream && !a.goAwaySent {
+		return
+	}
+	for id, response := range a.responseBuffer {
+		if _, ok := a.pushStreams[id]; !ok && !response.delivered {
+			return
+		}
+	}
+	a.closeConnection(http3.H3_NO_ERROR, "")
+}
@@ -0,0 +1,173 @@
+package agents
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	. "github.com/PROGNOSISTool/adapter-quic"
+	"github.com/PROGNOSISTool/adapter-quic/http3"
+)
+
+// An HTTP3Push gathers what was received for a server push, i.e. the PUSH_PROMISE frames announcing it and the push
+// stream carrying its response. The violations of RFC 9114 observed are reported in Errors. The pushes broadcast by
+// the agent are snapshots that are not modified afterwards.
+type HTTP3Push struct {
+	PushID          uint64
+	PromiseStreams  []uint64           // The request streams on which the push was promised
+	PromisedHeaders []HTTPHeader       // The request fields of the first PUSH_PROMISE frame
+	StreamID        uint64             // The push stream, HTTPNoStream until it is opened
+	Response        *HTTP3PushResponse // The response received on the push stream, nil until it is opened
+	Cancelled       bool               // Whether we sent a CANCEL_PUSH frame for it
+	CancelledByPeer bool               // Whether the peer sent a CANCEL_PUSH frame for it
+	Errors          []string
+	response        *HTTP3Response
+}
+
+// An HTTP3PushResponse is the state of the response of a push at the time the push was broadcast.
+type HTTP3PushResponse struct {
+	Status   int
+	Complete bool
+	Errors   []string
+}
+
+func (p *HTTP3Push) addError(format string, a ...interface{}) {
+	p.Errors = append(p.Errors, fmt.Sprintf(format, a...))
+}
+
+// Returns a copy of the push that does not share any state with the agent.
+func (p *HTTP3Push) snapshot() HTTP3Push {
+	s := *p
+	s.PromiseStreams = append([]uint64(nil), p.PromiseStreams...)
+	s.PromisedHeaders = append([]HTTPHeader(nil), p.PromisedHeaders...)
+	s.Errors = append([]string(nil), p.Errors...)
+	s.response = nil
+	if p.response != nil {
+		s.Response = &HTTP3PushResponse{p.response.Status(), p.response.Complete(), append([]string(nil), p.response.Errors()...)}
+	}
+	return s
+}
+
+// Returns the push of the given ID, creating it when it is referenced for the first time.
+func (a *HTTP3Agent) push(pushID uint64) *HTTP3Push {
+	push, ok := a.pushes[pushID]
+	if !ok {
+		push = &HTTP3Push{PushID: pushID, StreamID: HTTPNoStream}
+		a.pushes[pushID] = push
+	}
+	return push
+}
+
+// Returns whether the push ID is allowed by the MAX_PUSH_ID frames sent, and closes the connection otherwise.
+func (a *HTTP3Agent) checkPushID(push *HTTP3Push, frame string) bool {
+	if !a.maxPushIDSent || push.PushID > a.maxPushID {
+		push.addError("%s with push ID %d exceeding the maximum push ID", frame, push.PushID)
+		a.closeConnection(http3.H3_ID_ERROR, "%s with push ID %d exceeding the maximum push ID", frame, push.PushID)
+		return false
+	}
+	return true
+}
+
+// Records a PUSH_PROMISE frame received on a request stream. Its field section is decoded in order with the other
+// field sections of the stream.
+func (a *HTTP3Agent) pushPromiseReceived(streamID uint64, f *http3.PUSH_PROMISE) {
+	push := a.push(f.PushID.Value)
+	if !a.checkPushID(push, "PUSH_PROMISE frame") {
+		return
+	}
+	push.PromiseStreams = append(push.PromiseStreams, streamID)
+	a.headerSections[streamID] = append(a.headerSections[streamID], push)
+	a.QPACK.DecodeHeaders <- EncodedHeaders{streamID, f.HeaderBlock}
+	if a.goAwaySent && push.PushID >= a.goAwayPushID && !push.Cancelled {
+		a.sendCancelPush(push.PushID)
+	}
+}
+
+func (a *HTTP3Agent) pushPromiseDecoded(push *HTTP3Push, headers []HTTPHeader) {
+	if push.PromisedHeaders != nil {
+		if !reflect.DeepEqual(push.PromisedHeaders, headers) {
+			push.addError("push promised again with different fields")
+		}
+		return
+	}
+	push.PromisedHeaders = headers
+	if push.response != nil {
+		push.response.method = promisedMethod(headers)
+	}
+	a.PushPromised.Submit(push.snapshot())
+	a.Logger.Printf("Push %d was promised with %d fields\n", push.PushID, len(headers))
+}
+
+func promisedMethod(headers []HTTPHeader) string {
+	for _, h := range headers {
+		if h.Name == ":method" {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+// Starts receiving the response carried by a push stream, which begins with the stream type and the push ID.
+func (a *HTTP3Agent) pushStreamOpened(streamID uint64, stream *Stream, streamTypeLength int) {
+	r := bytes.NewReader(stream.ReadData[streamTypeLength:])
+	pushID, err := ReadVarInt(r)
+	if err != nil {
+		a.Logger.Printf("Unable to read the push ID of push stream %d\n", streamID)
+		return
+	}
+	push := a.push(pushID.Value)
+	if !a.checkPushID(push, "push stream") {
+		return
+	}
+	if push.StreamID != HTTPNoStream {
+		push.addError("push stream %d opened for a push already received on stream %d", streamID, push.StreamID)
+		a.closeConnection(http3.H3_ID_ERROR, "push stream %d opened for a push already received on stream %d", streamID, push.StreamID)
+		return
+	}
+	push.StreamID = streamID
+	response := &HTTP3Response{HTTP09Response: HTTP09Response{streamID: streamID}, method: promisedMethod(push.PromisedHeaders), responseChan: make(chan HTTPResponse, 1)}
+	push.response = response
+	a.pushStreams[streamID] = push
+	a.responseBuffer[streamID] = response
+	a.streamDataBuffer[streamID] = new(bytes.Buffer)
+	a.Logger.Printf("Peer opened push stream %d for push %d\n", streamID, push.PushID)
+
+	prefixLength := streamTypeLength + pushID.Length
+	response.totalReceived += uint64(prefixLength)
+	response.totalProcessed += uint64(prefixLength)
+	a.readResponse(stream, streamID, response, stream.ReadData[prefixLength:])
+	if push.Cancelled {
+		a.conn.Streams.StopSending(streamID, http3.H3_REQUEST_CANCELLED)
+	}
+}
+
+// Allows the peer to push responses, up to the given push ID, by sending a MAX_PUSH_ID frame.
+func (a *HTTP3Agent) AllowPushes(maxPushID uint64) {
+	a.allowPushes <- maxPushID
+}
+
+// Cancels the given push by sending a CANCEL_PUSH frame, and aborts reading its push stream when it is opened.
+func (a *HTTP3Agent) CancelPush(pushID uint64) {
+	a.cancelPush <- pushID
+}
+
+func (a *HTTP3Agent) sendMaxPushID(maxPushID uint64) {
+	if a.maxPushIDSent && maxPushID < a.maxPushID {
+		a.Logger.Printf("Reducing the maximum push ID from %d to %d\n", a.maxPushID, maxPushID)
+	} else {
+		a.maxPushID = maxPushID
+	}
+	a.maxPushIDSent = true
+	a.sendFrameOnStream(http3.NewMAX_PUSH_ID(maxPushID), a.ControlStreamID, false)
+	a.Logger.Printf("Sent a MAX_PUSH_ID frame with push ID %d\n", maxPushID)
+}
+
+func (a *HTTP3Agent) sendCancelPush(pushID uint64) {
+	push := a.push(pushID)
+	push.Cancelled = true
+	a.sendFrameOnStream(http3.NewCANCEL_PUSH(pushID), a.ControlStreamID, false)
+	if push.StreamID != HTTPNoStream {
+		a.conn.Streams.StopSending(push.StreamID, http3.H3_REQUEST_CANCELLED)
+	}
+	a.Logger.Printf("Cancelled push %d\n", pushID)
+}
@@ -0,0 +1,197 @@
+package agents
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/PROGNOSISTool/adapter-quic/http3"
+)
+
+// An HTTP3Request describes a request sent by the HTTP3Agent. The pseudo-header fields are built from the method,
+// authority and path, the other fields are sent in the given order. A CONNECT request with a protocol is an extended
+// CONNECT request, see RFC 9220.
+type HTTP3Request struct {
+	Method          string
+	Authority       string
+	Path            string
+	Protocol        string // Sent in the :protocol pseudo-header field of an extended CONNECT request when not empty
+	Headers         []HTTPHeader
+	Body            io.Reader       // Sent in DATA frames when not nil
+	Trailers        []HTTPHeader    // Sent in a HEADERS frame after the body when not empty
+	Priority        *http3.Priority // Sent in the priority header field when not nil
+	CapsuleProtocol bool            // The DATA frames of the response are parsed as capsules, see RFC 9297 Section 3
+}
+
+func (r *HTTP3Request) fields() []HTTPHeader {
+	fields := []HTTPHeader{{":method", r.Method}}
+	if r.Protocol != "" {
+		fields = append(fields, HTTPHeader{":protocol", r.Protocol})
+	}
+	if r.Method != "CONNECT" || r.Protocol != "" {
+		fields = append(fields, HTTPHeader{":scheme", "https"})
+	}
+	fields = append(fields, HTTPHeader{":authority", r.Authority})
+	if r.Method != "CONNECT" || r.Protocol != "" {
+		fields = append(fields, HTTPHeader{":path", r.Path})
+	}
+	if r.Priority != nil {
+		fields = append(fields, HTTPHeader{http3.PriorityFieldName, r.Priority.String()})
+	}
+	if r.CapsuleProtocol {
+		fields = append(fields, HTTPHeader{http3.CapsuleProtocolFieldName, "?1"})
+	}
+	return append(fields, r.Headers...)
+}
+
+// An HTTP3Response gathers the response to a request sent by the HTTP3Agent. The violations of RFC 9114 observed in
+// the response, e.g. invalid fields or a content-length not matching the body, are reported in Errors.
+type HTTP3Response struct {
+	HTTP09Response
+	method   string
+	status   int
+	headers  []HTTPHeader
+	interim  [][]HTTPHeader
+	trailers []HTTPHeader
+	errors   []string
+
+	fin              bool
+	headersRemaining int
+	headersFrames    int
+	dataFrames       int
+	trailersFrame    bool
+	totalProcessed   uint64
+	totalReceived    uint64
+	responseChan     chan HTTPResponse
+	delivered        bool
+	refused          bool
+}
+
+// Returns whether the response was entirely received. The response to a CONNECT request is complete as soon as its
+// final status is, as the stream then carries the data of the tunnel.
+func (r HTTP3Response) Complete() bool {
+	if r.method == "CONNECT" && r.status != 0 && r.headersRemaining == 0 {
+		return true
+	}
+	return r.fin && r.totalReceived > 0 && r.totalProcessed == r.totalReceived && r.headersRemaining == 0
+}
+
+func (r HTTP3Response) Headers() []HTTPHeader          { return r.headers }
+func (r HTTP3Response) Status() int                    { return r.status }
+func (r HTTP3Response) InterimHeaders() [][]HTTPHeader { return r.interim }
+func (r HTTP3Response) Trailers() []HTTPHeader         { return r.trailers }
+func (r HTTP3Response) Errors() []string               { return r.errors }
+func (r HTTP3Response) Refused() bool                  { return r.refused }
+
+func (r *HTTP3Response) addError(format string, a ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, a...))
+}
+
+// Records the frame received on the response stream and returns whether it is allowed at this point, see RFC 9114
+// Section 4.1.
+func (r *HTTP3Response) frameReceived(isHeaders bool) bool {
+	valid := true
+	if r.trailersFrame {
+		r.addError("frame received after the trailers")
+		valid = false
+	}
+	if isHeaders {
+		r.headersFrames++
+		r.trailersFrame = r.dataFrames > 0
+	} else {
+		if r.headersFrames == 0 {
+			r.addError("DATA frame received before the HEADERS frame")
+			valid = false
+		}
+		r.dataFrames++
+	}
+	return valid
+}
+
+// Processes a decoded field section, which is an interim response, the final response or the trailers.
+func (r *HTTP3Response) headersDecoded(fields []HTTPHeader) {
+	if r.status != 0 {
+		r.trailers = fields
+		for _, e := range validateFields(fields, true) {
+			r.addError("trailers: %s", e)
+		}
+		return
+	}
+	for _, e := range validateFields(fields, false) {
+		r.addError("headers: %s", e)
+	}
+	status := 0
+	for _, f := range fields {
+		if f.Name == ":status" {
+			if s, err := strconv.Atoi(f.Value); err == nil && len(f.Value) == 3 {
+				status = s
+			} else {
+				r.addError("invalid :status %q", f.Value)
+			}
+		}
+	}
+	if status >= 100 && status < 200 {
+		if status == 101 {
+			r.addError("101 status code received")
+		}
+		r.interim = append(r.interim, fields)
+		return
+	}
+	if status == 0 {
+		status = -1 // The final response has been received nonetheless
+	}
+	r.status = status
+	r.headers = fields
+}
+
+// Checks that the content-length of the response matches its body, see RFC 9114 Section 4.1.2.
+func (r *HTTP3Response) checkContentLength() {
+	if r.method == "HEAD" || r.method == "CONNECT" || r.status == 204 || r.status == 304 {
+		return
+	}
+	for _, f := range r.headers {
+		if f.Name == "content-length" {
+			if length, err := strconv.ParseUint(f.Value, 10, 64); err != nil {
+				r.addError("invalid content-length %q", f.Value)
+			} else if length != uint64(len(r.body)) {
+				r.addError("content-length %d does not match the %d bytes of body received", length, len(r.body))
+			}
+		}
+	}
+}
+
+var connectionSpecificFields = map[string]bool{"connection": true, "keep-alive": true, "proxy-connection": true, "transfer-encoding": true, "upgrade": true}
+
+// Returns the violations of RFC 9114 Section 4.2 and 4.3 found in the fields of a response, or of its trailers.
+func validateFields(fields []HTTPHeader, trailers bool) []string {
+	var errors []string
+	regularFieldSeen, statusSeen := false, false
+	for _, f := range fields {
+		if strings.ToLower(f.Name) != f.Name {
+			errors = append(errors, fmt.Sprintf("field name %q contains uppercase characters", f.Name))
+		}
+		if strings.HasPrefix(f.Name, ":") {
+			if trailers {
+				errors = append(errors, fmt.Sprintf("pseudo-header field %s in trailers", f.Name))
+			} else if f.Name != ":status" {
+				errors = append(errors, fmt.Sprintf("invalid pseudo-header field %s", f.Name))
+			} else if statusSeen {
+				errors = append(errors, "duplicate :status pseudo-header field")
+			}
+			if regularFieldSeen {
+				errors = append(errors, fmt.Sprintf("pseudo-header field %s after a regular field", f.Name))
+			}
+			statusSeen = statusSeen || f.Name == ":status"
+			continue
+		}
+		regularFieldSeen = true
+		if connectionSpecificFields[f.Name] || (f.Name == "te" && f.Value != "trailers") {
+			errors = append(errors, fmt.Sprintf("connection-specific field %s", f.Name))
+		}
+	}
+	if !trailers && !statusSeen {
+		errors = append(errors, "missing :status pseudo-header field")
+	}
+	return errors
+}
@@ -0,0 +1,55 @@
+package agents
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		fields   []HTTPHeader
+		trailers bool
+		errors   []string
+	}{
+		{"valid", []HTTPHeader{{":status", "200"}, {"content-type", "text/html"}}, false, nil},
+		{"missing status", []HTTPHeader{{"content-type", "text/html"}}, false, []string{"missing :status pseudo-header field"}},
+		{"duplicate status", []HTTPHeader{{":status", "200"}, {":status", "200"}}, false, []string{"duplicate :status pseudo-header field"}},
+		{"request pseudo-header", []HTTPHeader{{":status", "200"}, {":path", "/"}}, false, []string{"invalid pseudo-header field :path"}},
+		{"pseudo-header after a regular field", []HTTPHeader{{"server", "test"}, {":status", "200"}}, false, []string{"pseudo-header field :status after a regular field"}},
+		{"pseudo-header in trailers", []HTTPHeader{{":status", "200"}}, true, []string{"pseudo-header field :status in trailers"}},
+		{"uppercase name", []HTTPHeader{{":status", "200"}, {"Content-Type", "text/html"}}, false, []string{`field name "Content-Type" contains uppercase characters`}},
+		{"connection-specific field", []HTTPHeader{{":status", "200"}, {"connection", "close"}}, false, []string{"connection-specific field connection"}},
+		{"te trailers", []HTTPHeader{{"te", "trailers"}}, true, nil},
+		{"te other", []HTTPHeader{{"te", "gzip"}}, true, []string{"connection-specific field te"}},
+	}
+	for _, test := range tests {
+		if errors := validateFields(test.fields, test.trailers); !reflect.DeepEqual(errors, test.errors) {
+			t.Errorf("%s: expected errors %q, got %q", test.name, test.errors, errors)
+		}
+	}
+}
+
+func TestHTTP3Response_CheckContentLength(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		status int
+		length string
+		body   string
+		errors []string
+	}{
+		{"matching", "GET", 200, "4", "body", nil},
+		{"mismatch", "GET", 200, "5", "body", []string{"content-length 5 does not match the 4 bytes of body received"}},
+		{"invalid", "GET", 200, "four", "body", []string{`invalid content-length "four"`}},
+		{"HEAD request", "HEAD", 200, "5", "", nil},
+		{"not modified", "GET", 304, "5", "", nil},
+	}
+	for _, test := range tests {
+		r := &HTTP3Response{HTTP09Response: HTTP09Response{body: []byte(test.body)}, method: test.method, status: test.status, headers: []HTTPHeader{{"content-length", test.length}}}
+		r.checkContentLength()
+		if !reflect.DeepEqual(r.Errors(), test.errors) {
+			t.Errorf("%s: expected errors %q, got %q", test.name, test.errors, r.Errors())
+		}
+	}
+}
@@ -151,7 +151,7 @@ func (a *ParsingAgent) Run(conn *Connection) {
 							a.conn.ReceiveFrameBuffer[framer.PNSpace()][frame.FrameType()] = append(a.conn.ReceiveFrameBuffer[framer.PNSpace()][frame.FrameType()], frame)
 						}
 
-						if framer.GetHeader().GetPacketNumber() > conn.LargestPNsReceived[framer.PNSpace()] {
+						if largest, ok := conn.LargestPNsReceived[framer.PNSpace()]; !ok || framer.GetHeader().GetPacketNumber() > largest {
 							conn.LargestPNsReceived[framer.PNSpace()] = framer.GetHeader().GetPacketNumber()
 						}
 						packet = framer
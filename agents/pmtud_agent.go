@@ -0,0 +1,207 @@
+package agents
+
+import (
+	"time"
+
+	. "github.com/PROGNOSISTool/adapter-quic"
+	"github.com/PROGNOSISTool/adapter-quic/qlog"
+)
+
+const (
+	PMTUDBasePMTU          = 1200 // The minimum UDP payload size a QUIC path must support, see RFC 9000 Section 14
+	PMTUDDefaultMaxPMTU    = 1452 // An Ethernet MTU minus the IPv6 and UDP headers
+	PMTUDMaxProbes         = 3    // See MAX_PROBES in RFC 8899 Section 5.1.2
+	PMTUDSearchGranularity = 16   // The search stops when the bounds are closer than this value
+)
+
+// A PMTUStatus is submitted each time the PMTU is raised and when the search completes.
+type PMTUStatus struct {
+	PMTU       uint16
+	SearchDone bool
+}
+
+// The PMTUDAgent implements Datagram Packetization Layer PMTU Discovery as described in RFC 8899 and RFC 9000 Section
+// 14.3. Once 1-RTT keys are available, it sends PING frames in 1-RTT packets padded to a probed size and performs a
+// binary search between the base PMTU and an upper bound. The upper bound is the smallest of MaxPMTU, the interface MTU
+// and the max_udp_payload_size transport parameter of the peer. A probe size is validated when one of its packets is
+// acknowledged and invalidated after MaxProbes unacknowledged attempts. Each validated size raises the MTU of the
+// SendingAgent, if any. The discovered PMTU is reported in the qlog trace and through the PMTUStatus broadcaster.
+type PMTUDAgent struct {
+	BaseAgent
+	SendingAgent   *SendingAgent
+	MaxPMTU        uint16
+	MaxProbes      int
+	ProbeTimeout   time.Duration // If not set, it is derived from the smoothed RTT
+	PMTUStatus     Broadcaster //type: PMTUStatus
+	conn           *Connection
+	pmtu           uint16
+	searchDone     bool
+	lowerBound     uint16
+	upperBound     uint16
+	probedSize     uint16
+	probeCount     int
+	probesInFlight map[PacketNumber]uint16
+}
+
+func (a *PMTUDAgent) Run(conn *Connection) {
+	a.Init("PMTUDAgent", conn.OriginalDestinationCID)
+	a.conn = conn
+	a.PMTUStatus = NewBroadcaster(10)
+
+	if a.MaxPMTU == 0 {
+		a.MaxPMTU = PMTUDDefaultMaxPMTU
+	}
+	if a.MaxProbes == 0 {
+		a.MaxProbes = PMTUDMaxProbes
+	}
+	a.pmtu = PMTUDBasePMTU
+	a.searchDone = false
+	a.lowerBound = PMTUDBasePMTU
+	a.upperBound = a.MaxPMTU
+	a.probedSize = 0
+	a.probeCount = 0
+	a.probesInFlight = make(map[PacketNumber]uint16)
+
+	incomingPackets := conn.IncomingPackets.RegisterNewChan(1000)
+	elChan := conn.EncryptionLevels.RegisterNewChan(10)
+	probeTimer := time.NewTimer(0)
+	<-probeTimer.C
+
+	go func() {
+		defer a.Logger.Println("Agent terminated")
+		defer close(a.closed)
+		defer probeTimer.Stop()
+
+		if cs := conn.CryptoState(EncryptionLevel1RTT); cs != nil && cs.Write != nil { // The agent was attached after the handshake
+			a.computeUpperBound()
+			a.sendNextProbe(probeTimer)
+		}
+
+		for {
+			select {
+			case i := <-elChan:
+				dEL := i.(DirectionalEncryptionLevel)
+				if dEL.EncryptionLevel == EncryptionLevel1RTT && !dEL.Read && dEL.Available && a.probedSize == 0 && !a.searchDone {
+					a.computeUpperBound()
+					a.sendNextProbe(probeTimer)
+				}
+			case i := <-incomingPackets:
+				switch p := i.(type) {
+				case Framer:
+					if p.PNSpace() != PNSpaceAppData || a.searchDone {
+						continue
+					}
+					for _, f := range append(p.GetAll(AckType), p.GetAll(AckECNType)...) {
+						var ack *AckFrame
+						switch frame := f.(type) {
+						case *AckFrame:
+							ack = frame
+						case *AckECNFrame:
+							ack = &frame.AckFrame
+						}
+						for _, pn := range ack.GetAckedPackets() {
+							if size, ok := a.probesInFlight[pn]; ok && size == a.probedSize {
+								a.Logger.Printf("Probe of size %d in packet %d was acknowledged\n", size, pn)
+								a.probesInFlight = make(map[PacketNumber]uint16)
+								a.lowerBound = size
+								a.updatePMTU(size)
+								a.probeCount = 0
+								if !probeTimer.Stop() {
+									select {
+									case <-probeTimer.C:
+									default:
+									}
+								}
+								a.sendNextProbe(probeTimer)
+								break
+							}
+						}
+					}
+				}
+			case <-probeTimer.C:
+				if a.searchDone {
+					continue
+				}
+				if a.probeCount >= a.MaxProbes {
+					a.Logger.Printf("Probe of size %d was not acknowledged after %d attempts\n", a.probedSize, a.probeCount)
+					a.probesInFlight = make(map[PacketNumber]uint16)
+					a.upperBound = a.probedSize - 1
+					a.probeCount = 0
+				}
+				a.sendNextProbe(probeTimer)
+			case <-a.close:
+				return
+			}
+		}
+	}()
+}
+
+func (a *PMTUDAgent) computeUpperBound() {
+	if a.conn.InterfaceMTU > 0 {
+		var ipOverhead = 8
+		if a.conn.UseIPv6 {
+			ipOverhead += 40
+		} else {
+			ipOverhead += 20
+		}
+		if itfMax := a.conn.InterfaceMTU - ipOverhead; itfMax > 0 && uint16(itfMax) < a.upperBound {
+			a.upperBound = uint16(itfMax)
+		}
+	}
+	if tp := a.conn.TLSTPHandler.ReceivedParameters; tp != nil && tp.MaxPacketSize > 0 && tp.MaxPacketSize < uint64(a.upperBound) {
+		a.upperBound = uint16(tp.MaxPacketSize)
+	}
+	a.Logger.Printf("Searching the PMTU between %d and %d bytes\n", a.lowerBound, a.upperBound)
+}
+
+func (a *PMTUDAgent) sendNextProbe(probeTimer *time.Timer) {
+	if a.probeCount == 0 {
+		if a.upperBound < a.lowerBound || a.upperBound-a.lowerBound < PMTUDSearchGranularity {
+			a.searchComplete()
+			return
+		}
+		a.probedSize = a.lowerBound + (a.upperBound-a.lowerBound+1)/2
+	}
+
+	probe := NewProtectedPacket(a.conn)
+	probe.AddFrame(new(PingFrame))
+	probe.PadTo(int(a.probedSize) - a.conn.CryptoState(EncryptionLevel1RTT).Write.Overhead())
+	a.probesInFlight[probe.Header.GetPacketNumber()] = a.probedSize
+	a.probeCount++
+	a.Logger.Printf("Sending probe %d of size %d in packet %d\n", a.probeCount, a.probedSize, probe.Header.GetPacketNumber())
+	a.conn.SendPacket.Submit(PacketToSend{Packet: probe, EncryptionLevel: EncryptionLevel1RTT})
+
+	probeTimer.Reset(a.probeTimeout())
+}
+
+func (a *PMTUDAgent) probeTimeout() time.Duration {
+	if a.ProbeTimeout > 0 {
+		return a.ProbeTimeout
+	}
+	if a.conn.SmoothedRTT > 0 {
+		return 3 * time.Duration(a.conn.SmoothedRTT+4*a.conn.RTTVar) * time.Microsecond
+	}
+	return time.Second
+}
+
+func (a *PMTUDAgent) updatePMTU(size uint16) {
+	if size <= a.pmtu {
+		return
+	}
+	old := a.pmtu
+	a.pmtu = size
+	if a.SendingAgent != nil {
+		a.SendingAgent.UpdateMTU <- size
+	}
+	a.Logger.Printf("PMTU raised from %d to %d\n", old, size)
+	a.conn.QLogEvents <- a.conn.QLogTrace.NewEvent(qlog.Categories.Connectivity.Category, qlog.Categories.Connectivity.MTUUpdated, qlog.MTUUpdated{Old: old, New: size})
+	a.PMTUStatus.Submit(PMTUStatus{size, false})
+}
+
+func (a *PMTUDAgent) searchComplete() {
+	a.searchDone = true
+	a.probedSize = 0
+	a.Logger.Printf("PMTU search completed, discovered PMTU is %d\n", a.pmtu)
+	a.conn.QLogEvents <- a.conn.QLogTrace.NewEvent(qlog.Categories.Connectivity.Category, qlog.Categories.Connectivity.MTUUpdated, qlog.MTUUpdated{New: a.pmtu, Done: true})
+	a.PMTUStatus.Submit(PMTUStatus{a.pmtu, true})
+}
@@ -8,15 +8,27 @@ import (
 	"github.com/PROGNOSISTool/adapter-quic/qlog/qt2qlog"
 )
 
+// The QLogAgent is responsible for recording in the qlog trace of the connection the packets sent and received, the
+// transport parameters of both endpoints, the keys installed and discarded, and the state changes of the connection and
+// of its streams.
 type QLogAgent struct {
 	BaseAgent
+	conn  *Connection
+	state string
 }
 
 func (a *QLogAgent) Run(conn *Connection) {
 	a.Init("QLogAgent", conn.OriginalDestinationCID)
+	a.conn = conn
 
 	incomingPackets := conn.IncomingPackets.RegisterNewChan(1000)
 	outgoingPackets := conn.OutgoingPackets.RegisterNewChan(1000)
+	transportParameters := conn.TransportParameters.RegisterNewChan(10)
+	encryptionLevels := conn.EncryptionLevels.RegisterNewChan(10)
+	streamStateUpdates := conn.StreamStateUpdates.RegisterNewChan(1000)
+	connectionClosed := conn.ConnectionClosed
+
+	var localParameters *TLSTransportParameterHandler
 
 	go func() {
 		defer a.Logger.Println("Agent terminated")
@@ -26,7 +38,7 @@ func (a *QLogAgent) Run(conn *Connection) {
 			case i := <-incomingPackets:
 				p := i.(Packet)
 				jp := qt2qlog.ConvertPacket(p)
-				jp.Header.PacketSize = int(p.ReceiveContext().PacketSize)
+				jp.Raw.Length = uint64(p.ReceiveContext().PacketSize)
 				e := conn.QLogTrace.NewEvent(qlog.Categories.Transport.Category, qlog.Categories.Transport.PacketReceived, jp)
 				if !p.ReceiveContext().WasBuffered {
 					e.RelativeTime = uint64(p.ReceiveContext().Timestamp.Sub(conn.QLogTrace.ReferenceTime) / qlog.TimeUnits)
@@ -34,13 +46,52 @@ func (a *QLogAgent) Run(conn *Connection) {
 					e.RelativeTime = uint64(time.Now().Sub(conn.QLogTrace.ReferenceTime) / qlog.TimeUnits)
 				}
 				conn.QLogEvents <- e
+				if f, ok := p.(Framer); ok {
+					if f.Contains(HandshakeDoneType) {
+						a.updateState(qlog.ConnectionStateHandshakeConfirmed)
+					}
+					if f.Contains(ConnectionCloseType) || f.Contains(ApplicationCloseType) {
+						a.updateState(qlog.ConnectionStateDraining)
+					}
+				}
 			case i := <-outgoingPackets:
 				p := i.(Packet)
 				jp := qt2qlog.ConvertPacket(p)
-				jp.Header.PacketSize = int(i.(Packet).SendContext().PacketSize)
+				jp.Raw.Length = uint64(i.(Packet).SendContext().PacketSize)
 				e := conn.QLogTrace.NewEvent(qlog.Categories.Transport.Category, qlog.Categories.Transport.PacketSent, jp)
 				e.RelativeTime = uint64(p.SendContext().Timestamp.Sub(conn.QLogTrace.ReferenceTime) / qlog.TimeUnits)
 				conn.QLogEvents <- e
+				if _, ok := p.(*InitialPacket); ok && conn.TLSTPHandler != localParameters {
+					// The parameters are sent in the first Initial packet, and again when the connection transitions
+					// to another version
+					localParameters = conn.TLSTPHandler
+					a.submit(qlog.Categories.Transport.Category, qlog.Categories.Transport.ParametersSet, qt2qlog.ConvertParameters(qlog.OwnerLocal, &localParameters.QuicTransportParameters))
+					a.updateState(qlog.ConnectionStateAttempted)
+				}
+				if f, ok := p.(Framer); ok && (f.Contains(ConnectionCloseType) || f.Contains(ApplicationCloseType)) && a.state != qlog.ConnectionStateDraining {
+					a.updateState(qlog.ConnectionStateClosing)
+				}
+			case i := <-transportParameters:
+				parameters := i.(QuicTransportParameters)
+				a.submit(qlog.Categories.Transport.Category, qlog.Categories.Transport.ParametersSet, qt2qlog.ConvertParameters(qlog.OwnerRemote, &parameters))
+			case i := <-encryptionLevels:
+				e := i.(DirectionalEncryptionLevel)
+				if e.Available {
+					a.submit(qlog.Categories.Security.Category, qlog.Categories.Security.KeyUpdated, qlog.KeyUpdated{KeyType: qt2qlog.ConvertKeyType(e.EncryptionLevel, e.Read), Trigger: qlog.KeyTriggerTLS})
+					if e.EncryptionLevel == EncryptionLevel1RTT && e.Read {
+						// Only one ALPN is offered, it is the one selected when the handshake completes
+						a.submit(qlog.Categories.Transport.Category, qlog.Categories.Transport.ALPNInformation, qlog.ALPNInformation{ChosenALPN: conn.ALPN})
+						a.updateState(qlog.ConnectionStateHandshakeComplete)
+					}
+				} else { // The keys of both directions are dropped at once
+					a.submit(qlog.Categories.Security.Category, qlog.Categories.Security.KeyDiscarded, qlog.KeyDiscarded{KeyType: qt2qlog.ConvertKeyType(e.EncryptionLevel, false), Trigger: qlog.KeyTriggerTLS})
+					a.submit(qlog.Categories.Security.Category, qlog.Categories.Security.KeyDiscarded, qlog.KeyDiscarded{KeyType: qt2qlog.ConvertKeyType(e.EncryptionLevel, true), Trigger: qlog.KeyTriggerTLS})
+				}
+			case i := <-streamStateUpdates:
+				a.submit(qlog.Categories.Transport.Category, qlog.Categories.Transport.StreamStateUpdated, qt2qlog.ConvertStreamStateUpdate(i.(StreamStateUpdate)))
+			case <-connectionClosed:
+				a.updateState(qlog.ConnectionStateClosed)
+				connectionClosed = nil
 			case <-a.close:
 				return
 			}
@@ -48,3 +99,15 @@ func (a *QLogAgent) Run(conn *Connection) {
 	}()
 
 }
+
+func (a *QLogAgent) submit(category string, eventType string, data interface{}) {
+	a.conn.QLogEvents <- a.conn.QLogTrace.NewEvent(category, eventType, data)
+}
+
+func (a *QLogAgent) updateState(state string) {
+	if a.state == state {
+		return
+	}
+	a.submit(qlog.Categories.Connectivity.Category, qlog.Categories.Connectivity.ConnectionStateUpdated, qlog.ConnectionStateUpdated{Old: a.state, New: state})
+	a.state = state
+}
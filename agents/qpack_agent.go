@@ -2,15 +2,15 @@ package agents
 
 import (
 	"bytes"
+	"errors"
 	"math"
 
 	. "github.com/PROGNOSISTool/adapter-quic"
-	ls_qpack_go "github.com/PROGNOSISTool/ls-qpack-go"
+	"github.com/PROGNOSISTool/adapter-quic/http3"
+	"github.com/PROGNOSISTool/adapter-quic/qpack"
 )
 
-type HTTPHeader struct {
-	Name, Value string
-}
+type HTTPHeader = qpack.HeaderField
 
 type DecodedHeaders struct {
 	StreamID uint64
@@ -22,42 +22,71 @@ type EncodedHeaders struct {
 	Headers  []byte
 }
 
-// The QPACK Agent is TODO
+type encoderSettings struct {
+	maxTableCapacity     uint64
+	dynamicTableCapacity uint64
+	maxBlockedStreams    uint64
+	opts                 uint32
+}
+
+// The QPACKAgent is responsible for compressing and decompressing the field sections of HTTP/3. It maintains the
+// encoder and decoder streams and exchanges their instructions with the peer. The capacity of the dynamic table of the
+// decoder and the number of streams it allows to be blocked are the values advertised in our SETTINGS frame. When
+// the streams are disabled, the dynamic tables are not used.
 type QPACKAgent struct {
 	BaseAgent
-	EncoderStreamID uint64
-	DecoderStreamID uint64
-	DisableStreams  bool
-	DecodeHeaders   chan EncodedHeaders
-	DecodedHeaders  Broadcaster //type: DecodedHeaders
-	EncodeHeaders   chan DecodedHeaders
-	EncodedHeaders  Broadcaster //type: EncodedHeaders
-	encoder         *ls_qpack_go.QPackEncoder
-	decoder         *ls_qpack_go.QPackDecoder
+	conn              *Connection
+	EncoderStreamID   uint64 // Allocated by the connection when zero
+	DecoderStreamID   uint64 // Allocated by the connection when zero
+	DisableStreams    bool
+	MaxTableCapacity  *uint64 // 1024 bytes when nil
+	MaxBlockedStreams *uint64 // 100 when nil
+	DecodeHeaders     chan EncodedHeaders
+	DecodedHeaders    Broadcaster //type: DecodedHeaders
+	EncodeHeaders     chan DecodedHeaders
+	EncodedHeaders    Broadcaster //type: EncodedHeaders
+	encoder           *qpack.Encoder
+	decoder           *qpack.Decoder
+	initEncoder       chan encoderSettings
+	maxTableCapacity  uint64
+	maxBlockedStreams uint64
 }
 
 const (
 	QPACKNoStream uint64 = math.MaxUint64
-	QPACKEncoderStreamValue = 0x2
-	QPACKDecoderStreamValue = 0x3
+	QPACKEncoderStreamValue = qpack.StreamTypeEncoder
+	QPACKDecoderStreamValue = qpack.StreamTypeDecoder
 )
 
 func (a *QPACKAgent) Run(conn *Connection) {
 	a.Init("QPACKAgent", conn.OriginalDestinationCID)
+	a.conn = conn
 	a.DecodedHeaders = NewBroadcaster(1000)
 	a.EncodedHeaders = NewBroadcaster(1000)
 	a.DecodeHeaders = make(chan EncodedHeaders, 1000)
 	a.EncodeHeaders = make(chan DecodedHeaders, 1000)
+	a.initEncoder = make(chan encoderSettings, 10)
 
 	incomingPackets := conn.IncomingPackets.RegisterNewChan(1000)
 
-	dynamicTableSize := uint(1024)
+	if !a.DisableStreams {
+		a.EncoderStreamID = conn.NewUniStreamID(a.EncoderStreamID)
+		a.DecoderStreamID = conn.NewUniStreamID(a.DecoderStreamID)
+	}
+	a.maxTableCapacity, a.maxBlockedStreams = 1024, 100
 	if a.DisableStreams {
-		dynamicTableSize = 0
+		a.maxTableCapacity, a.maxBlockedStreams = 0, 0
+	} else {
+		if a.MaxTableCapacity != nil {
+			a.maxTableCapacity = *a.MaxTableCapacity
+		}
+		if a.MaxBlockedStreams != nil {
+			a.maxBlockedStreams = *a.MaxBlockedStreams
+		}
 	}
 
-	a.encoder = ls_qpack_go.NewQPackEncoder(false)
-	a.decoder = ls_qpack_go.NewQPackDecoder(dynamicTableSize, 100)
+	a.encoder = qpack.NewEncoder()
+	a.decoder = qpack.NewDecoder(a.maxTableCapacity, a.maxBlockedStreams)
 
 	peerEncoderStreamId := QPACKNoStream
 	peerDecoderStreamId := QPACKNoStream
@@ -66,17 +95,19 @@ func (a *QPACKAgent) Run(conn *Connection) {
 
 	checkForDecodedHeaders := func() {
 		for _, dhb := range a.decoder.DecodedHeaderBlocks() {
-			if len(dhb.Headers()) > 0 {
-				headers := make([]HTTPHeader, len(dhb.Headers()))
-				for i, h := range dhb.Headers() {
-					headers[i] = HTTPHeader{h.Name, h.Value}
-				}
-				a.DecodedHeaders.Submit(DecodedHeaders{dhb.StreamID, headers})
-				if len(dhb.DecoderStream()) > 0 {
-					conn.Streams.Send(a.DecoderStreamID, dhb.DecoderStream(), false)
-				}
-				a.Logger.Printf("Submitted %d decoded headers on stream %d\n", len(headers), dhb.StreamID)
-			}
+			a.DecodedHeaders.Submit(DecodedHeaders{dhb.StreamID, dhb.Headers})
+			a.Logger.Printf("Submitted %d decoded headers on stream %d\n", len(dhb.Headers), dhb.StreamID)
+		}
+		if decoderStream := a.decoder.DecoderStream(); len(decoderStream) > 0 && !a.DisableStreams {
+			conn.Streams.Send(a.DecoderStreamID, decoderStream, false)
+			a.Logger.Printf("Enqueued %d bytes on the decoder stream\n", len(decoderStream))
+		}
+	}
+	failed := func(err error) {
+		a.Logger.Printf("QPACK failed: %s\n", err.Error())
+		var qpackError *qpack.Error
+		if errors.As(err, &qpackError) {
+			conn.CloseConnection(false, qpackError.Code, qpackError.Reason)
 		}
 	}
 
@@ -98,6 +129,7 @@ func (a *QPACKAgent) Run(conn *Connection) {
 							} else if qpackStreamType.Value == QPACKEncoderStreamValue {
 								if peerEncoderStreamId != QPACKNoStream {
 									a.Logger.Printf("Peer attempted to open another encoder stream on stream %d\n", s.StreamId)
+									conn.CloseConnection(false, http3.H3_STREAM_CREATION_ERROR, "second encoder stream")
 									continue
 								}
 								peerEncoderStreamId = s.StreamId
@@ -110,10 +142,10 @@ func (a *QPACKAgent) Run(conn *Connection) {
 							} else if qpackStreamType.Value == QPACKDecoderStreamValue {
 								if peerDecoderStreamId != QPACKNoStream {
 									a.Logger.Printf("Peer attempted to open another decoder stream on stream %d\n", s.StreamId)
+									conn.CloseConnection(false, http3.H3_STREAM_CREATION_ERROR, "second decoder stream")
 									continue
 								}
 								peerDecoderStreamId = s.StreamId
-								stream := conn.Streams.Get(peerEncoderStreamId)
 								a.Logger.Printf("Peer opened decoder stream on stream %d\n", s.StreamId)
 								if len(stream.ReadData) > qpackStreamType.Length {
 									peerDecoderStream <- stream.ReadData[qpackStreamType.Length:]
@@ -125,36 +157,40 @@ func (a *QPACKAgent) Run(conn *Connection) {
 						}
 					}
 				}
-			case i := <-peerEncoderStream:
+			case i, ok := <-peerEncoderStream:
+				if !ok {
+					a.Logger.Println("Peer closed its encoder stream")
+					conn.CloseConnection(false, http3.H3_CLOSED_CRITICAL_STREAM, "encoder stream was closed")
+					return
+				}
 				data := i.([]byte)
-				if a.decoder.EncoderIn(data) {
-					a.Logger.Printf("Decoder failed on encoder stream input\n")
+				if err := a.decoder.EncoderIn(data); err != nil {
+					failed(err)
 					return
 				}
 				a.Logger.Printf("Fed %d bytes from the encoder stream to the decoder\n", len(data))
 				checkForDecodedHeaders()
-			case i := <-peerDecoderStream:
+			case i, ok := <-peerDecoderStream:
+				if !ok {
+					a.Logger.Println("Peer closed its decoder stream")
+					conn.CloseConnection(false, http3.H3_CLOSED_CRITICAL_STREAM, "decoder stream was closed")
+					return
+				}
 				data := i.([]byte)
-				if a.encoder.DecoderIn(data) {
-					a.Logger.Printf("Encoder failed on decoder stream input\n")
+				if err := a.encoder.DecoderIn(data); err != nil {
+					failed(err)
 					return
 				}
 				a.Logger.Printf("Fed %d bytes from the decoder stream to the encoder\n", len(data))
 				checkForDecodedHeaders()
-			case e := <-a.EncodeHeaders:
-				if a.encoder.StartHeaderBlock(e.StreamID, /*TODO*/ 0) {
-					a.Logger.Printf("Encoder failed to start header block\n")
-					return
-				}
-				var encStream []byte
-				var encHeaders []byte
-				for _, h := range e.Headers {
-					es, eh := a.encoder.Encode(h.Name, h.Value)
-					encStream = append(encStream, es...)
-					encHeaders = append(encHeaders, eh...)
+			case s := <-a.initEncoder:
+				encStream := a.encoder.Init(s.maxTableCapacity, s.dynamicTableCapacity, s.maxBlockedStreams, s.opts)
+				a.Logger.Printf("Encoder initialized with MTC=%d, DTC=%d, MBS=%d and opts=%d\n", s.maxTableCapacity, s.dynamicTableCapacity, s.maxBlockedStreams, s.opts)
+				if len(encStream) > 0 {
+					conn.Streams.Send(a.EncoderStreamID, encStream, false)
 				}
-				hdp := a.encoder.EndHeaderBlock()
-				payload := append(hdp, encHeaders...)
+			case e := <-a.EncodeHeaders:
+				payload, encStream := a.encoder.Encode(e.StreamID, e.Headers)
 				a.EncodedHeaders.Submit(EncodedHeaders{e.StreamID, payload})
 				a.Logger.Printf("Encoded %d headers in %d bytes, with %d additional bytes on the encoder stream\n", len(e.Headers), len(payload), len(encStream))
 				if len(encStream) > 0 {
@@ -162,9 +198,9 @@ func (a *QPACKAgent) Run(conn *Connection) {
 					a.Logger.Printf("Enqueued %d bytes on the encoder stream\n", len(encStream))
 				}
 			case d := <-a.DecodeHeaders:
-				ret := a.decoder.HeaderIn(d.Headers, d.StreamID)
-				if ret < len(d.Headers) {
-					a.Logger.Printf("Decoder is blocked and waiting for encoder input before decoding the %d bytes remaining on stream %d\n", len(d.Headers) - ret, d.StreamID)
+				if err := a.decoder.HeaderIn(d.Headers, d.StreamID); err != nil {
+					failed(err)
+					return
 				}
 				checkForDecodedHeaders()
 			case <-a.close:
@@ -178,7 +214,14 @@ func (a *QPACKAgent) Run(conn *Connection) {
 		conn.Streams.Send(a.DecoderStreamID, []byte{QPACKDecoderStreamValue}, false)
 	}
 }
-func (a *QPACKAgent) InitEncoder(headerTableSize uint, dynamicTablesize uint, maxRiskedStreams uint, opts uint32) {
-	a.encoder.Init(headerTableSize, dynamicTablesize, maxRiskedStreams, opts)
-	a.Logger.Printf("Encoder initialized with HTS=%d, DTS=%d, MRS=%d and opts=%d\n", headerTableSize, dynamicTablesize, maxRiskedStreams, opts)
+// Initialises the encoder with the settings of the peer, see qpack.Encoder.Init.
+func (a *QPACKAgent) InitEncoder(maxTableCapacity uint64, dynamicTableCapacity uint64, maxBlockedStreams uint64, opts uint32) {
+	a.initEncoder <- encoderSettings{maxTableCapacity, dynamicTableCapacity, maxBlockedStreams, opts}
+}
+
+// Sends the given instructions on the encoder stream without applying them to the encoder. It allows sending
+// malformed instructions, built using the qpack.Append functions, to test the robustness of the peer decoder.
+func (a *QPACKAgent) SendEncoderInstructions(instructions []byte) {
+	a.conn.Streams.Send(a.EncoderStreamID, instructions, false)
+	a.Logger.Printf("Enqueued %d bytes of raw instructions on the encoder stream\n", len(instructions))
 }
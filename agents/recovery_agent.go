@@ -69,7 +69,7 @@ func (a *RecoveryAgent) Run(conn *Connection) {
 							a.Logger.Printf("Processing ACK_ECN frame in packet %s\n", p.ShortString())
 							ack = &frame.AckFrame
 						}
-						if ack.LargestAcknowledged > conn.LargestPNsAcknowledged[p.PNSpace()] {
+						if largest, ok := conn.LargestPNsAcknowledged[p.PNSpace()]; !ok || ack.LargestAcknowledged > largest {
 							conn.LargestPNsAcknowledged[p.PNSpace()] = ack.LargestAcknowledged
 						}
 						a.RetransmitBatch(a.ProcessAck(ack, p.PNSpace()))
@@ -116,11 +116,11 @@ func (a *RTTAgent) UpdateRTT(ackDelay uint64, ackOnly bool) { // TODO: https://t
 	a.conn.RTTVar = a.RTTVar
 
 	a.conn.QLogEvents <- a.conn.QLogTrace.NewEvent(qlog.Categories.Recovery.Category, qlog.Categories.Recovery.MetricsUpdated, qlog.MetricUpdate{
-		LatestRTT: a.LatestRTT / 1000,
-		MaxAckDelay: a.MaxAckDelay / 1000,
-		SmoothedRTT: a.conn.SmoothedRTT / 1000,
-		RTTVariance: a.conn.RTTVar / 1000,
-		MinRTT: a.conn.MinRTT / 1000,
+		LatestRTT: float64(a.LatestRTT) / 1000,
+		MaxAckDelay: float64(a.MaxAckDelay) / 1000,
+		SmoothedRTT: float64(a.conn.SmoothedRTT) / 1000,
+		RTTVariance: float64(a.conn.RTTVar) / 1000,
+		MinRTT: float64(a.conn.MinRTT) / 1000,
 	})
 
 	a.Logger.Printf("LatestRTT = %d, MinRTT = %d, SmoothedRTT = %d, RTTVar = %d", a.LatestRTT, a.MinRTT, a.SmoothedRTT, a.RTTVar)
@@ -10,19 +10,53 @@ import (
 // for a given encryption level are smaller than a given MTU, it will wait a window of 5ms before sending them in the hope
 // that more will be queued. Frames that require an unavailable encryption level are queued until it is made available.
 // It also merge the ACK frames inside a given packet before sending.
+//
+// Packets of different encryption levels can be coalesced in a single UDP datagram, either by requesting it through the
+// PrepareCoalescedPackets broadcaster of the connection, or for every packet prepared when CoalescePackets is set. The
+// packets are then filled within the MTU in the order of the encryption levels requested, or in the order Initial,
+// 0-RTT, Handshake and 1-RTT when CoalescePackets is set. As the length of a 1-RTT packet is not encoded in its short
+// header, a 1-RTT packet is always placed last. A datagram containing an Initial packet is padded to the
+// minimum size through its Initial packet. Unless DontCoalesceZeroRTT is set, 0-RTT
+// packets are also coalesced after the Initial packets sent directly.
+//
+// The MTU can be changed while the agent runs through UpdateMTU, e.g. when a larger PMTU is discovered.
 type SendingAgent struct {
 	BaseAgent
 	MTU                         uint16
+	UpdateMTU                   chan uint16
 	FrameProducer               []FrameProducer
 	FrameProducerLock           sync.Mutex
+	CoalescePackets             bool
 	DontCoalesceZeroRTT         bool
 	KeepDroppedEncryptionLevels bool
 }
 
+var coalescingOrder = []EncryptionLevel{EncryptionLevelInitial, EncryptionLevel0RTT, EncryptionLevelHandshake, EncryptionLevel1RTT}
+
+// Returns the encryption levels in the same order, except for 1-RTT which is moved last. A packet with a short header
+// extends to the end of the datagram, so no packet can follow it, see RFC 9000 Section 12.2.
+func shortHeaderLast(levels []EncryptionLevel) []EncryptionLevel {
+	var ordered []EncryptionLevel
+	shortHeader := false
+	for _, level := range levels {
+		if level == EncryptionLevel1RTT {
+			shortHeader = true
+		} else {
+			ordered = append(ordered, level)
+		}
+	}
+	if shortHeader {
+		ordered = append(ordered, EncryptionLevel1RTT)
+	}
+	return ordered
+}
+
 func (a *SendingAgent) Run(conn *Connection) {
 	a.Init("SendingAgent", conn.OriginalDestinationCID)
+	a.UpdateMTU = make(chan uint16, 10)
 
 	preparePacket := conn.PreparePacket.RegisterNewChan(100)
+	prepareCoalescedPackets := conn.PrepareCoalescedPackets.RegisterNewChan(100)
 	sendPacket := conn.SendPacket.RegisterNewChan(100)
 	elChan := conn.EncryptionLevels.RegisterNewChan(10)
 
@@ -39,8 +73,8 @@ func (a *SendingAgent) Run(conn *Connection) {
 
 	initialSent := false
 
-	fillPacket := func(packet Framer, level EncryptionLevel) Framer {
-		spaceLeft := int(a.MTU) - packet.GetHeader().HeaderLength() - conn.CryptoState(level).Write.Overhead()
+	fillPacket := func(packet Framer, level EncryptionLevel, maxSize int) Framer {
+		spaceLeft := maxSize - packet.GetHeader().HeaderLength() - conn.CryptoState(level).Write.Overhead()
 
 		a.FrameProducerLock.Lock()
 		addFrame:
@@ -80,6 +114,77 @@ func (a *SendingAgent) Run(conn *Connection) {
 		return packet
 	}
 
+	newPacket := func(level EncryptionLevel) Framer {
+		switch level {
+		case EncryptionLevelInitial:
+			return NewInitialPacket(conn)
+		case EncryptionLevelHandshake:
+			return NewHandshakePacket(conn)
+		case EncryptionLevel1RTT:
+			return NewProtectedPacket(conn)
+		case EncryptionLevel0RTT:
+			if initialSent {
+				return NewZeroRTTProtectedPacket(conn)
+			}
+		}
+		return nil
+	}
+
+	minimumInitialLength := func() int {
+		if conn.UseIPv6 {
+			return MinimumInitialLengthv6
+		}
+		return MinimumInitialLength
+	}
+
+	// Completes the given packets with a packet for each of the given encryption levels that is available and has
+	// frames to send, and sends them coalesced in a single UDP datagram. The packets follow the order of the encryption
+	// levels, except for the 1-RTT packet which is moved last, and an encryption level requested twice only produces
+	// one packet.
+	sendCoalesced := func(packets []Framer, packetLevels []EncryptionLevel, levels []EncryptionLevel) {
+		datagramSize := 0
+		coalesced := make(map[EncryptionLevel]bool)
+		for i, p := range packets {
+			datagramSize += len(conn.EncodeAndEncrypt(p, packetLevels[i]))
+			coalesced[packetLevels[i]] = true
+		}
+		for _, level := range shortHeaderLast(levels) {
+			if coalesced[level] {
+				continue
+			}
+			coalesced[level] = true
+			if !encryptionLevels[DirectionalEncryptionLevel{EncryptionLevel: level, Read: false, Available: true}] || conn.CryptoState(level) == nil {
+				continue
+			}
+			p := newPacket(level)
+			if p == nil {
+				continue
+			}
+			if p = fillPacket(p, level, int(a.MTU)-datagramSize); p == nil {
+				continue
+			}
+			datagramSize += len(conn.EncodeAndEncrypt(p, level))
+			packets = append(packets, p)
+			packetLevels = append(packetLevels, level)
+			if level == EncryptionLevelInitial {
+				initialSent = true
+			}
+		}
+		if len(packets) == 0 {
+			return
+		}
+
+		toSend := make([]Packet, len(packets))
+		for i, p := range packets {
+			if initial, ok := p.(*InitialPacket); ok {
+				initialSize := len(conn.EncodeAndEncrypt(initial, EncryptionLevelInitial))
+				initial.PadTo(minimumInitialLength() - (datagramSize - initialSize) - conn.CryptoState(EncryptionLevelInitial).Write.Overhead())
+			}
+			toSend[i] = p
+		}
+		conn.DoSendCoalescedPackets(toSend, packetLevels)
+	}
+
 	go func() {
 		defer a.Logger.Println("Agent terminated")
 		defer close(a.closed)
@@ -94,36 +199,32 @@ func (a *SendingAgent) Run(conn *Connection) {
 					a.Logger.Printf("Chose %s as new encryption level for %s\n", nEL, eL)
 					eL = nEL
 				}
-				if encryptionLevels[DirectionalEncryptionLevel{EncryptionLevel: eL, Read: false, Available: true}]  {
-					var p Packet
-					switch eL {
-					case EncryptionLevelInitial:
-						p = fillPacket(NewInitialPacket(conn), EncryptionLevelInitial)
-					case EncryptionLevelHandshake:
-						p = fillPacket(NewHandshakePacket(conn), EncryptionLevelHandshake)
-					case EncryptionLevel1RTT:
-						p = fillPacket(NewProtectedPacket(conn), EncryptionLevel1RTT)
-					case EncryptionLevel0RTT:
-						if initialSent {
-							p = fillPacket(NewZeroRTTProtectedPacket(conn), EncryptionLevel0RTT)
-						}
+				if a.CoalescePackets {
+					sendCoalesced(nil, nil, coalescingOrder)
+				} else if encryptionLevels[DirectionalEncryptionLevel{EncryptionLevel: eL, Read: false, Available: true}]  {
+					var p Framer
+					if p = newPacket(eL); p != nil {
+						p = fillPacket(p, eL, int(a.MTU))
 					}
 
 					if p != nil {
 						if eL == EncryptionLevelInitial {
-							var initialLength int
-							if conn.UseIPv6 {
-								initialLength = MinimumInitialLengthv6
-							} else {
-								initialLength = MinimumInitialLength
-							}
-							initialLength -= conn.CryptoState(EncryptionLevelInitial).Write.Overhead()
-							p.(*InitialPacket).PadTo(initialLength)
+							p.(*InitialPacket).PadTo(minimumInitialLength() - conn.CryptoState(EncryptionLevelInitial).Write.Overhead())
 							initialSent = true
 						}
 						conn.DoSendPacket(p, eL)
 					}
 				}
+			case i := <-prepareCoalescedPackets:
+				var levels []EncryptionLevel
+				for _, eL := range i.([]EncryptionLevel) {
+					if eL == EncryptionLevelBest || eL == EncryptionLevelBestAppData {
+						eL = chooseBestEncryptionLevel(encryptionLevels, eL == EncryptionLevelBestAppData)
+					}
+					levels = append(levels, eL)
+				}
+				a.Logger.Printf("Coalescing packets for encryption levels %v\n", levels)
+				sendCoalesced(nil, nil, levels)
 			case i := <-elChan:
 				dEL := i.(DirectionalEncryptionLevel)
 				if dEL.Read {
@@ -144,39 +245,25 @@ func (a *SendingAgent) Run(conn *Connection) {
 				p := i.(PacketToSend)
 				if p.EncryptionLevel == EncryptionLevelInitial && p.Packet.GetHeader().GetPacketType() == Initial {
 					initial := p.Packet.(*InitialPacket)
+					initialSent = true
 					if !a.DontCoalesceZeroRTT && bestEncryptionLevels[EncryptionLevelBestAppData] == EncryptionLevel0RTT {
-						// Try to prepare a 0-RTT packet and squeeze it after the Initial
-						zp := NewZeroRTTProtectedPacket(conn)
-						fillPacket(zp, EncryptionLevel0RTT)
-						if len(zp.GetFrames()) > 0 {
-							zpBytes := conn.EncodeAndEncrypt(zp, EncryptionLevel0RTT)
-							initialFrames := initial.GetFrames()
-							initialLength := len(conn.EncodeAndEncrypt(initial, EncryptionLevelInitial))
-							initial.Frames = nil
-							for _, f := range initialFrames {
-								if f.FrameType() != PaddingFrameType {
-									initial.Frames = append(initial.Frames, f)
-								}
+						// Try to squeeze a 0-RTT packet after the Initial, which is padded afterwards
+						initialFrames := initial.GetFrames()
+						initial.Frames = nil
+						for _, f := range initialFrames {
+							if f.FrameType() != PaddingFrameType {
+								initial.Frames = append(initial.Frames, f)
 							}
-							initial.PadTo(initialLength - len(zpBytes))
-							coalescedPackets := append(conn.EncodeAndEncrypt(initial, EncryptionLevelInitial), zpBytes...)
-							conn.UdpConnection.Write(coalescedPackets)
-							conn.PacketWasSent(initial)
-							conn.PacketWasSent(zp)
-							continue
 						}
+						sendCoalesced([]Framer{initial}, []EncryptionLevel{EncryptionLevelInitial}, []EncryptionLevel{EncryptionLevel0RTT})
+						continue
 					}
-					var initialLength int
-					if conn.UseIPv6 {
-						initialLength = MinimumInitialLengthv6
-					} else {
-						initialLength = MinimumInitialLength
-					}
-					initialLength -= conn.CryptoState(EncryptionLevelInitial).Write.Overhead()
-					initial.PadTo(initialLength)
-					initialSent = true
+					initial.PadTo(minimumInitialLength() - conn.CryptoState(EncryptionLevelInitial).Write.Overhead())
 				}
 				conn.DoSendPacket(p.Packet, p.EncryptionLevel)
+			case mtu := <-a.UpdateMTU:
+				a.Logger.Printf("MTU changed from %d to %d\n", a.MTU, mtu)
+				a.MTU = mtu
 			case <-a.close:
 				return
 			}
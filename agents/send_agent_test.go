@@ -0,0 +1,25 @@
+package agents
+
+import (
+	"reflect"
+	"testing"
+
+	. "github.com/PROGNOSISTool/adapter-quic"
+)
+
+func TestShortHeaderLast(t *testing.T) {
+	tests := []struct {
+		levels   []EncryptionLevel
+		expected []EncryptionLevel
+	}{
+		{[]EncryptionLevel{EncryptionLevelHandshake, EncryptionLevelInitial}, []EncryptionLevel{EncryptionLevelHandshake, EncryptionLevelInitial}},
+		{[]EncryptionLevel{EncryptionLevel1RTT, EncryptionLevelHandshake}, []EncryptionLevel{EncryptionLevelHandshake, EncryptionLevel1RTT}},
+		{[]EncryptionLevel{EncryptionLevel1RTT, EncryptionLevelHandshake, EncryptionLevel1RTT, EncryptionLevelInitial}, []EncryptionLevel{EncryptionLevelHandshake, EncryptionLevelInitial, EncryptionLevel1RTT}},
+		{[]EncryptionLevel{EncryptionLevel1RTT}, []EncryptionLevel{EncryptionLevel1RTT}},
+	}
+	for _, test := range tests {
+		if ordered := shortHeaderLast(test.levels); !reflect.DeepEqual(ordered, test.expected) {
+			t.Errorf("shortHeaderLast(%v) = %v, expected %v", test.levels, ordered, test.expected)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package agents
+
+import (
+	"bytes"
+
+	. "github.com/PROGNOSISTool/adapter-quic"
+)
+
+// The SessionStoreAgent saves the state needed to resume a connection with the server in a SessionStore, i.e. the TLS
+// session tickets delivered by the TLSAgent, the server transport parameters and the tokens received in NEW_TOKEN
+// frames. It uses DefaultSessionStore when Store is not set, and does nothing when neither is set.
+type SessionStoreAgent struct {
+	BaseAgent
+	TLSAgent *TLSAgent
+	Store    *SessionStore
+}
+
+func (a *SessionStoreAgent) Run(conn *Connection) {
+	a.Init("SessionStoreAgent", conn.OriginalDestinationCID)
+	if a.Store == nil {
+		a.Store = DefaultSessionStore
+	}
+
+	incomingPackets := conn.IncomingPackets.RegisterNewChan(1000)
+	tpReceived := conn.TransportParameters.RegisterNewChan(10)
+	ticketReceived := a.TLSAgent.ResumptionTicket.RegisterNewChan(10)
+
+	go func() {
+		defer a.Logger.Println("Agent terminated")
+		defer close(a.closed)
+
+		var savedTicket []byte
+		for {
+			select {
+			case i := <-incomingPackets:
+				if a.Store == nil {
+					continue
+				}
+				if p, ok := i.(Framer); ok {
+					for _, f := range p.GetAll(NewTokenType) {
+						token := f.(*NewTokenFrame).Token
+						if err := a.Store.SaveToken(conn, token); err != nil {
+							a.Logger.Println("Failed to save token:", err.Error())
+						}
+					}
+				}
+			case i := <-ticketReceived:
+				ticket := i.([]byte)
+				if a.Store == nil || bytes.Equal(ticket, savedTicket) {
+					continue
+				}
+				savedTicket = append([]byte{}, ticket...)
+				if err := a.Store.SaveResumptionTicket(conn, savedTicket); err != nil {
+					a.Logger.Println("Failed to save resumption ticket:", err.Error())
+				} else {
+					a.Logger.Printf("Saved a %d-byte resumption ticket\n", len(savedTicket))
+				}
+			case i := <-tpReceived:
+				if a.Store == nil {
+					continue
+				}
+				if err := a.Store.SaveTransportParameters(conn, i.(QuicTransportParameters)); err != nil {
+					a.Logger.Println("Failed to save transport parameters:", err.Error())
+				}
+			case <-a.close:
+				return
+			}
+		}
+	}()
+}
@@ -8,6 +8,7 @@ import (
 
 	. "github.com/PROGNOSISTool/adapter-quic"
 	"github.com/PROGNOSISTool/adapter-quic/compat"
+	"github.com/PROGNOSISTool/adapter-quic/qlog"
 )
 
 // The SocketAgent is responsible for receiving the UDP payloads off the socket and putting them in the decryption queue.
@@ -65,6 +66,9 @@ func (a *SocketAgent) Run(conn *Connection) {
 			a.TotalDataReceived += i
 			a.DatagramsReceived += 1
 			a.Logger.Printf("Received %d bytes from UDP socket\n", i)
+			e := conn.QLogTrace.NewEvent(qlog.Categories.Transport.Category, qlog.Categories.Transport.DatagramsReceived, qlog.Datagrams{Count: 1, Raw: []qlog.RawInfo{{Length: uint64(i)}}})
+			e.RelativeTime = uint64(sm.Timestamp.Sub(conn.QLogTrace.ReferenceTime) / qlog.TimeUnits)
+			conn.QLogEvents <- e
 			select {
 			case <-recChan:
 				return
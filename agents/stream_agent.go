@@ -1,11 +1,16 @@
 package agents
 
 import (
+	"context"
 	"errors"
 
 	. "github.com/PROGNOSISTool/adapter-quic"
 )
 
+// The StreamAgent is responsible of sending the data submitted to the streams and of keeping their sending state up to
+// date. It also logs the frames of the peer that violate the state of their stream.
+//
+// It offers an io.ReadWriteCloser over the streams, see OpenStream, OpenUniStream and AcceptStream.
 type StreamAgent struct {
 	FrameProducingAgent
 	conn                 *Connection
@@ -15,6 +20,9 @@ type StreamAgent struct {
 	streamClosing        map[uint64]bool
 	SendFromQueue		 chan FrameRequest
 	DisableFrameSending  bool
+	terminalFrames       map[PacketNumber][]Frame
+	nextPeerStreamIds    map[StreamsType]uint64
+	acceptedStreams      chan uint64
 }
 
 func (a *StreamAgent) Run(conn *Connection) {
@@ -25,6 +33,14 @@ func (a *StreamAgent) Run(conn *Connection) {
 	a.streamBuffers = make(map[uint64][]byte)
 	a.streamClosing = make(map[uint64]bool)
 	a.SendFromQueue = make(chan FrameRequest, 100)
+	a.terminalFrames = make(map[PacketNumber][]Frame)
+	a.nextPeerStreamIds = map[StreamsType]uint64{BidiStreams: 1, UniStreams: 3}
+	a.acceptedStreams = make(chan uint64, 1000)
+
+	outgoingPackets := conn.OutgoingPackets.RegisterNewChan(1000)
+	packetsAcknowledged := conn.PacketAcknowledged.RegisterNewChan(1000)
+	violations := conn.StreamViolations.RegisterNewChan(1000)
+	incomingPackets := conn.IncomingPackets.RegisterNewChan(1000)
 
 	go func() {
 		defer a.Logger.Println("Agent terminated")
@@ -72,6 +88,27 @@ func (a *StreamAgent) Run(conn *Connection) {
 					}
 				}
 				a.frames <- frames
+			case i := <-outgoingPackets:
+				if p, ok := i.(Framer); ok && p.PNSpace() == PNSpaceAppData {
+					a.trackTerminalFrames(p)
+				}
+			case i := <-packetsAcknowledged:
+				if pa := i.(PacketAcknowledged); pa.PNSpace == PNSpaceAppData {
+					a.terminalFramesAcknowledged(pa.PacketNumber)
+				}
+			case i := <-incomingPackets:
+				if p, ok := i.(Framer); ok && p.PNSpace() == PNSpaceAppData {
+					for _, f := range p.GetFrames() {
+						switch frame := f.(type) {
+						case *StreamFrame:
+							a.peerStreamOpened(frame.StreamId)
+						case *ResetStream:
+							a.peerStreamOpened(frame.StreamId)
+						}
+					}
+				}
+			case i := <-violations:
+				a.Logger.Printf("Peer violated the stream state: %s\n", i.(StreamViolation).Error())
 			case fr := <-a.SendFromQueue:
                 for _, qf := range conn.StreamQueue[fr] {
 					conn.FrameQueue.Submit(qf)
@@ -91,6 +128,7 @@ func (a *StreamAgent) close(streamId uint64) error {
 			return errors.New("cannot close already closed stream")
 		}
 		s.WriteCloseOffset = s.WriteOffset
+		a.conn.Streams.SetSendState(streamId, SendStateDataSent)
 		a.SubmitFrame(QueuedFrame{NewStreamFrame(streamId, s.WriteOffset, nil, true), EncryptionLevelBestAppData})
 		return nil
 	}
@@ -105,6 +143,7 @@ func (a *StreamAgent) reset(streamId uint64, appErrorCode uint64) error {
 		}
 		s.WriteCloseOffset = s.WriteOffset
 		s.WriteClosed = true
+		a.conn.Streams.SetSendState(streamId, SendStateResetSent)
 		a.SubmitFrame(QueuedFrame{&ResetStream{streamId, appErrorCode, s.WriteOffset}, EncryptionLevelBestAppData})
 		return nil
 	}
@@ -130,8 +169,10 @@ func (a *StreamAgent) send(streamId uint64, data []byte, close bool) error {
 	}
 	s.WriteOffset += uint64(len(data))
 	s.WriteClosed = close
+	a.conn.Streams.SetSendState(streamId, SendStateSend)
 	if s.WriteClosed {
 		s.WriteCloseOffset = s.WriteOffset
+		a.conn.Streams.SetSendState(streamId, SendStateDataSent)
 	}
 
 	if close {
@@ -162,6 +203,76 @@ func (a *StreamAgent) send(streamId uint64, data []byte, close bool) error {
 	return nil
 }
 
+// Opens a new bidirectional stream. The stream is announced to the peer when data is first written.
+func (a *StreamAgent) OpenStream() *StreamHandle {
+	return newStreamHandle(a, a.conn.NewBidiStreamID())
+}
+
+// Opens a new unidirectional stream. The stream is announced to the peer when data is first written.
+func (a *StreamAgent) OpenUniStream() *StreamHandle {
+	return newStreamHandle(a, a.conn.NewUniStreamID(0))
+}
+
+// Returns the next stream opened by the peer, either bidirectional or unidirectional, in the order they were opened. It
+// blocks until such a stream is opened or the context is done.
+func (a *StreamAgent) AcceptStream(ctx context.Context) (*StreamHandle, error) {
+	select {
+	case streamId := <-a.acceptedStreams:
+		return newStreamHandle(a, streamId), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-a.BaseAgent.close:
+		return nil, errStreamAgentTerminated
+	}
+}
+
+// Queues the streams of the peer to be accepted. Opening a stream implicitly opens the streams of the same type with
+// lower identifiers.
+func (a *StreamAgent) peerStreamOpened(streamId uint64) {
+	if !IsServer(streamId) {
+		return
+	}
+	streamsType := StreamsType(IsUni(streamId))
+	for ; a.nextPeerStreamIds[streamsType] <= streamId; a.nextPeerStreamIds[streamsType] += 4 {
+		select {
+		case a.acceptedStreams <- a.nextPeerStreamIds[streamsType]:
+		default:
+			a.Logger.Printf("Too many streams waiting to be accepted, dropping stream %d\n", a.nextPeerStreamIds[streamsType])
+		}
+	}
+}
+
+// Remembers the STREAM frames carrying a FIN bit and the RESET_STREAM frames of the packet, so that the sending state of
+// their streams can progress when the packet is acknowledged.
+func (a *StreamAgent) trackTerminalFrames(p Framer) {
+	var frames []Frame
+	for _, f := range p.GetAll(StreamType) {
+		if f.(*StreamFrame).FinBit {
+			frames = append(frames, f)
+		}
+	}
+	frames = append(frames, p.GetAll(ResetStreamType)...)
+	if len(frames) > 0 {
+		a.terminalFrames[p.GetHeader().GetPacketNumber()] = frames
+	}
+}
+
+// Moves the streams to the Data Recvd or Reset Recvd state. The acknowledgement of the FIN bit is used as a proxy for
+// the acknowledgement of all the stream data, as frames are not tracked individually.
+func (a *StreamAgent) terminalFramesAcknowledged(pn PacketNumber) {
+	for _, f := range a.terminalFrames[pn] {
+		switch frame := f.(type) {
+		case *StreamFrame:
+			if s := a.conn.Streams.Get(frame.StreamId); s.SendState == SendStateDataSent {
+				a.conn.Streams.SetSendState(frame.StreamId, SendStateDataRecvd)
+			}
+		case *ResetStream:
+			a.conn.Streams.SetSendState(frame.StreamId, SendStateResetRecvd)
+		}
+	}
+	delete(a.terminalFrames, pn)
+}
+
 // TODO: This is a common pattern in FrameProducingAgents. Should probably move this method to that type.
 func (a *StreamAgent) SubmitFrame(frame QueuedFrame) {
 	if a.DisableFrameSending {
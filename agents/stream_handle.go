@@ -0,0 +1,221 @@
+package agents
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	. "github.com/PROGNOSISTool/adapter-quic"
+)
+
+var (
+	errStreamAgentTerminated = errors.New("stream agent terminated")
+	errWriteClosed           = errors.New("write on closed stream")
+)
+
+// A StreamError reports that a stream was abruptly terminated, either by the peer with a RESET_STREAM or a STOP_SENDING
+// frame, or locally with CancelRead or CancelWrite.
+type StreamError struct {
+	StreamId  uint64
+	ErrorCode uint64
+	Remote    bool
+}
+
+func (e *StreamError) Error() string {
+	who := "locally"
+	if e.Remote {
+		who = "by the peer"
+	}
+	return fmt.Sprintf("stream %d was canceled %s with error code 0x%x", e.StreamId, who, e.ErrorCode)
+}
+
+// A StreamHandle gives access to a stream of the connection through the io.Reader, io.Writer and io.Closer interfaces.
+// The data written is sent by the StreamAgent within the credit reserved from the FlowControlAgent, Write blocks while
+// the peer limits are reached. Read returns the data as it is received in order and io.EOF once the peer finished the
+// stream. Handles are obtained with the OpenStream, OpenUniStream and AcceptStream methods of the StreamAgent.
+//
+// A handle supports one reader and one writer at a time. The deadlines behave as those of net.Conn.
+type StreamHandle struct {
+	streamId uint64
+	stream   *Stream
+	agent    *StreamAgent
+
+	readOffset uint64 // Only accessed by the reader
+
+	lock            sync.Mutex
+	readCanceled    bool
+	readErrorCode   uint64
+	writeClosed     bool
+	readDeadline    time.Time
+	writeDeadline   time.Time
+	deadlineChanged chan struct{}
+}
+
+func newStreamHandle(agent *StreamAgent, streamId uint64) *StreamHandle {
+	return &StreamHandle{streamId: streamId, stream: agent.conn.Streams.Get(streamId), agent: agent, deadlineChanged: make(chan struct{})}
+}
+
+func (h *StreamHandle) StreamId() uint64 { return h.streamId }
+
+func (h *StreamHandle) Read(p []byte) (int, error) {
+	if IsUniClient(h.streamId) {
+		return 0, fmt.Errorf("stream %d is send-only", h.streamId)
+	}
+	for {
+		h.lock.Lock()
+		canceled, errorCode, deadline, deadlineChanged := h.readCanceled, h.readErrorCode, h.readDeadline, h.deadlineChanged
+		h.lock.Unlock()
+		if canceled {
+			return 0, &StreamError{h.streamId, errorCode, false}
+		}
+		if errorCode, reset := h.stream.ResetReceived(); reset {
+			return 0, &StreamError{h.streamId, errorCode, true}
+		}
+
+		data, fin, dataReceived := h.stream.ReceivedData(h.readOffset, len(p))
+		if len(data) > 0 || fin {
+			n := copy(p, data)
+			h.readOffset += uint64(n)
+			if fin {
+				return n, io.EOF
+			}
+			return n, nil
+		}
+		if err := h.wait(dataReceived, deadline, deadlineChanged); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (h *StreamHandle) Write(p []byte) (int, error) {
+	if IsUniServer(h.streamId) {
+		return 0, fmt.Errorf("stream %d is receive-only", h.streamId)
+	}
+	fc := h.agent.FlowControlAgent
+	written := 0
+	for written < len(p) {
+		h.lock.Lock()
+		closed, deadline, deadlineChanged := h.writeClosed, h.writeDeadline, h.deadlineChanged
+		h.lock.Unlock()
+		if closed {
+			return written, errWriteClosed
+		}
+		if errorCode, stopped := h.stream.StopSendingReceived(); stopped {
+			return written, &StreamError{h.streamId, errorCode, true}
+		}
+
+		credit := uint64(len(p) - written)
+		var creditUpdated <-chan struct{}
+		if fc != nil {
+			creditUpdated = fc.CreditUpdated() // Obtained before the reservation so that no update is missed
+			credit = fc.ReserveAtMost(h.streamId, credit)
+		}
+		if credit > 0 {
+			data := append([]byte{}, p[written:written+int(credit)]...)
+			h.agent.conn.Streams.Send(h.streamId, data, false)
+			written += int(credit)
+			continue
+		}
+		if err := h.wait(creditUpdated, deadline, deadlineChanged); err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Closes the sending part of the stream, i.e. sends a FIN bit after the data written. It does not affect the receiving
+// part of the stream, see CancelRead.
+func (h *StreamHandle) Close() error {
+	if IsUniServer(h.streamId) {
+		return fmt.Errorf("stream %d is receive-only", h.streamId)
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.writeClosed {
+		return nil
+	}
+	h.writeClosed = true
+	h.agent.conn.Streams.Close(h.streamId)
+	return nil
+}
+
+// Abruptly terminates the sending part of the stream with a RESET_STREAM frame.
+func (h *StreamHandle) CancelWrite(errorCode uint64) error {
+	if IsUniServer(h.streamId) {
+		return fmt.Errorf("stream %d is receive-only", h.streamId)
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.writeClosed = true
+	h.agent.conn.Streams.Reset(h.streamId, errorCode)
+	return nil
+}
+
+// Asks the peer to stop sending on the stream with a STOP_SENDING frame. Subsequent reads fail.
+func (h *StreamHandle) CancelRead(errorCode uint64) error {
+	if IsUniClient(h.streamId) {
+		return fmt.Errorf("stream %d is send-only", h.streamId)
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if !h.readCanceled {
+		h.readCanceled, h.readErrorCode = true, errorCode
+		h.agent.conn.Streams.StopSending(h.streamId, errorCode)
+	}
+	return nil
+}
+
+func (h *StreamHandle) SetDeadline(t time.Time) error {
+	h.setDeadlines(&t, &t)
+	return nil
+}
+
+func (h *StreamHandle) SetReadDeadline(t time.Time) error {
+	h.setDeadlines(&t, nil)
+	return nil
+}
+
+func (h *StreamHandle) SetWriteDeadline(t time.Time) error {
+	h.setDeadlines(nil, &t)
+	return nil
+}
+
+func (h *StreamHandle) setDeadlines(read *time.Time, write *time.Time) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if read != nil {
+		h.readDeadline = *read
+	}
+	if write != nil {
+		h.writeDeadline = *write
+	}
+	close(h.deadlineChanged) // Wakes up the blocked calls so that they consider the new deadlines
+	h.deadlineChanged = make(chan struct{})
+}
+
+// Waits for the event to happen. It returns nil when the call should be retried.
+func (h *StreamHandle) wait(event <-chan struct{}, deadline time.Time, deadlineChanged <-chan struct{}) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-event:
+		return nil
+	case <-deadlineChanged:
+		return nil
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	case <-h.agent.BaseAgent.close:
+		return errStreamAgentTerminated
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -8,11 +9,13 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/exec"
 	"strings"
 	"time"
 
 	qt "github.com/PROGNOSISTool/adapter-quic"
 	"github.com/PROGNOSISTool/adapter-quic/agents"
+	"github.com/PROGNOSISTool/adapter-quic/client"
 	"github.com/davecgh/go-spew/spew"
 )
 
@@ -25,34 +28,32 @@ func main() {
 	useIPv6 := flag.Bool("6", false, "Use IPV6")
 	path := flag.String("path", "/index.html", "The path to request")
 	alpn := flag.String("alpn", "hq", "The ALPN prefix to use when connecting ot the endpoint.")
-	qlog := flag.String("qlog", "", "The file to write the qlog output to.")
+	qlog := flag.String("qlog", "", "The file to write the qlog output to. A file ending with .sqlog is written as the connection progresses.")
 	netInterface := flag.String("interface", "", "The interface to listen to when capturing pcap")
 	timeout := flag.Int("timeout", 10, "The number of seconds after which the program will timeout")
 	h3 := flag.Bool("3", false, "Use HTTP/3 instead of HTTP/0.9")
+	sessionStore := flag.String("session-store", "", "The file to load and save session tickets, transport parameters and tokens from, enabling resumption and 0-RTT across runs.")
 	flag.Parse()
 
-	t := time.NewTimer(time.Duration(*timeout) * time.Second)
-	conn, err := qt.NewDefaultConnection(*address, (*address)[:strings.LastIndex(*address, ":")], nil, *useIPv6, *alpn, *h3)
-	if err != nil {
-		panic(err)
-	}
-	defer conn.Close()
-	conn.QLog.Title = fmt.Sprintf("QUIC-Tracker HTTP GET %s%s", *address, *path)
-
-	if *h3 {
-		conn.TLSTPHandler.MaxUniStreams = 3
-	}
-
-	pcap, err := qt.StartPcapCapture(conn, *netInterface)
-	if err != nil {
-		panic(err)
+	if *sessionStore != "" {
+		store, err := qt.OpenSessionStore(*sessionStore)
+		if err != nil {
+			panic(err)
+		}
+		qt.DefaultSessionStore = store
 	}
 
+	t := time.NewTimer(time.Duration(*timeout) * time.Second)
+	var conn *qt.Connection
+	var pcap *exec.Cmd
+	var qlogFile *os.File
 	trace := qt.NewTrace("http_get", 1, *address)
-	trace.AttachTo(conn)
 	defer func() {
+		if conn == nil {
+			return
+		}
 		trace.Complete(conn)
-		err = trace.AddPcap(conn, pcap)
+		err := trace.AddPcap(conn, pcap)
 		if err != nil {
 			trace.Results["pcap_error"] = err.Error()
 		}
@@ -66,31 +67,50 @@ func main() {
 		println(string(out))
 	}()
 
-	Agents := agents.AttachAgentsToConnection(conn, agents.GetDefaultAgents()...)
-	handshakeAgent := &agents.HandshakeAgent{TLSAgent: Agents.Get("TLSAgent").(*agents.TLSAgent), SocketAgent: Agents.Get("SocketAgent").(*agents.SocketAgent)}
-	Agents.Add(handshakeAgent)
-	Agents.Get("SendingAgent").(*agents.SendingAgent).FrameProducer = Agents.GetFrameProducingAgents()
-
-	handshakeStatus := make(chan interface{}, 10)
-	handshakeAgent.HandshakeStatus.Register(handshakeStatus)
-	handshakeAgent.InitiateHandshake()
-
-	select {
-	case i := <-handshakeStatus:
-		s := i.(agents.HandshakeStatus)
-		if !s.Completed {
-			Agents.StopAll()
-			return
-		}
-	case <-t.C:
-		Agents.StopAll()
+	config := &client.Config{
+		ServerName:       (*address)[:strings.LastIndex(*address, ":")],
+		ALPN:             *alpn,
+		HTTP3:            *h3,
+		UseIPv6:          *useIPv6,
+		HandshakeTimeout: time.Duration(*timeout) * time.Second,
+		Prepare: func(c *qt.Connection) {
+			conn = c
+			conn.QLog.Title = fmt.Sprintf("QUIC-Tracker HTTP GET %s%s", *address, *path)
+			if strings.HasSuffix(*qlog, ".sqlog") {
+				var err error
+				qlogFile, err = os.OpenFile(*qlog, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+				if err == nil {
+					err = conn.QLog.StreamTo(qlogFile, conn.QLogTrace)
+				}
+				if err != nil {
+					println("Unable to stream the qlog output", err.Error())
+				}
+			}
+			if *h3 {
+				conn.TLSTPHandler.MaxUniStreams = 3
+			}
+			var err error
+			pcap, err = qt.StartPcapCapture(conn, *netInterface)
+			if err != nil {
+				panic(err)
+			}
+			trace.AttachTo(conn)
+		},
+	}
+	c, err := client.Dial(context.Background(), *address, config)
+	if err != nil {
+		println(err.Error())
 		return
 	}
+	Agents := c.Agents
+	defer conn.Close()
 
 	defer func() {
 		conn.QLogTrace.Sort()
 		trace.QLog = conn.QLog
-		if *qlog != "" {
+		if qlogFile != nil {
+			qlogFile.Close()
+		} else if *qlog != "" {
 			outFile, err := os.OpenFile(*qlog, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
 			if err == nil {
 				content, err := json.Marshal(conn.QLog)
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PROGNOSISTool/adapter-quic/qlog"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s file.qlog|file.sqlog...\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Prints a summary of each trace of the given qlog files.")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, filename := range flag.Args() {
+		if err := summarize(filename); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", filename, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func summarize(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	q, err := qlog.Read(file)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: %s (qlog %s, %s)\n", filename, q.Title, q.Version, q.Format)
+	for i, t := range q.Traces {
+		fmt.Printf("  Trace %d: %s %s %s\n", i, t.VantagePoint.Type, t.VantagePoint.Name, t.Description)
+		fmt.Printf("    Events: %d\n", len(t.Events))
+
+		if d, ok := t.HandshakeDuration(); ok {
+			fmt.Printf("    Handshake duration: %v\n", d.Round(time.Microsecond))
+		} else {
+			fmt.Println("    Handshake duration: not completed")
+		}
+
+		if series := t.RTTSeries(); len(series) > 0 {
+			last := series[len(series)-1]
+			fmt.Printf("    RTT: %d samples, last latest %.3fms, smoothed %.3fms, min %.3fms, variance %.3fms\n", len(series), last.LatestRTT, last.SmoothedRTT, last.MinRTT, last.RTTVariance)
+		} else {
+			fmt.Println("    RTT: no samples")
+		}
+
+		r := t.RetransmissionCounts()
+		fmt.Printf("    Packets lost: %d%s\n", r.PacketsLost, formatCounts(r.LostByPacketType, " (", ")"))
+		fmt.Printf("    Frames retransmitted: %d (%d bytes)\n", r.FramesRetransmitted, r.BytesRetransmitted)
+
+		h := t.FrameHistogram()
+		fmt.Printf("    Frames sent: %s\n", formatCounts(h.Sent, "", ""))
+		fmt.Printf("    Frames received: %s\n", formatCounts(h.Received, "", ""))
+	}
+	return nil
+}
+
+// Formats the counts sorted by key, e.g. "ack: 2, crypto: 1", between the given prefix and suffix. It returns an empty
+// string when there are no counts.
+func formatCounts(counts map[string]int, prefix string, suffix string) string {
+	if len(counts) == 0 {
+		return ""
+	}
+	var keys []string
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var entries []string
+	for _, k := range keys {
+		entries = append(entries, fmt.Sprintf("%s: %d", k, counts[k]))
+	}
+	return prefix + strings.Join(entries, ", ") + suffix
+}
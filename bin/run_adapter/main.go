@@ -12,6 +12,11 @@ import (
 func main() {
     config := adapter.GetConfig("config.yaml")
 
+    if config.HTTP3Alphabet {
+        runHTTP3Adapter(config)
+        return
+    }
+
     sulAdapter, err := adapter.NewAdapter(
         config.AdapterAddress,
         config.SulAddress,
@@ -19,9 +24,14 @@ func main() {
         config.HTTP3,
         config.HttpPath,
         config.Tracing,
-        config.WaitTime)
+        config.WaitTime,
+        config.ResumptionPolicy,
+        config.Grease,
+        config.Datagrams,
+        config.AckFrequency)
     if err != nil {
-        fmt.Printf("Failed to create Adapter: %v", err.Error())
+        fmt.Printf("Failed to create Adapter: %v\n", err.Error())
+        os.Exit(1)
     }
 
 	SetupCloseHandler(sulAdapter)
@@ -36,7 +46,28 @@ func main() {
 	sulAdapter.Run()
 }
 
-func SetupCloseHandler(adapter *adapter.Adapter) {
+func runHTTP3Adapter(config *adapter.Config) {
+	sulAdapter := adapter.NewHTTP3Adapter(
+		config.AdapterAddress,
+		config.SulAddress,
+		config.SulName,
+		config.HttpPath,
+		config.Tracing,
+		config.WaitTime)
+
+	SetupCloseHandler(sulAdapter)
+	defer func() {
+		if err := recover(); err != nil {
+			sulAdapter.Logger.Printf("Panic detected: %v", err)
+			sulAdapter.Stop()
+			os.Exit(1)
+		}
+	}()
+
+	sulAdapter.Run()
+}
+
+func SetupCloseHandler(adapter interface{ Stop() }) {
 	c := make(chan os.Signal)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
@@ -18,11 +18,12 @@ func main() {
 	alpn := flag.String("alpn", "hq", "The ALPN prefix to use when connecting ot the endpoint.")
 	scenarioName := flag.String("scenario", "", "The particular scenario to run.")
 	outputFile := flag.String("output", "", "The file to write the output to. Output to stdout if not set.")
-	qlog := flag.String("qlog", "", "The file to write the qlog output to.")
+	qlog := flag.String("qlog", "", "The file to write the qlog output to. A file ending with .sqlog is written as the connection progresses.")
 	debug := flag.Bool("debug", false, "Enables debugging information to be printed.")
 	nopcap := flag.Bool("nopcap", false, "Disables the pcap capture.")
 	netInterface := flag.String("interface", "", "The interface to listen to when capturing pcap.")
 	timeout := flag.Int("timeout", 10, "The amount of time in seconds spent when completing the test. Defaults to 10. When set to 0, the test ends as soon as possible.")
+	sessionStore := flag.String("session-store", "", "The file to load and save session tickets, transport parameters and tokens from, enabling resumption and 0-RTT across runs.")
 	flag.Parse()
 
 	if *host == "" || *path == "" || *scenarioName == "" {
@@ -38,11 +39,31 @@ func main() {
 
 	trace := qt.NewTrace(scenario.Name(), scenario.Version(), *host)
 
+	if *sessionStore != "" {
+		store, err := qt.OpenSessionStore(*sessionStore)
+		if err != nil {
+			println("Unable to open session store", err.Error())
+			os.Exit(-1)
+		}
+		qt.DefaultSessionStore = store
+	}
+
 	conn, err := qt.NewDefaultConnection(*host, strings.Split(*host, ":")[0], nil, scenario.IPv6(), *alpn, scenario.HTTP3()) // Raw IPv6 are not handled correctly
 
 	if err == nil {
 		conn.QLog.Title = "QUIC-Tracker scenario " + *scenarioName
 
+		var qlogFile *os.File
+		if strings.HasSuffix(*qlog, ".sqlog") {
+			qlogFile, err = os.OpenFile(*qlog, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+			if err == nil {
+				err = conn.QLog.StreamTo(qlogFile, conn.QLogTrace)
+			}
+			if err != nil {
+				println("Unable to stream the qlog output", err.Error())
+			}
+		}
+
 		var pcap *exec.Cmd
 		if !*nopcap {
 			pcap, err = qt.StartPcapCapture(conn, *netInterface)
@@ -72,7 +93,9 @@ func main() {
 
 		conn.QLogTrace.Sort()
 		trace.QLog = conn.QLog
-		if *qlog != "" {
+		if qlogFile != nil {
+			qlogFile.Close()
+		} else if *qlog != "" {
 			outFile, err := os.OpenFile(*qlog, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
 			if err == nil {
 				content, err := json.Marshal(conn.QLog)
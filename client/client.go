@@ -0,0 +1,177 @@
+// This package establishes QUIC connections using the agents of QUIC-Tracker.
+//
+// Dial performs the recipe shared by the tools that need a ready connection: it creates the connection, attaches the
+// default agents, performs the handshake and reports its failures as typed errors. The agents remain accessible for
+// advanced use.
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	qt "github.com/PROGNOSISTool/adapter-quic"
+	"github.com/PROGNOSISTool/adapter-quic/agents"
+)
+
+const (
+	DefaultALPN             = "hq"
+	DefaultHandshakeTimeout = 10 * time.Second
+	closeTimeout            = time.Second
+)
+
+// Config tunes the connections established by Dial. The zero value is a valid configuration.
+type Config struct {
+	ServerName       string               // The name used for SNI, the host of the address by default
+	ALPN             string               // The ALPN prefix negotiated, DefaultALPN by default
+	HTTP3            bool                 // Negotiates HTTP/3, ALPN is ignored then
+	UseIPv6          bool                 // Connects using IPv6
+	ResumptionTicket []byte               // Resumes a previous session, the DefaultSessionStore is used otherwise
+	HandshakeTimeout time.Duration        // Bounds the duration of the handshake, DefaultHandshakeTimeout by default
+	Agents           []agents.Agent       // The agents attached to the connection, GetDefaultAgents by default
+	Prepare          func(*qt.Connection) // Called before any packet is sent, e.g. to attach a trace
+}
+
+// A Conn is a connection whose handshake completed.
+type Conn struct {
+	Connection *qt.Connection
+	Agents     *agents.ConnectionAgents
+}
+
+// Establishes a QUIC connection with the given address and performs its handshake. It returns once the handshake
+// completed, or fails with a VersionNegotiationError, a RetryError, a ConnectionClosedError or a HandshakeError.
+func Dial(ctx context.Context, address string, config *Config) (*Conn, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	serverName := config.ServerName
+	if serverName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		serverName = host
+	}
+	alpn := config.ALPN
+	if alpn == "" {
+		alpn = DefaultALPN
+	}
+	handshakeTimeout := config.HandshakeTimeout
+	if handshakeTimeout == 0 {
+		handshakeTimeout = DefaultHandshakeTimeout
+	}
+	agentList := config.Agents
+	if agentList == nil {
+		agentList = agents.GetDefaultAgents()
+	}
+
+	conn, err := qt.NewDefaultConnection(address, serverName, config.ResumptionTicket, config.UseIPv6, alpn, config.HTTP3)
+	if err != nil {
+		return nil, err
+	}
+	if config.Prepare != nil {
+		config.Prepare(conn)
+	}
+	incomingPackets := conn.IncomingPackets.RegisterNewChan(1000)
+	defer conn.IncomingPackets.Unregister(incomingPackets)
+
+	connAgents := agents.AttachAgentsToConnection(conn, agentList...)
+	handshakeAgent := &agents.HandshakeAgent{TLSAgent: connAgents.Get("TLSAgent").(*agents.TLSAgent), SocketAgent: connAgents.Get("SocketAgent").(*agents.SocketAgent)}
+	connAgents.Add(handshakeAgent)
+	connAgents.Get("SendingAgent").(*agents.SendingAgent).FrameProducer = connAgents.GetFrameProducingAgents()
+
+	handshakeStatus := handshakeAgent.HandshakeStatus.RegisterNewChan(10)
+	handshakeAgent.InitiateHandshake()
+
+	ctx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	defer cancel()
+
+	abort := func(err error) (*Conn, error) {
+		connAgents.StopAll()
+		conn.Close()
+		return nil, err
+	}
+	var versionNegotiations, retries int
+	for {
+		select {
+		case i := <-handshakeStatus:
+			s := i.(agents.HandshakeStatus)
+			if s.Completed {
+				return &Conn{conn, connAgents}, nil
+			}
+			return abort(handshakeFailure(s))
+		case i := <-incomingPackets:
+			switch p := i.(type) {
+			case *qt.VersionNegotiationPacket:
+				if versionNegotiations++; versionNegotiations > 1 {
+					return abort(&VersionNegotiationError{p.SupportedVersions})
+				}
+			case *qt.RetryPacket:
+				if retries++; retries > 1 {
+					return abort(&RetryError{retries})
+				}
+			}
+		case <-ctx.Done():
+			return abort(&HandshakeError{ctx.Err()})
+		}
+	}
+}
+
+// Translates a failed handshake status into the error reported by Dial.
+func handshakeFailure(s agents.HandshakeStatus) error {
+	switch p := s.Packet.(type) {
+	case *qt.VersionNegotiationPacket:
+		return &VersionNegotiationError{p.SupportedVersions}
+	case qt.Framer:
+		if f := p.GetFirst(qt.ConnectionCloseType); f != nil {
+			cc := f.(*qt.ConnectionCloseFrame)
+			return &ConnectionClosedError{false, cc.ErrorCode, cc.ReasonPhrase}
+		}
+		if f := p.GetFirst(qt.ApplicationCloseType); f != nil {
+			cc := f.(*qt.ApplicationCloseFrame)
+			return &ConnectionClosedError{true, cc.ErrorCode, cc.ReasonPhrase}
+		}
+	}
+	if s.Error == nil {
+		return &HandshakeError{errors.New("the handshake did not complete")}
+	}
+	return &HandshakeError{s.Error}
+}
+
+// Opens a new bidirectional stream, see agents.StreamAgent.OpenStream.
+func (c *Conn) OpenStream() *agents.StreamHandle {
+	return c.Agents.OpenStream()
+}
+
+// Opens a new unidirectional stream, see agents.StreamAgent.OpenUniStream.
+func (c *Conn) OpenUniStream() *agents.StreamHandle {
+	return c.Agents.OpenUniStream()
+}
+
+// Returns the next stream opened by the server, see agents.StreamAgent.AcceptStream.
+func (c *Conn) AcceptStream(ctx context.Context) (*agents.StreamHandle, error) {
+	return c.Agents.AcceptStream(ctx)
+}
+
+// Closes the connection without error, see CloseWithError.
+func (c *Conn) Close() error {
+	return c.CloseWithError(0, "")
+}
+
+// Closes the connection with an APPLICATION_CLOSE frame. It waits for the frame to be sent before stopping the agents
+// and releasing the socket.
+func (c *Conn) CloseWithError(errorCode uint64, reasonPhrase string) error {
+	if closingAgent, ok := c.Agents.Has("ClosingAgent"); ok {
+		closingAgent.(*agents.ClosingAgent).Close(false, errorCode, reasonPhrase)
+		select {
+		case <-c.Connection.ConnectionClosed:
+		case <-time.After(closeTimeout):
+		}
+	} else {
+		c.Connection.CloseConnection(false, errorCode, reasonPhrase)
+	}
+	c.Agents.StopAll()
+	c.Connection.Close()
+	return nil
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	qt "github.com/PROGNOSISTool/adapter-quic"
+	"github.com/PROGNOSISTool/adapter-quic/agents"
+)
+
+func TestDial_BadAddress(t *testing.T) {
+	for _, address := range []string{"localhost", "localhost:4433:1", ""} {
+		if conn, err := Dial(context.Background(), address, nil); err == nil {
+			conn.Close()
+			t.Errorf("Dial(%q) succeeded, expected an error", address)
+		}
+	}
+}
+
+func TestHandshakeFailure(t *testing.T) {
+	transportClose := new(qt.HandshakePacket)
+	transportClose.AddFrame(&qt.ConnectionCloseFrame{ErrorCode: 0x0a, ReasonPhrase: "bad tp"})
+	applicationClose := new(qt.ProtectedPacket)
+	applicationClose.AddFrame(&qt.ApplicationCloseFrame{ErrorCode: 0x101, ReasonPhrase: "bye"})
+	versionNegotiation := &qt.VersionNegotiationPacket{SupportedVersions: []qt.SupportedVersion{1}}
+	alert := errors.New("TLS alert")
+
+	err := handshakeFailure(agents.HandshakeStatus{false, transportClose, nil})
+	var closed *ConnectionClosedError
+	if !errors.As(err, &closed) || closed.Application || closed.ErrorCode != 0x0a || closed.ReasonPhrase != "bad tp" {
+		t.Errorf("expected a transport ConnectionClosedError, got %v", err)
+	}
+
+	err = handshakeFailure(agents.HandshakeStatus{false, applicationClose, nil})
+	if !errors.As(err, &closed) || !closed.Application || closed.ErrorCode != 0x101 {
+		t.Errorf("expected an application ConnectionClosedError, got %v", err)
+	}
+
+	err = handshakeFailure(agents.HandshakeStatus{false, versionNegotiation, nil})
+	var vn *VersionNegotiationError
+	if !errors.As(err, &vn) || len(vn.SupportedVersions) != 1 {
+		t.Errorf("expected a VersionNegotiationError, got %v", err)
+	}
+
+	err = handshakeFailure(agents.HandshakeStatus{false, nil, alert})
+	var handshake *HandshakeError
+	if !errors.As(err, &handshake) || !errors.Is(err, alert) {
+		t.Errorf("expected a HandshakeError wrapping the alert, got %v", err)
+	}
+
+	err = handshakeFailure(agents.HandshakeStatus{false, nil, nil})
+	if !errors.As(err, &handshake) {
+		t.Errorf("expected a HandshakeError, got %v", err)
+	}
+}
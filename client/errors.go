@@ -0,0 +1,53 @@
+package client
+
+import (
+	"fmt"
+
+	qt "github.com/PROGNOSISTool/adapter-quic"
+)
+
+// A VersionNegotiationError reports that the server does not support any of the versions we support, or that it kept
+// sending Version Negotiation packets after one was processed.
+type VersionNegotiationError struct {
+	SupportedVersions []qt.SupportedVersion
+}
+
+func (e *VersionNegotiationError) Error() string {
+	return fmt.Sprintf("version negotiation failed, the server supports %v", e.SupportedVersions)
+}
+
+// A RetryError reports that the server kept sending Retry packets after one was processed.
+type RetryError struct {
+	Retries int
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("the server sent %d Retry packets", e.Retries)
+}
+
+// A HandshakeError reports that the handshake did not complete, e.g. because of a TLS alert, of invalid transport
+// parameters or of the context being done.
+type HandshakeError struct {
+	Err error
+}
+
+func (e *HandshakeError) Error() string {
+	return fmt.Sprintf("handshake failed: %s", e.Err.Error())
+}
+
+func (e *HandshakeError) Unwrap() error { return e.Err }
+
+// A ConnectionClosedError reports that the server closed the connection with a CONNECTION_CLOSE frame.
+type ConnectionClosedError struct {
+	Application  bool // Whether the error code is an application error code rather than a transport error code
+	ErrorCode    uint64
+	ReasonPhrase string
+}
+
+func (e *ConnectionClosedError) Error() string {
+	kind := "transport"
+	if e.Application {
+		kind = "application"
+	}
+	return fmt.Sprintf("the server closed the connection with %s error 0x%x: %s", kind, e.ErrorCode, e.ReasonPhrase)
+}
@@ -33,13 +33,11 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"io"
-	"math"
+	"math/bits"
 	"net"
 	"time"
 
 	. "github.com/PROGNOSISTool/adapter-quic/lib"
-	_ "github.com/PROGNOSISTool/ls-qpack-go"
-	"github.com/PROGNOSISTool/pigotls"
 )
 
 // TODO: Reconsider the use of global variables
@@ -58,9 +56,14 @@ const (
 // errors
 
 const (
-	ERR_STREAM_LIMIT_ERROR = 0x04
-	ERR_STREAM_STATE_ERROR = 0x05
-	ERR_PROTOCOL_VIOLATION = 0x0a
+	ERR_FLOW_CONTROL_ERROR   = 0x03
+	ERR_STREAM_LIMIT_ERROR   = 0x04
+	ERR_STREAM_STATE_ERROR   = 0x05
+	ERR_FINAL_SIZE_ERROR     = 0x06
+	ERR_FRAME_ENCODING_ERROR = 0x07
+	ERR_TRANSPORT_PARAMETER_ERROR = 0x08
+	ERR_CONNECTION_ID_LIMIT_ERROR = 0x09
+	ERR_PROTOCOL_VIOLATION   = 0x0a
 )
 
 type PacketNumber uint64
@@ -70,15 +73,27 @@ func ReadPacketNumber (buffer *bytes.Reader) PacketNumber {
 	return PacketNumber(v)
 }
 
-func (p PacketNumber) Truncate(largestAcknowledged PacketNumber) TruncatedPN {
-	if p < largestAcknowledged {
-		panic("PNs should be truncated with a lower PN")
+// Returns the number of bytes needed to encode the PN so that the peer can reconstruct it, as described in RFC 9000
+// Appendix A.2. The PN is encoded on 4 bytes when it is not larger than the largest PN acknowledged, which can happen
+// when packet numbers are set arbitrarily.
+func (p PacketNumber) EncodedLength(largestAcknowledged PacketNumber, acknowledged bool) int {
+	var numUnacked uint64
+	if !acknowledged {
+		numUnacked = uint64(p) + 1
+	} else if p > largestAcknowledged {
+		numUnacked = uint64(p - largestAcknowledged)
+	} else {
+		return 4
 	}
-	length := (int(math.Log2(float64(p - largestAcknowledged + 1))) / 8) + 1  // See: https://tools.ietf.org/html/draft-ietf-quic-transport-13#section-4.8
+	length := (bits.Len64(numUnacked-1) + 1 + 7) / 8
 	if length > 4 {
-		println("couldn't truncate", p, "with", largestAcknowledged)
-		panic(length)
+		return 4
 	}
+	return length
+}
+
+// Returns the given number of least significant bytes of the PN.
+func (p PacketNumber) Truncate(length int) TruncatedPN {
 	return TruncatedPN{uint32(p) & (0xFFFFFFFF >> (8 * (4 - uint(length)))), length}
 }
 
@@ -110,8 +125,22 @@ func (t TruncatedPN) Encode() []byte {
 	return buffer.Bytes()
 }
 
-func (t TruncatedPN) Join(p PacketNumber) PacketNumber {
-	return PacketNumber(uint64(p & (0xFFFFFFFFFFFFFFFF << uint(t.Length * 8))) | uint64(t.Value))
+// Reconstructs the full PN that is the closest to the next expected PN, as described in RFC 9000 Appendix A.3.
+func (t TruncatedPN) Decode(largestReceived PacketNumber, received bool) PacketNumber {
+	var expected uint64
+	if received {
+		expected = uint64(largestReceived) + 1
+	}
+	window := uint64(1) << uint(t.Length*8)
+	halfWindow := window / 2
+	candidate := (expected &^ (window - 1)) | uint64(t.Value)
+	if expected >= halfWindow && candidate <= expected-halfWindow && candidate < (1<<62)-window {
+		return PacketNumber(candidate + window)
+	}
+	if candidate > expected+halfWindow && candidate >= window {
+		return PacketNumber(candidate - window)
+	}
+	return PacketNumber(candidate)
 }
 
 func (t *TruncatedPN) SetLength(length int) {
@@ -154,10 +183,10 @@ var PNSpaceToString = map[PNSpace]string{
 	PNSpaceAppData: "Application data",
 }
 
-var PNSpaceToEpoch = map[PNSpace]pigotls.Epoch{
-	PNSpaceInitial: pigotls.EpochInitial,
-	PNSpaceHandshake: pigotls.EpochHandshake,
-	PNSpaceAppData: pigotls.Epoch1RTT,
+var PNSpaceToEpoch = map[PNSpace]Epoch{
+	PNSpaceInitial: EpochInitial,
+	PNSpaceHandshake: EpochHandshake,
+	PNSpaceAppData: Epoch1RTT,
 }
 
 var PacketTypeToPNSpace = map[PacketType]PNSpace {
@@ -172,18 +201,18 @@ var PNSpaceToPacketType = map[PNSpace]PacketType{
 	PNSpaceAppData: ShortHeaderPacket, // TODO: Deal with O-RTT packets
 }
 
-var EpochToPNSpace = map[pigotls.Epoch]PNSpace {
-	pigotls.EpochInitial: PNSpaceInitial,
-	pigotls.EpochHandshake: PNSpaceHandshake,
-	pigotls.Epoch0RTT: PNSpaceAppData,
-	pigotls.Epoch1RTT: PNSpaceAppData,
+var EpochToPNSpace = map[Epoch]PNSpace {
+	EpochInitial: PNSpaceInitial,
+	EpochHandshake: PNSpaceHandshake,
+	Epoch0RTT: PNSpaceAppData,
+	Epoch1RTT: PNSpaceAppData,
 }
 
 func (pns PNSpace) String() string {
 	return PNSpaceToString[pns]
 }
 
-func (pns PNSpace) Epoch() pigotls.Epoch {
+func (pns PNSpace) Epoch() Epoch {
 	return PNSpaceToEpoch[pns]
 }
 
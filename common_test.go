@@ -0,0 +1,35 @@
+package quictracker
+
+import "testing"
+
+func TestPacketNumber_EncodedLength(t *testing.T) {
+	// See RFC 9000 Appendix A.2
+	if l := PacketNumber(0xac5c02).EncodedLength(0xabe8b3, true); l != 2 {
+		t.Error("Expected 2 bytes, got", l)
+	}
+	if l := PacketNumber(0xace8fe).EncodedLength(0xabe8b3, true); l != 3 {
+		t.Error("Expected 3 bytes, got", l)
+	}
+	if l := PacketNumber(0).EncodedLength(0, false); l != 1 {
+		t.Error("Expected 1 byte, got", l)
+	}
+	if l := PacketNumber(3).EncodedLength(10, true); l != 4 {
+		t.Error("Expected 4 bytes, got", l)
+	}
+}
+
+func TestTruncatedPN_Decode(t *testing.T) {
+	// See RFC 9000 Appendix A.3
+	if pn := PacketNumber(0xa82f9b32).Truncate(2).Decode(0xa82f30ea, true); pn != 0xa82f9b32 {
+		t.Errorf("Expected 0xa82f9b32, got %#x", pn)
+	}
+	if pn := PacketNumber(0x1ff).Truncate(1).Decode(0x1fe, true); pn != 0x1ff {
+		t.Errorf("Expected 0x1ff, got %#x", pn)
+	}
+	if pn := PacketNumber(0xfe).Truncate(1).Decode(0x102, true); pn != 0xfe {
+		t.Errorf("Expected 0xfe, got %#x", pn)
+	}
+	if pn := PacketNumber(5).Truncate(1).Decode(0, false); pn != 5 {
+		t.Errorf("Expected 5, got %#x", pn)
+	}
+}
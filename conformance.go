@@ -0,0 +1,62 @@
+package quictracker
+
+import (
+	"fmt"
+	"sync"
+)
+
+// The rules checked by the ConformanceAgent. Each of them is a MUST-level requirement of RFC 9000 that the peer broke.
+const (
+	RuleFrameNotAllowed             = "frame_not_allowed_in_packet_type"
+	RulePacketTypeNotAllowed        = "packet_type_not_allowed"
+	RulePacketNumberReused          = "packet_number_reused"
+	RuleReservedBitsSet             = "reserved_bits_set"
+	RuleUnsentPacketAcknowledged    = "unsent_packet_acknowledged"
+	RuleStreamLimitExceeded         = "stream_limit_exceeded"
+	RuleFlowControlLimitExceeded    = "flow_control_limit_exceeded"
+	RuleConnectionIdLimitExceeded   = "connection_id_limit_exceeded"
+	RuleDuplicateTransportParameter = "duplicate_transport_parameter"
+	RuleInvalidTransportParameter   = "invalid_transport_parameter"
+	RuleStreamState                 = "stream_state"
+)
+
+// A ConformanceViolation reports a behaviour of the peer that breaks a rule of the specification. ErrorCode is the
+// transport error a conformant endpoint would close the connection with.
+type ConformanceViolation struct {
+	Rule        string `json:"rule"`
+	Description string `json:"description"`
+	ErrorCode   uint64 `json:"error_code"`
+	Packet      string `json:"packet,omitempty"`
+}
+
+// A FlowControlViolation describes a frame of the peer that exceeds the data or stream limits we advertised. ErrorCode
+// is either ERR_FLOW_CONTROL_ERROR or ERR_STREAM_LIMIT_ERROR.
+type FlowControlViolation struct {
+	StreamId  uint64
+	FrameType FrameType
+	ErrorCode uint64
+	Reason    string
+}
+
+func (v FlowControlViolation) Error() string {
+	return fmt.Sprintf("%s frame on stream %d exceeds our limits (0x%02x): %s", v.FrameType.String(), v.StreamId, v.ErrorCode, v.Reason)
+}
+
+// Collects the violations observed on a connection. It is safe for concurrent use.
+type ConformanceReport struct {
+	lock       sync.Mutex
+	violations []ConformanceViolation
+}
+
+func (r *ConformanceReport) Add(v ConformanceViolation) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.violations = append(r.violations, v)
+}
+
+// Returns a copy of the violations observed so far, in the order they were observed.
+func (r *ConformanceReport) Violations() []ConformanceViolation {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]ConformanceViolation{}, r.violations...)
+}
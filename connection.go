@@ -15,7 +15,6 @@ import (
 	"unsafe"
 
 	"github.com/PROGNOSISTool/adapter-quic/qlog"
-	"github.com/PROGNOSISTool/pigotls"
 )
 
 type Connection struct {
@@ -25,7 +24,7 @@ type Connection struct {
 	Host          *net.UDPAddr
 	InterfaceMTU  int
 
-	Tls           *pigotls.Connection
+	Tls           TLSBackend
 	TLSTPHandler  *TLSTransportParameterHandler
 
 	KeyPhaseIndex  uint
@@ -40,7 +39,9 @@ type Connection struct {
 
 	CryptoStreams       CryptoStreams  // TODO: It should be a parent class without closing states
 	Streams             Streams
-	CurrentStreamID     uint64
+	CurrentStreamID     uint64 // The next client-initiated bidirectional stream, see NewBidiStreamID
+	currentUniStreamID  uint64 // The next client-initiated unidirectional stream, see NewUniStreamID
+	streamIDLock        sync.Mutex
 
 	IncomingPackets     Broadcaster //type: Packet
 	OutgoingPackets     Broadcaster //type: Packet
@@ -51,8 +52,12 @@ type Connection struct {
 	TransportParameters Broadcaster //type: QuicTransportParameters
 
 	PreparePacket 			  Broadcaster //type: EncryptionLevel
+	PrepareCoalescedPackets   Broadcaster //type: []EncryptionLevel
 	SendPacket 			      Broadcaster //type: PacketToSend
 	StreamInput               Broadcaster //type: StreamInput
+	StreamViolations          Broadcaster //type: StreamViolation
+	StreamStateUpdates        Broadcaster //type: StreamStateUpdate
+	FlowControlViolations     Broadcaster //type: FlowControlViolation
 	PacketAcknowledged        Broadcaster //type: PacketAcknowledged
 
 	ConnectionClosed 		  chan bool
@@ -65,13 +70,16 @@ type Connection struct {
 	Version                uint32
 	ALPN                   string
 
-	Token            []byte
-	ResumptionTicket []byte
+	Token                []byte
+	ResumptionTicket     []byte
+	RememberedParameters *QuicTransportParameters // The server transport parameters remembered from a previous connection for 0-RTT
+	Grease               GreaseOptions
 
 	PacketNumberLock       sync.Locker
 	PacketNumber           map[PNSpace]PacketNumber // Stores the next PN to be sent
 	LargestPNsReceived     map[PNSpace]PacketNumber // Stores the largest PN received
 	LargestPNsAcknowledged map[PNSpace]PacketNumber // Stores the largest PN we have sent that were acknowledged by the peer
+	PacketNumberLength     map[PNSpace]int          // When set, forces the length of the PNs encoded in the given space
 
 	MinRTT             uint64
 	SmoothedRTT        uint64
@@ -82,6 +90,7 @@ type Connection struct {
 	FlowControlQueue     map[FrameRequest][]QueuedFrame // Stores Flow Control QueuedFrames that are to be sent when requested.
 	StreamQueue          map[FrameRequest][]QueuedFrame // Stores Stream QueuedFrames that are to be sent when requested.
 	ReceiveFrameBuffer   map[PNSpace]map[FrameType][]Frame // Keeps track of received frames to detect retransmits.
+	ConformanceReport    *ConformanceReport // Collects the violations of the specification by the peer.
 	Logger               *log.Logger
 	QLog 				 qlog.QLog
 	QLogTrace			 *qlog.Trace
@@ -97,6 +106,23 @@ func (c *Connection) nextPacketNumber(space PNSpace) PacketNumber {  // TODO: Th
 	c.PacketNumberLock.Unlock()
 	return pn
 }
+// Returns the truncated form of the given PN, using the length forced in PacketNumberLength or otherwise the shortest
+// length allowing the peer to decode it given the largest PN it acknowledged in this space.
+func (c *Connection) TruncatePacketNumber(pn PacketNumber, space PNSpace) TruncatedPN {
+	c.PacketNumberLock.Lock()
+	length, forced := c.PacketNumberLength[space]
+	c.PacketNumberLock.Unlock()
+	if !forced {
+		largestAcknowledged, acknowledged := c.LargestPNsAcknowledged[space]
+		length = pn.EncodedLength(largestAcknowledged, acknowledged)
+	}
+	return pn.Truncate(length)
+}
+// Reconstructs the full PN of a received packet given the largest PN received in this space.
+func (c *Connection) DecodePacketNumber(truncatedPN TruncatedPN, space PNSpace) PacketNumber {
+	largestReceived, received := c.LargestPNsReceived[space]
+	return truncatedPN.Decode(largestReceived, received)
+}
 func (c *Connection) CryptoState(level EncryptionLevel) *CryptoState {
 	c.CryptoStateLock.Lock()
 	cs, ok := c.CryptoStates[level]
@@ -166,6 +192,7 @@ func (c *Connection) DoSendPacket(packet Packet, level EncryptionLevel) {
 			c.Logger.Printf("Error sending packet bytes: %v", err.Error())
 		} else {
 			c.Logger.Printf("Sent %v bytes to UDP socket", n)
+			c.datagramSent(n)
 		}
 
 		packet.SetSendContext(PacketContext{Timestamp: time.Now(), RemoteAddr: c.UdpConnection.RemoteAddr(), DatagramSize: uint16(len(packetBytes)), PacketSize: uint16(len(packetBytes))})
@@ -176,6 +203,54 @@ func (c *Connection) DoSendPacket(packet Packet, level EncryptionLevel) {
 	}
 }
 
+// Sends the given packets coalesced in a single UDP datagram, in the given order. The packets must be compatible with
+// coalescing, i.e. a 1-RTT packet can only be the last one.
+func (c *Connection) DoSendCoalescedPackets(packets []Packet, levels []EncryptionLevel) {
+	var datagram []byte
+	packetSizes := make([]int, len(packets))
+	for i, packet := range packets {
+		if c.CryptoState(levels[i]) == nil {
+			c.Logger.Printf("Unable to send packet {type=%s, number=%d} with EL %v yet, dropping the coalesced packets.\n", packet.GetHeader().GetPacketType().String(), packet.GetHeader().GetPacketNumber(), levels[i].String())
+			return
+		}
+		c.Logger.Printf("Sending coalesced packet {type=%s, number=%d}\n", packet.GetHeader().GetPacketType().String(), packet.GetHeader().GetPacketNumber())
+		packetBytes := c.EncodeAndEncrypt(packet, levels[i])
+		packetSizes[i] = len(packetBytes)
+		datagram = append(datagram, packetBytes...)
+	}
+
+	n, err := c.UdpConnection.Write(datagram)
+	if err != nil {
+		c.Logger.Printf("Error sending packet bytes: %v", err.Error())
+	} else {
+		c.Logger.Printf("Sent %v bytes containing %d coalesced packets to UDP socket", n, len(packets))
+		c.datagramSent(n)
+	}
+
+	now := time.Now()
+	for i, packet := range packets {
+		packet.SetSendContext(PacketContext{Timestamp: now, RemoteAddr: c.UdpConnection.RemoteAddr(), DatagramSize: uint16(len(datagram)), PacketSize: uint16(packetSizes[i])})
+		c.PacketWasSent(packet)
+	}
+}
+
+func (c *Connection) datagramSent(length int) {
+	c.QLogEvents <- c.QLogTrace.NewEvent(qlog.Categories.Transport.Category, qlog.Categories.Transport.DatagramsSent, qlog.Datagrams{Count: 1, Raw: []qlog.RawInfo{{Length: uint64(length)}}})
+}
+
+// Logs the versions and ALPN offered by the client, and the versions offered by the server if it sent a VN packet.
+func (c *Connection) logVersionInformation(vn *VersionNegotiationPacket, clientVersion uint32) {
+	information := qlog.VersionInformation{ClientVersions: []string{SupportedVersion(clientVersion).String()}}
+	if vn != nil {
+		for _, v := range vn.SupportedVersions {
+			information.ServerVersions = append(information.ServerVersions, v.String())
+		}
+		information.ChosenVersion = SupportedVersion(c.Version).String()
+	}
+	c.QLogEvents <- c.QLogTrace.NewEvent(qlog.Categories.Transport.Category, qlog.Categories.Transport.VersionInformation, information)
+	c.QLogEvents <- c.QLogTrace.NewEvent(qlog.Categories.Transport.Category, qlog.Categories.Transport.ALPNInformation, qlog.ALPNInformation{ClientALPNs: []string{c.ALPN}})
+}
+
 func (c *Connection) GetCryptoFrame(encLevel EncryptionLevel) *CryptoFrame {
 	extensionData, err := c.TLSTPHandler.GetExtensionData()
 	if err != nil {
@@ -226,7 +301,7 @@ func (c *Connection) GetInitialPacket() *InitialPacket {
 func (c *Connection) ProcessVersionNegotation(vn *VersionNegotiationPacket) error {
 	var version uint32
 	for _, v := range vn.SupportedVersions {
-		if v >= MinimumVersion && v <= MaximumVersion {
+		if v >= MinimumVersion && v <= MaximumVersion && SupportsVersion(uint32(v)) {
 			version = uint32(v)
 		}
 	}
@@ -235,10 +310,12 @@ func (c *Connection) ProcessVersionNegotation(vn *VersionNegotiationPacket) erro
 		c.Logger.Printf("Versions received: %v\n", vn.SupportedVersions)
 		return errors.New("no appropriate version found")
 	}
+	clientVersion := c.Version
 	QuicVersion = version
 	QuicALPNToken = fmt.Sprintf("%s-%02d", strings.Split(c.ALPN, "-")[0], version & 0xff)
 	_, err := rand.Read(c.DestinationCID)
 	c.TransitionTo(QuicVersion, QuicALPNToken)
+	c.logVersionInformation(vn, clientVersion)
 	return err
 }
 func (c *Connection) GetAckFrame(space PNSpace) *AckFrame { // Returns an ack frame based on the packet numbers received
@@ -280,16 +357,50 @@ func (c *Connection) GetAckFrame(space PNSpace) *AckFrame { // Returns an ack fr
 	}
 	return frame
 }
+// Returns the ID of a new client-initiated unidirectional stream, or reserves the given stream ID when it is not zero.
+// The agents opening unidirectional streams, e.g. the StreamAgent and the HTTP/3 agents, share these IDs so that their
+// streams do not collide.
+func (c *Connection) NewUniStreamID(streamID uint64) uint64 {
+	c.streamIDLock.Lock()
+	defer c.streamIDLock.Unlock()
+	if c.currentUniStreamID == 0 {
+		c.currentUniStreamID = 2
+	}
+	if streamID == 0 {
+		streamID = c.currentUniStreamID
+		for _, present := c.Streams.Has(streamID); present; _, present = c.Streams.Has(streamID) {
+			streamID += 4
+		}
+	}
+	if streamID >= c.currentUniStreamID {
+		c.currentUniStreamID = streamID + 4
+	}
+	return streamID
+}
+// Returns the ID of a new client-initiated bidirectional stream. The agents sending requests and the StreamAgent share
+// these IDs so that their streams do not collide.
+func (c *Connection) NewBidiStreamID() uint64 {
+	c.streamIDLock.Lock()
+	defer c.streamIDLock.Unlock()
+	streamID := c.CurrentStreamID
+	for _, present := c.Streams.Has(streamID); present; _, present = c.Streams.Has(streamID) {
+		streamID += 4
+	}
+	c.CurrentStreamID = streamID + 4
+	return streamID
+}
 func (c *Connection) TransitionTo(version uint32, ALPN string) {
 	time.Sleep(200 * time.Millisecond)
 	c.TLSTPHandler = NewTLSTransportParameterHandler(c.SourceCID)
+	c.greaseTransportParameters()
 	c.Version = version
 	c.ALPN = ALPN
-	c.Tls = pigotls.NewConnection(c.ServerName, c.ALPN, c.ResumptionTicket)
+	c.Tls = NewTLSBackend(c.Version, c.ServerName, c.ALPN, c.ResumptionTicket)
 	c.PacketNumberLock = &sync.Mutex{}
 	c.PacketNumber = make(map[PNSpace]PacketNumber)
 	c.LargestPNsReceived = make(map[PNSpace]PacketNumber)
 	c.LargestPNsAcknowledged = make(map[PNSpace]PacketNumber)
+	c.PacketNumberLength = make(map[PNSpace]int)
 	c.AckQueue = make(map[PNSpace][]PacketNumber)
 	c.TlsQueue = make(map[EncryptionLevel][]QueuedFrame)
 	c.StreamQueue = make(map[FrameRequest][]QueuedFrame)
@@ -305,7 +416,7 @@ func (c *Connection) TransitionTo(version uint32, ALPN string) {
 	c.CryptoStreams = make(map[PNSpace]*Stream)
 	c.CryptoStates[EncryptionLevelInitial] = NewInitialPacketProtection(c)
 	c.CryptoStateLock.Unlock()
-	c.Streams = Streams{streams: make(map[uint64]*Stream), lock: &sync.Mutex{}, input: &c.StreamInput}
+	c.Streams = Streams{streams: make(map[uint64]*Stream), lock: &sync.Mutex{}, input: &c.StreamInput, violations: &c.StreamViolations, stateUpdates: &c.StreamStateUpdates}
 	c.Logger.Printf("Transitioned to Version %#x and ALPN %v", Uint32ToBEBytes(version), ALPN)
 }
 func (c *Connection) CloseConnection(quicLayer bool, errCode uint64, reasonPhrase string) {
@@ -330,6 +441,9 @@ func EstablishUDPConnection(addr *net.UDPAddr, localAddress *net.UDPAddr) (*net.
 	return udpConn, nil
 }
 func NewDefaultConnection(address string, serverName string, resumptionTicket []byte, useIPv6 bool, preferredALPN string, negotiateHTTP3 bool) (*Connection, error) {
+	if !SupportsVersion(QuicVersion) {
+		return nil, fmt.Errorf("QUIC version 0x%08x requires the picotls backend, build with the pigotls tag", QuicVersion)
+	}
 	scid := make([]byte, 8, 8)
 	dcid := make([]byte, 8, 8)
 	rand.Read(scid)
@@ -351,12 +465,26 @@ func NewDefaultConnection(address string, serverName string, resumptionTicket []
 		return nil, err
 	}
 
-	var c *Connection
-	if negotiateHTTP3 {
-		c = NewConnection(serverName, QuicVersion, QuicH3ALPNToken, scid, dcid, udpConn, resumptionTicket)
-	} else {
+	ALPN := QuicH3ALPNToken
+	if !negotiateHTTP3 {
 		QuicALPNToken = fmt.Sprintf("%s-%02d", preferredALPN, QuicVersion & 0xff)
-		c = NewConnection(serverName, QuicVersion, QuicALPNToken, scid, dcid, udpConn, resumptionTicket)
+		ALPN = QuicALPNToken
+	}
+
+	var session *SessionEntry
+	if resumptionTicket == nil && DefaultSessionStore != nil {
+		session = DefaultSessionStore.Get(serverName, ALPN, QuicVersion)
+		if session != nil {
+			resumptionTicket = session.ResumptionTicket
+		}
+	}
+
+	c := NewConnection(serverName, QuicVersion, ALPN, scid, dcid, udpConn, resumptionTicket)
+	if session != nil {
+		c.Token = session.Token
+		if len(resumptionTicket) > 0 {
+			c.RememberedParameters = session.TransportParameters
+		}
 	}
 
 	var headerOverhead = 8
@@ -416,8 +544,13 @@ func NewConnection(serverName string, version uint32, ALPN string, SCID []byte,
 	c.ConnectionRestart = make(chan bool, 1)
 	c.ConnectionRestarted = make(chan bool, 1)
 	c.PreparePacket = NewBroadcaster(1000)
+	c.PrepareCoalescedPackets = NewBroadcaster(1000)
 	c.SendPacket = NewBroadcaster(1000)
 	c.StreamInput = NewBroadcaster(1000)
+	c.StreamViolations = NewBroadcaster(1000)
+	c.StreamStateUpdates = NewBroadcaster(1000)
+	c.FlowControlViolations = NewBroadcaster(1000)
+	c.ConformanceReport = &ConformanceReport{}
 	c.PacketAcknowledged = NewBroadcaster(1000)
 
 	c.ReceiveFrameBuffer = map[PNSpace]map[FrameType][]Frame{
@@ -426,7 +559,8 @@ func NewConnection(serverName string, version uint32, ALPN string, SCID []byte,
 		PNSpaceAppData:   make(map[FrameType][]Frame),
 	}
 
-	c.QLog.Version = "draft-01"
+	c.QLog.Version = qlog.Version
+	c.QLog.Format = qlog.FormatJSON
 	c.QLog.Description = "QUIC-Tracker"
 	if len(GitCommit()) > 0 {
 		c.QLog.Description += " commit " + GitCommit()
@@ -438,13 +572,12 @@ func NewConnection(serverName string, version uint32, ALPN string, SCID []byte,
 	c.QLogTrace.VantagePoint.Type = "client"
 	c.QLogTrace.Description = fmt.Sprintf("Connection to %s (%s), using version %08x and alpn %s", serverName, udpConn.RemoteAddr().String(), version, ALPN)
 	c.QLogTrace.ReferenceTime = time.Now()
-	c.QLogTrace.Configuration.TimeUnits = qlog.TimeUnitsString
 
 	c.QLogTrace.CommonFields = make(map[string]interface{})
 	c.QLogTrace.CommonFields["ODCID"] = hex.EncodeToString(c.OriginalDestinationCID)
 	c.QLogTrace.CommonFields["group_id"] = c.QLogTrace.CommonFields["ODCID"]
-	c.QLogTrace.CommonFields["reference_time"] = c.QLogTrace.ReferenceTime.UnixNano() / int64(qlog.TimeUnits)
-	c.QLogTrace.EventFields = qlog.DefaultEventFields()
+	c.QLogTrace.CommonFields["time_format"] = "relative"
+	c.QLogTrace.CommonFields["reference_time"] = float64(c.QLogTrace.ReferenceTime.UnixNano()) / float64(time.Millisecond)
 	c.QLogEvents = make(chan *qlog.Event, 1000)
 
 	go func() {
@@ -456,6 +589,7 @@ func NewConnection(serverName string, version uint32, ALPN string, SCID []byte,
 	c.Logger = log.New(os.Stderr, fmt.Sprintf("[CID %s] ", hex.EncodeToString(c.OriginalDestinationCID)), log.Lshortfile)
 
 	c.TransitionTo(version, ALPN)
+	c.logVersionInformation(nil, version)
 
 	return c
 }
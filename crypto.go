@@ -3,16 +3,38 @@ package quictracker
 import (
 	"bytes"
 	"encoding/binary"
-
-	"github.com/PROGNOSISTool/pigotls"
 )
 
-var quicVersionSalt = []byte{  // See https://tools.ietf.org/html/draft-ietf-quic-tls-29#section-5.2
+var quicVersionSaltDraft23 = []byte{  // See https://tools.ietf.org/html/draft-ietf-quic-tls-23#section-5.2
+	0xc3, 0xee, 0xf7, 0x12, 0xc7, 0x2e, 0xbb, 0x5a,
+	0x11, 0xa7, 0xd2, 0x43, 0x2b, 0xb4, 0x63, 0x65,
+	0xbe, 0xf9, 0xf5, 0x02,
+}
+
+var quicVersionSaltDraft29 = []byte{  // See https://tools.ietf.org/html/draft-ietf-quic-tls-29#section-5.2
 	0xaf, 0xbf, 0xec, 0x28, 0x99, 0x93, 0xd2, 0x4c,
 	0x9e, 0x97, 0x86, 0xf1, 0x9c, 0x61, 0x11, 0xe0,
 	0x43, 0x90, 0xa8, 0x99,
 }
 
+var quicVersionSaltV1 = []byte{  // See https://www.rfc-editor.org/rfc/rfc9001#section-5.2
+	0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3,
+	0x4d, 0x17, 0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad,
+	0xcc, 0xbb, 0x7f, 0x0a,
+}
+
+// Returns the salt used to derive the Initial secrets of the given QUIC version. The salt of draft-29 is used up to
+// draft-32, and the salt of version 1 from draft-33 onwards.
+func quicVersionSalt(version uint32) []byte {
+	if isDraftBefore33(version) {
+		if version&0xff < 29 {
+			return quicVersionSaltDraft23
+		}
+		return quicVersionSaltDraft29
+	}
+	return quicVersionSaltV1
+}
+
 const (
 	clientInitialLabel = "client in"
 	serverInitialLabel = "server in"
@@ -77,18 +99,18 @@ var PacketTypeToEncryptionLevel = map[PacketType]EncryptionLevel {
 	ShortHeaderPacket: EncryptionLevel1RTT,
 }
 
-var EpochToEncryptionLevel = map[pigotls.Epoch]EncryptionLevel {
-	pigotls.EpochInitial: EncryptionLevelInitial,
-	pigotls.Epoch0RTT: EncryptionLevel0RTT,
-	pigotls.EpochHandshake: EncryptionLevelHandshake,
-	pigotls.Epoch1RTT: EncryptionLevel1RTT,
+var EpochToEncryptionLevel = map[Epoch]EncryptionLevel {
+	EpochInitial: EncryptionLevelInitial,
+	Epoch0RTT: EncryptionLevel0RTT,
+	EpochHandshake: EncryptionLevelHandshake,
+	Epoch1RTT: EncryptionLevel1RTT,
 }
 
-var EncryptionLevelToEpoch = map[EncryptionLevel]pigotls.Epoch {
-	EncryptionLevelInitial: pigotls.EpochInitial,
-	EncryptionLevel0RTT: pigotls.Epoch0RTT,
-	EncryptionLevelHandshake: pigotls.EpochHandshake,
-	EncryptionLevel1RTT: pigotls.Epoch1RTT,
+var EncryptionLevelToEpoch = map[EncryptionLevel]Epoch {
+	EncryptionLevelInitial: EpochInitial,
+	EncryptionLevel0RTT: Epoch0RTT,
+	EncryptionLevelHandshake: EpochHandshake,
+	EncryptionLevel1RTT: Epoch1RTT,
 }
 
 type DirectionalEncryptionLevel struct {
@@ -98,10 +120,10 @@ type DirectionalEncryptionLevel struct {
 }
 
 type CryptoState struct {
-	Read        *pigotls.AEAD
-	Write       *pigotls.AEAD
-	HeaderRead  *pigotls.Cipher
-	HeaderWrite *pigotls.Cipher
+	Read        AEAD
+	Write       AEAD
+	HeaderRead  HeaderCipher
+	HeaderWrite HeaderCipher
 }
 
 type RetryPseudoPacket struct {
@@ -124,24 +146,24 @@ func (r *RetryPseudoPacket) Encode() []byte {
 	return buf.Bytes()
 }
 
-func (s *CryptoState) InitRead(tls *pigotls.Connection, readSecret []byte) {
+func (s *CryptoState) InitRead(tls TLSBackend, readSecret []byte) {
 	s.Read = tls.NewAEAD(readSecret, false)
-	s.HeaderRead = tls.NewCipher(tls.HkdfExpandLabel(readSecret, "hp", nil, tls.AEADKeySize(), pigotls.QuicBaseLabel))
+	s.HeaderRead = tls.NewCipher(tls.HkdfExpandLabel(readSecret, "hp", nil, tls.AEADKeySize(), QuicBaseLabel))
 }
 
-func (s *CryptoState) InitWrite(tls *pigotls.Connection, writeSecret []byte) {
+func (s *CryptoState) InitWrite(tls TLSBackend, writeSecret []byte) {
 	s.Write = tls.NewAEAD(writeSecret, true)
-	s.HeaderWrite = tls.NewCipher(tls.HkdfExpandLabel(writeSecret, "hp", nil, tls.AEADKeySize(), pigotls.QuicBaseLabel))
+	s.HeaderWrite = tls.NewCipher(tls.HkdfExpandLabel(writeSecret, "hp", nil, tls.AEADKeySize(), QuicBaseLabel))
 }
 
 func NewInitialPacketProtection(conn *Connection) *CryptoState {
-	initialSecret := conn.Tls.HkdfExtract(quicVersionSalt, conn.DestinationCID)
-	readSecret := conn.Tls.HkdfExpandLabel(initialSecret, serverInitialLabel, nil, conn.Tls.HashDigestSize(), pigotls.BaseLabel)
-	writeSecret := conn.Tls.HkdfExpandLabel(initialSecret, clientInitialLabel, nil, conn.Tls.HashDigestSize(), pigotls.BaseLabel)
+	initialSecret := conn.Tls.HkdfExtract(quicVersionSalt(conn.Version), conn.DestinationCID)
+	readSecret := conn.Tls.HkdfExpandLabel(initialSecret, serverInitialLabel, nil, conn.Tls.HashDigestSize(), BaseLabel)
+	writeSecret := conn.Tls.HkdfExpandLabel(initialSecret, clientInitialLabel, nil, conn.Tls.HashDigestSize(), BaseLabel)
 	return NewProtectedCryptoState(conn.Tls, readSecret, writeSecret)
 }
 
-func NewProtectedCryptoState(tls *pigotls.Connection, readSecret []byte, writeSecret []byte) *CryptoState {
+func NewProtectedCryptoState(tls TLSBackend, readSecret []byte, writeSecret []byte) *CryptoState {
 	s := new(CryptoState)
 	if len(readSecret) > 0 {
 		s.InitRead(tls, readSecret)
@@ -31,9 +31,13 @@ func NewFrameFromType(frameType FrameType, buffer *bytes.Reader, conn *Connectio
 	case frameType == AckECNType:
 		return Frame(ReadAckECNFrame(buffer, conn)), nil
 	case frameType == ResetStreamType:
-		return Frame(NewResetStream(buffer)), nil
+		frame := NewResetStream(buffer)
+		conn.Streams.ReceiveResetStream(frame)
+		return Frame(frame), nil
 	case frameType == StopSendingType:
-		return Frame(NewStopSendingFrame(buffer)), nil
+		frame := NewStopSendingFrame(buffer)
+		conn.Streams.ReceiveStopSending(frame)
+		return Frame(frame), nil
 	case frameType == CryptoType:
 		return Frame(ReadCryptoFrame(buffer, conn)), nil
 	case frameType == NewTokenType:
@@ -43,7 +47,9 @@ func NewFrameFromType(frameType FrameType, buffer *bytes.Reader, conn *Connectio
 	case frameType == MaxDataType:
 		return Frame(NewMaxDataFrame(buffer)), nil
 	case frameType == MaxStreamDataType:
-		return Frame(NewMaxStreamDataFrame(buffer)), nil
+		frame := NewMaxStreamDataFrame(buffer)
+		conn.Streams.ReceiveMaxStreamData(frame)
+		return Frame(frame), nil
 	case frameType&0xFE == MaxStreamsType:
 		return Frame(NewMaxStreamIdFrame(buffer)), nil
 	case frameType == DataBlockedType:
@@ -66,6 +72,12 @@ func NewFrameFromType(frameType FrameType, buffer *bytes.Reader, conn *Connectio
 		return Frame(NewApplicationCloseFrame(buffer)), nil
 	case frameType == HandshakeDoneType:
 		return Frame(NewHandshakeDoneFrame(buffer)), nil
+	case frameType == DatagramType || frameType == DatagramType|0x01:
+		return Frame(ReadDatagramFrame(buffer)), nil
+	case frameType == AckFrequencyType:
+		return Frame(ReadAckFrequencyFrame(buffer)), nil
+	case frameType == ImmediateAckType:
+		return Frame(NewImmediateAckFrame(buffer)), nil
 	default:
 		return nil, errors.New(fmt.Sprintf("Unknown frame type %d", frameType))
 	}
@@ -113,6 +125,10 @@ const (
 	ConnectionCloseType              = 0x1c
 	ApplicationCloseType             = 0x1d
 	HandshakeDoneType				 = 0x1e
+	DatagramType                     = 0x30
+	AckFrequencyType                 = 0xaf
+	ImmediateAckType                 = 0x1f
+	GreaseType                       = 0x3a // Identifies the frames with an unknown type sent for greasing
 )
 
 var frameTypeToString = map[FrameType]string {
@@ -138,6 +154,10 @@ var frameTypeToString = map[FrameType]string {
 	ConnectionCloseType:       "CONNECTION_CLOSE",
 	ApplicationCloseType:      "APPLICATION_CLOSE",
 	HandshakeDoneType:         "HANDSHAKE_DONE",
+	DatagramType:              "DATAGRAM",
+	AckFrequencyType:          "ACK_FREQUENCY",
+	ImmediateAckType:          "IMMEDIATE_ACK",
+	GreaseType:                "GREASE",
 }
 
 func (t FrameType) String() string {
@@ -167,6 +187,10 @@ var stringToFrameType = map[string]FrameType {
 	"CONNECTION_CLOSE":       ConnectionCloseType,
 	"APPLICATION_CLOSE":      ApplicationCloseType,
 	"HANDSHAKE_DONE":         HandshakeDoneType,
+	"DATAGRAM":               DatagramType,
+	"ACK_FREQUENCY":          AckFrequencyType,
+	"IMMEDIATE_ACK":          ImmediateAckType,
+	"GREASE":                 GreaseType,
 }
 
 func FrameTypeFromString(input string) FrameType {
@@ -263,10 +287,8 @@ func (frame *AckFrame) GetAckedPackets() []PacketNumber { // TODO: This is prone
 		packets = append(packets, currentPacketNumber)
 	}
 	for _, ackBlock := range frame.AckRanges[1:] {
-		for i := uint64(0); i <= ackBlock.Gap; i++ { // See https://tools.ietf.org/html/draft-ietf-quic-transport-10#section-8.15.1
-			currentPacketNumber--
-			packets = append(packets, currentPacketNumber)
-		}
+		currentPacketNumber -= PacketNumber(ackBlock.Gap) + 2 // See RFC 9000 Section 19.3.1
+		packets = append(packets, currentPacketNumber)
 		for i := uint64(0); i < ackBlock.AckRange; i++ {
 			currentPacketNumber--
 			packets = append(packets, currentPacketNumber)
@@ -274,6 +296,28 @@ func (frame *AckFrame) GetAckedPackets() []PacketNumber { // TODO: This is prone
 	}
 	return packets
 }
+
+// Returns the ranges of packet numbers acknowledged by the frame, from the largest to the smallest. Each range is made of
+// its smallest and largest packet numbers. The ranges that would go below packet number 0 are not returned.
+func (frame *AckFrame) GetAckedRanges() [][2]PacketNumber {
+	var ranges [][2]PacketNumber
+
+	largest := uint64(frame.LargestAcknowledged)
+	for i, ackBlock := range frame.AckRanges {
+		if i > 0 {
+			if ackBlock.Gap+2 > largest {
+				break
+			}
+			largest -= ackBlock.Gap + 2 // See RFC 9000 Section 19.3.1
+		}
+		if ackBlock.AckRange > largest {
+			break
+		}
+		ranges = append(ranges, [2]PacketNumber{PacketNumber(largest - ackBlock.AckRange), PacketNumber(largest)})
+		largest -= ackBlock.AckRange
+	}
+	return ranges
+}
 func (frame AckFrame) MarshalJSON() ([]byte, error) {
     type localFrame AckFrame
 	envelope := Envelope{
@@ -547,7 +591,7 @@ func ReadStreamFrame(buffer *bytes.Reader, conn *Connection) *StreamFrame {
 	frame.StreamData = make([]byte, frame.Length, frame.Length)
 	buffer.Read(frame.StreamData)
 
-	conn.Streams.Get(frame.StreamId).addToRead(frame)
+	conn.Streams.ReceiveStreamFrame(frame)
 
 	return frame
 }
@@ -966,3 +1010,141 @@ func NewHandshakeDoneFrame(buffer *bytes.Reader) *HandshakeDoneFrame {
 	_, _ = ReadVarInt(buffer) // Discard frame type
 	return frame
 }
+
+type DatagramFrame struct {
+	LenBit bool
+
+	Length uint64
+	Data   []byte
+}
+
+func (frame *DatagramFrame) FrameType() FrameType { return DatagramType }
+func (frame *DatagramFrame) WriteTo(buffer *bytes.Buffer) {
+	typeByte := uint64(frame.FrameType())
+	if frame.LenBit {
+		typeByte |= 0x01
+	}
+	WriteVarInt(buffer, typeByte)
+	if frame.LenBit {
+		WriteVarInt(buffer, frame.Length)
+	}
+	buffer.Write(frame.Data)
+}
+func (frame *DatagramFrame) shouldBeRetransmitted() bool { return false }
+func (frame *DatagramFrame) FrameLength() uint16 {
+	length := uint16(1)
+	if frame.LenBit {
+		length += uint16(VarIntLen(frame.Length))
+	}
+	return length + uint16(len(frame.Data))
+}
+func (frame DatagramFrame) MarshalJSON() ([]byte, error) {
+	type localFrame DatagramFrame
+	envelope := Envelope{
+		Type: DatagramFrameJSON,
+		Message: localFrame(frame),
+	}
+	return json.Marshal(envelope)
+}
+func ReadDatagramFrame(buffer *bytes.Reader) *DatagramFrame {
+	frame := new(DatagramFrame)
+	typeByte, _ := buffer.ReadByte()
+	frame.LenBit = (typeByte & 0x01) == 0x01
+	if frame.LenBit {
+		frame.Length, _, _ = ReadVarIntValue(buffer)
+	} else {
+		frame.Length = uint64(buffer.Len())
+	}
+	frame.Data = make([]byte, frame.Length, frame.Length)
+	buffer.Read(frame.Data)
+	return frame
+}
+func NewDatagramFrame(data []byte) *DatagramFrame {
+	frame := new(DatagramFrame)
+	frame.LenBit = true
+	frame.Length = uint64(len(data))
+	frame.Data = data
+	return frame
+}
+
+type AckFrequencyFrame struct {
+	SequenceNumber        uint64
+	AckElicitingThreshold uint64
+	RequestedMaxAckDelay  uint64 // In microseconds
+	ReorderingThreshold   uint64
+}
+
+func (frame *AckFrequencyFrame) FrameType() FrameType { return AckFrequencyType }
+func (frame *AckFrequencyFrame) WriteTo(buffer *bytes.Buffer) {
+	WriteVarInt(buffer, uint64(frame.FrameType()))
+	WriteVarInt(buffer, frame.SequenceNumber)
+	WriteVarInt(buffer, frame.AckElicitingThreshold)
+	WriteVarInt(buffer, frame.RequestedMaxAckDelay)
+	WriteVarInt(buffer, frame.ReorderingThreshold)
+}
+func (frame *AckFrequencyFrame) shouldBeRetransmitted() bool { return true }
+func (frame *AckFrequencyFrame) FrameLength() uint16 {
+	return uint16(VarIntLen(uint64(frame.FrameType())) + VarIntLen(frame.SequenceNumber) + VarIntLen(frame.AckElicitingThreshold) + VarIntLen(frame.RequestedMaxAckDelay) + VarIntLen(frame.ReorderingThreshold))
+}
+func (frame AckFrequencyFrame) MarshalJSON() ([]byte, error) {
+	type localFrame AckFrequencyFrame
+	envelope := Envelope{
+		Type: AckFrequencyFrameJSON,
+		Message: localFrame(frame),
+	}
+	return json.Marshal(envelope)
+}
+func ReadAckFrequencyFrame(buffer *bytes.Reader) *AckFrequencyFrame {
+	frame := new(AckFrequencyFrame)
+	_, _ = ReadVarInt(buffer) // Discard frame type
+	frame.SequenceNumber, _, _ = ReadVarIntValue(buffer)
+	frame.AckElicitingThreshold, _, _ = ReadVarIntValue(buffer)
+	frame.RequestedMaxAckDelay, _, _ = ReadVarIntValue(buffer)
+	frame.ReorderingThreshold, _, _ = ReadVarIntValue(buffer)
+	return frame
+}
+
+type ImmediateAckFrame byte
+
+func (frame *ImmediateAckFrame) FrameType() FrameType { return ImmediateAckType }
+func (frame *ImmediateAckFrame) WriteTo(buffer *bytes.Buffer) {
+	WriteVarInt(buffer, uint64(frame.FrameType()))
+}
+func (frame *ImmediateAckFrame) shouldBeRetransmitted() bool { return false }
+func (frame *ImmediateAckFrame) FrameLength() uint16         { return 1 }
+func (frame ImmediateAckFrame) MarshalJSON() ([]byte, error) {
+	type localFrame ImmediateAckFrame
+	envelope := Envelope{
+		Type: ImmediateAckFrameJSON,
+		Message: localFrame(frame),
+	}
+	return json.Marshal(envelope)
+}
+func NewImmediateAckFrame(buffer *bytes.Reader) *ImmediateAckFrame {
+	frame := new(ImmediateAckFrame)
+	_, _ = ReadVarInt(buffer) // Discard frame type
+	return frame
+}
+
+// A frame of an unknown type, used to check that the peer rejects unknown frames. Its actual type is RawType.
+type GreaseFrame struct {
+	RawType uint64
+}
+
+func (frame *GreaseFrame) FrameType() FrameType { return GreaseType }
+func (frame *GreaseFrame) WriteTo(buffer *bytes.Buffer) {
+	WriteVarInt(buffer, frame.RawType)
+}
+func (frame *GreaseFrame) shouldBeRetransmitted() bool { return false }
+func (frame *GreaseFrame) FrameLength() uint16         { return uint16(VarIntLen(frame.RawType)) }
+func (frame GreaseFrame) MarshalJSON() ([]byte, error) {
+	type localFrame GreaseFrame
+	envelope := Envelope{
+		Type: GreaseFrameJSON,
+		Message: localFrame(frame),
+	}
+	return json.Marshal(envelope)
+}
+func NewGreaseFrame() *GreaseFrame {
+	return &GreaseFrame{GreaseFrameType()}
+}
@@ -4,13 +4,17 @@ go 1.21.6
 
 require (
 	github.com/PROGNOSISTool/golang-set v1.7.1
-	github.com/PROGNOSISTool/ls-qpack-go v0.0.0-20240204225820-8209755a348e
 	github.com/PROGNOSISTool/pigotls v0.0.0-20240204230515-3292f6ec6731
 	github.com/PROGNOSISTool/tcp_server v0.0.0-20200709134627-fb9eb4cf2aa0
 	github.com/davecgh/go-spew v1.1.1
 	github.com/dustin/go-broadcast v0.0.0-20211018055107-71439988bd91
 	github.com/google/go-cmp v0.6.0
+	golang.org/x/crypto v0.24.0
+	golang.org/x/net v0.26.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
-require github.com/smartystreets/goconvey v1.8.1 // indirect
+require (
+	github.com/smartystreets/goconvey v1.8.1 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+)
@@ -0,0 +1,64 @@
+package quictracker
+
+import (
+	"encoding/binary"
+	"math/rand"
+)
+
+// Controls the use of reserved codepoints that a peer must ignore, which prevents the ossification of the protocol. It
+// is applied to a connection using SetGrease.
+type GreaseOptions struct {
+	TransportParameters bool // Sends transport parameters with reserved identifiers of the form 31 * N + 27
+	Version             bool // Sends the first Initial packets with a reserved version of the form 0x?a?a?a?a
+	QuicBit             bool // Advertises grease_quic_bit and clears the QUIC bit when the peer also advertised it, see RFC 9287
+}
+
+// Returns a random reserved transport parameter identifier, see RFC 9000 Section 18.1.
+func GreaseTransportParameterType() TransportParametersType {
+	return TransportParametersType(31*uint64(rand.Uint32()) + 27)
+}
+
+// Returns a random reserved version, see RFC 9000 Section 15.
+func GreaseVersion() uint32 {
+	return rand.Uint32()&0xf0f0f0f0 | 0x0a0a0a0a
+}
+
+// Returns a random frame type of the same form as reserved transport parameter identifiers. No frame types are
+// reserved in QUIC, so it is not expected to be ignored and should be rejected as unknown, see RFC 9000 Section 12.4.
+func GreaseFrameType() uint64 {
+	return 31*uint64(1+rand.Intn(1<<20)) + 27
+}
+
+func IsGreaseVersion(version uint32) bool {
+	return version&0x0f0f0f0f == 0x0a0a0a0a
+}
+
+// Sets the greasing options of the connection. When greasing the version, it must be called before the first Initial
+// packet is sent.
+func (c *Connection) SetGrease(options GreaseOptions) {
+	c.Grease = options
+	c.greaseTransportParameters()
+	if options.Version {
+		c.Version = GreaseVersion()
+	}
+}
+
+func (c *Connection) greaseTransportParameters() {
+	c.TLSTPHandler.GreaseQuicBit = c.Grease.QuicBit
+	if c.Grease.TransportParameters {
+		for i := 0; i < 2; i++ {
+			p := TransportParameter{ParameterType: GreaseTransportParameterType(), Value: make([]byte, rand.Intn(16))}
+			rand.Read(p.Value)
+			c.TLSTPHandler.AdditionalParameters.AddParameter(p)
+		}
+		p := TransportParameter{ParameterType: GreaseTransportParameterType(), Value: make([]byte, 4)}
+		binary.BigEndian.PutUint32(p.Value, rand.Uint32())
+		c.TLSTPHandler.AdditionalParameters.AddParameter(p)
+	}
+}
+
+// Returns whether the QUIC bit of the packets sent can be cleared, i.e. whether both endpoints advertised the
+// grease_quic_bit transport parameter.
+func (c *Connection) ClearQuicBit() bool {
+	return c.Grease.QuicBit && c.TLSTPHandler.ReceivedParameters != nil && c.TLSTPHandler.ReceivedParameters.GreaseQuicBit
+}
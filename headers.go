@@ -71,10 +71,14 @@ type LongHeader struct {
 	Length         VarInt
 	PacketNumber   PacketNumber
 	TruncatedPN    TruncatedPN
+	QuicBitCleared bool
 }
 func (h *LongHeader) Encode() []byte {
 	buffer := new(bytes.Buffer)
 	typeByte := uint8(0xC0)
+	if h.QuicBitCleared {
+		typeByte &^= 0x40
+	}
 	typeByte |= uint8(h.PacketType) << 4
 	typeByte |= uint8(h.TruncatedPN.Length) - 1
 	binary.Write(buffer, binary.BigEndian, typeByte)
@@ -118,7 +122,8 @@ func ReadLongHeader(buffer *bytes.Reader, conn *Connection) *LongHeader {
 	h := new(LongHeader)
 	typeByte, _ := buffer.ReadByte()
 	h.LowerBits = typeByte & 0x0F
-	h.PacketType = PacketType(typeByte - 0xC0) >> 4
+	h.PacketType = PacketType(typeByte & 0x30) >> 4
+	h.QuicBitCleared = typeByte & 0x40 == 0
 	binary.Read(buffer, binary.BigEndian, &h.Version)
 	DCIL, _ := buffer.ReadByte()
 	h.DestinationCID = make([]byte, DCIL, DCIL)
@@ -134,7 +139,7 @@ func ReadLongHeader(buffer *bytes.Reader, conn *Connection) *LongHeader {
 	if h.PacketType != Retry {
 		h.Length, _ = ReadVarInt(buffer)
 		h.TruncatedPN = ReadTruncatedPN(buffer, int(typeByte & 0x3) + 1)
-		h.PacketNumber = h.TruncatedPN.Join(conn.LargestPNsReceived[h.PacketType.PNSpace()])
+		h.PacketNumber = conn.DecodePacketNumber(h.TruncatedPN, h.PacketType.PNSpace())
 	}
 	return h
 }
@@ -149,8 +154,9 @@ func NewLongHeader(packetType PacketType, conn *Connection, space PNSpace) *Long
 		h.DestinationCID = conn.DestinationCID
 	}
 	h.TokenLength = NewVarInt(0)
+	h.QuicBitCleared = conn.ClearQuicBit()
 	h.PacketNumber = conn.nextPacketNumber(space)
-	h.TruncatedPN = h.PacketNumber.Truncate(conn.LargestPNsAcknowledged[h.PacketType.PNSpace()])
+	h.TruncatedPN = conn.TruncatePacketNumber(h.PacketNumber, h.PacketType.PNSpace())
 	return h
 }
 
@@ -168,11 +174,15 @@ type ShortHeader struct {
 	DestinationCID ConnectionID
 	TruncatedPN    TruncatedPN
 	PacketNumber   PacketNumber
+	QuicBitCleared bool
+	ReservedBits   byte
 }
 func (h *ShortHeader) Encode() []byte {
 	buffer := new(bytes.Buffer)
 	var typeByte uint8
-	typeByte |= 0x40
+	if !h.QuicBitCleared {
+		typeByte |= 0x40
+	}
 	if h.SpinBit == SpinValueOne {
 		typeByte |= 0x20
 	}
@@ -206,11 +216,13 @@ func ReadShortHeader(buffer *bytes.Reader, conn *Connection) *ShortHeader {
 	typeByte, _ := buffer.ReadByte()
 	h.SpinBit = (typeByte & 0x20) == 0x20
 	h.KeyPhase = (typeByte & 0x04) == 0x04
+	h.QuicBitCleared = (typeByte & 0x40) == 0
+	h.ReservedBits = (typeByte & 0x18) >> 3
 
 	h.DestinationCID = make([]byte, len(conn.SourceCID))
 	buffer.Read(h.DestinationCID)
 	h.TruncatedPN = ReadTruncatedPN(buffer, int(typeByte&0x3) + 1)
-	h.PacketNumber = h.TruncatedPN.Join(conn.LargestPNsReceived[PNSpaceAppData])
+	h.PacketNumber = conn.DecodePacketNumber(h.TruncatedPN, PNSpaceAppData)
 	return h
 }
 func NewShortHeader(conn *Connection) *ShortHeader {
@@ -218,8 +230,9 @@ func NewShortHeader(conn *Connection) *ShortHeader {
 	h.SpinBit = conn.SpinBit
 	h.KeyPhase = conn.KeyPhaseIndex % 2 == 1
 	h.DestinationCID = conn.DestinationCID
+	h.QuicBitCleared = conn.ClearQuicBit()
 	h.PacketNumber = conn.nextPacketNumber(PNSpaceAppData)
-	h.TruncatedPN = h.PacketNumber.Truncate(conn.LargestPNsAcknowledged[PNSpaceAppData])
+	h.TruncatedPN = conn.TruncatePacketNumber(h.PacketNumber, PNSpaceAppData)
 	return h
 }
 
@@ -0,0 +1,55 @@
+package http3
+
+import (
+	"bytes"
+	"io"
+
+	. "github.com/PROGNOSISTool/adapter-quic"
+)
+
+const (
+	CapsuleTypeDATAGRAM = 0x00
+
+	CapsuleProtocolFieldName = "capsule-protocol"
+)
+
+// A Capsule is a type-length-value message sent in the DATA frames of a request stream using the Capsule Protocol,
+// see RFC 9297 Section 3.2.
+type Capsule struct {
+	Type  uint64
+	Value []byte
+}
+
+func (c Capsule) WriteTo(buffer *bytes.Buffer) {
+	buffer.Write(NewVarInt(c.Type).Encode())
+	buffer.Write(NewVarInt(uint64(len(c.Value))).Encode())
+	buffer.Write(c.Value)
+}
+
+func (c Capsule) Encode() []byte {
+	buffer := new(bytes.Buffer)
+	c.WriteTo(buffer)
+	return buffer.Bytes()
+}
+
+// Reads a capsule from the buffer. It returns io.ErrUnexpectedEOF when the buffer does not contain a complete capsule.
+func ReadCapsule(buffer *bytes.Reader) (Capsule, error) {
+	c := Capsule{}
+	capsuleType, err := ReadVarInt(buffer)
+	if err != nil {
+		return c, io.ErrUnexpectedEOF
+	}
+	length, err := ReadVarInt(buffer)
+	if err != nil || uint64(buffer.Len()) < length.Value {
+		return c, io.ErrUnexpectedEOF
+	}
+	c.Type = capsuleType.Value
+	c.Value = make([]byte, length.Value)
+	buffer.Read(c.Value)
+	return c, nil
+}
+
+// Returns a DATAGRAM capsule carrying the given HTTP Datagram Payload.
+func NewDATAGRAMCapsule(payload []byte) Capsule {
+	return Capsule{CapsuleTypeDATAGRAM, payload}
+}
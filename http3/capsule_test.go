@@ -0,0 +1,64 @@
+package http3
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestCapsule_RoundTrip(t *testing.T) {
+	capsules := []Capsule{NewDATAGRAMCapsule([]byte("payload")), {0x2a, nil}, {0x3fff, bytes.Repeat([]byte{0xff}, 100)}}
+	buffer := new(bytes.Buffer)
+	for _, c := range capsules {
+		c.WriteTo(buffer)
+	}
+	r := bytes.NewReader(buffer.Bytes())
+	for _, expected := range capsules {
+		c, err := ReadCapsule(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Type != expected.Type || !bytes.Equal(c.Value, expected.Value) {
+			t.Errorf("Expected capsule %v, got %v", expected, c)
+		}
+	}
+	if r.Len() != 0 {
+		t.Errorf("Expected the buffer to be read entirely, %d bytes remain", r.Len())
+	}
+}
+
+func TestReadCapsule_Truncated(t *testing.T) {
+	encoded := NewDATAGRAMCapsule([]byte("payload")).Encode()
+	for i := 0; i < len(encoded); i++ {
+		if _, err := ReadCapsule(bytes.NewReader(encoded[:i])); err != io.ErrUnexpectedEOF {
+			t.Errorf("Expected io.ErrUnexpectedEOF when reading %d bytes, got %v", i, err)
+		}
+	}
+}
+
+func TestDatagram_RoundTrip(t *testing.T) {
+	for _, streamID := range []uint64{0, 4, 256, MaxQuarterStreamID * 4} {
+		d := NewDatagram(streamID, []byte("payload"))
+		read, err := ReadDatagram(d.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(read, d) || read.StreamID() != streamID {
+			t.Errorf("Expected datagram %v on stream %d, got %v", d, streamID, read)
+		}
+	}
+}
+
+func TestReadDatagram_Invalid(t *testing.T) {
+	if _, err := ReadDatagram(nil); err == nil {
+		t.Error("Expected an error for an empty datagram")
+	}
+	if _, err := ReadDatagram([]byte{0x40}); err == nil {
+		t.Error("Expected an error for a truncated quarter stream ID")
+	}
+	// The largest varint, which exceeds the largest quarter stream ID
+	if _, err := ReadDatagram([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}); err == nil {
+		t.Error("Expected an error for a quarter stream ID exceeding the largest stream ID")
+	}
+}
@@ -0,0 +1,46 @@
+package http3
+
+import (
+	"bytes"
+	"errors"
+
+	. "github.com/PROGNOSISTool/adapter-quic"
+)
+
+// The largest quarter stream ID, as stream IDs are limited to 2^62 - 1.
+const MaxQuarterStreamID = (1<<62 - 1) / 4
+
+// A Datagram is an HTTP Datagram carried in the payload of a QUIC DATAGRAM frame, see RFC 9297 Section 2.1. It is
+// associated with the request stream identified by its quarter stream ID.
+type Datagram struct {
+	QuarterStreamID uint64
+	Payload         []byte
+}
+
+// Returns the ID of the client-initiated bidirectional stream the datagram is associated with.
+func (d Datagram) StreamID() uint64 {
+	return d.QuarterStreamID * 4
+}
+
+func (d Datagram) Encode() []byte {
+	buffer := new(bytes.Buffer)
+	buffer.Write(NewVarInt(d.QuarterStreamID).Encode())
+	buffer.Write(d.Payload)
+	return buffer.Bytes()
+}
+
+func ReadDatagram(data []byte) (Datagram, error) {
+	buffer := bytes.NewReader(data)
+	quarterStreamID, err := ReadVarInt(buffer)
+	if err != nil {
+		return Datagram{}, errors.New("truncated quarter stream ID")
+	}
+	if quarterStreamID.Value > MaxQuarterStreamID {
+		return Datagram{}, errors.New("quarter stream ID exceeds the largest stream ID")
+	}
+	return Datagram{quarterStreamID.Value, data[quarterStreamID.Length:]}, nil
+}
+
+func NewDatagram(streamID uint64, payload []byte) Datagram {
+	return Datagram{streamID / 4, payload}
+}
@@ -14,15 +14,68 @@ const (
 	StreamTypePush    = 0x01
 )
 
+// The error codes of HTTP/3, see RFC 9114 Section 8.1.
+const (
+	H3_NO_ERROR               = 0x0100
+	H3_GENERAL_PROTOCOL_ERROR = 0x0101
+	H3_INTERNAL_ERROR         = 0x0102
+	H3_STREAM_CREATION_ERROR  = 0x0103
+	H3_CLOSED_CRITICAL_STREAM = 0x0104
+	H3_FRAME_UNEXPECTED       = 0x0105
+	H3_FRAME_ERROR            = 0x0106
+	H3_EXCESSIVE_LOAD         = 0x0107
+	H3_ID_ERROR               = 0x0108
+	H3_SETTINGS_ERROR         = 0x0109
+	H3_MISSING_SETTINGS       = 0x010a
+	H3_REQUEST_REJECTED       = 0x010b
+	H3_REQUEST_CANCELLED      = 0x010c
+	H3_REQUEST_INCOMPLETE     = 0x010d
+	H3_MESSAGE_ERROR          = 0x010e
+	H3_CONNECT_ERROR          = 0x010f
+	H3_VERSION_FALLBACK       = 0x0110
+	H3_DATAGRAM_ERROR         = 0x33 // See RFC 9297
+)
+
+var errorCodeNames = map[uint64]string{
+	H3_NO_ERROR:               "H3_NO_ERROR",
+	H3_GENERAL_PROTOCOL_ERROR: "H3_GENERAL_PROTOCOL_ERROR",
+	H3_INTERNAL_ERROR:         "H3_INTERNAL_ERROR",
+	H3_STREAM_CREATION_ERROR:  "H3_STREAM_CREATION_ERROR",
+	H3_CLOSED_CRITICAL_STREAM: "H3_CLOSED_CRITICAL_STREAM",
+	H3_FRAME_UNEXPECTED:       "H3_FRAME_UNEXPECTED",
+	H3_FRAME_ERROR:            "H3_FRAME_ERROR",
+	H3_EXCESSIVE_LOAD:         "H3_EXCESSIVE_LOAD",
+	H3_ID_ERROR:               "H3_ID_ERROR",
+	H3_SETTINGS_ERROR:         "H3_SETTINGS_ERROR",
+	H3_MISSING_SETTINGS:       "H3_MISSING_SETTINGS",
+	H3_REQUEST_REJECTED:       "H3_REQUEST_REJECTED",
+	H3_REQUEST_CANCELLED:      "H3_REQUEST_CANCELLED",
+	H3_REQUEST_INCOMPLETE:     "H3_REQUEST_INCOMPLETE",
+	H3_MESSAGE_ERROR:          "H3_MESSAGE_ERROR",
+	H3_CONNECT_ERROR:          "H3_CONNECT_ERROR",
+	H3_VERSION_FALLBACK:       "H3_VERSION_FALLBACK",
+	H3_DATAGRAM_ERROR:         "H3_DATAGRAM_ERROR",
+}
+
+// Returns the name of the given HTTP/3 error code, or its value when it is unknown.
+func ErrorCodeName(errorCode uint64) string {
+	if name, ok := errorCodeNames[errorCode]; ok {
+		return name
+	}
+	return fmt.Sprintf("%#x", errorCode)
+}
+
 const (
 	FrameTypeDATA         = 0x0
 	FrameTypeHEADERS      = 0x1
-	FrameTypePRIORITY     = 0x2
 	FrameTypeCANCEL_PUSH  = 0x3
 	FrameTypeSETTINGS     = 0x4
 	FrameTypePUSH_PROMISE = 0x5
 	FrameTypeGOAWAY       = 0x7
 	FrameTypeMAX_PUSH_ID  = 0xd
+
+	FrameTypePRIORITY_UPDATE_REQUEST = 0xf0700
+	FrameTypePRIORITY_UPDATE_PUSH    = 0xf0701
 )
 
 func ReadHTTPFrame(buffer *bytes.Reader) HTTPFrame {
@@ -33,8 +86,6 @@ func ReadHTTPFrame(buffer *bytes.Reader) HTTPFrame {
 		return ReadDATA(buffer)
 	case FrameTypeHEADERS:
 		return ReadHEADERS(buffer)
-	case FrameTypePRIORITY:
-		return ReadPRIORITY(buffer)
 	case FrameTypeCANCEL_PUSH:
 		return ReadCANCEL_PUSH(buffer)
 	case FrameTypeSETTINGS:
@@ -45,11 +96,42 @@ func ReadHTTPFrame(buffer *bytes.Reader) HTTPFrame {
 		return ReadGOAWAY(buffer)
 	case FrameTypeMAX_PUSH_ID:
 		return ReadMAX_PUSH_ID(buffer)
+	case FrameTypePRIORITY_UPDATE_REQUEST, FrameTypePRIORITY_UPDATE_PUSH:
+		return ReadPRIORITY_UPDATE(buffer)
 	default:
 		return ReadUnknownFrame(buffer)
 	}
 }
 
+// Returns whether the frame type is reserved as it was used in HTTP/2, see RFC 9114 Section 7.2.8.
+func IsHTTP2FrameType(frameType uint64) bool {
+	switch frameType {
+	case 0x2, 0x6, 0x8, 0x9:
+		return true
+	}
+	return false
+}
+
+// Returns whether a frame of the given type can be received on the control stream, see RFC 9114 Section 7.2.
+func AllowedOnControlStream(frameType uint64) bool {
+	switch frameType {
+	case FrameTypeDATA, FrameTypeHEADERS, FrameTypePUSH_PROMISE:
+		return false
+	}
+	return !IsHTTP2FrameType(frameType)
+}
+
+// Returns whether a frame of the given type can be received on a request stream, or on a push stream.
+func AllowedOnRequestStream(frameType uint64, pushStream bool) bool {
+	switch frameType {
+	case FrameTypeCANCEL_PUSH, FrameTypeSETTINGS, FrameTypeGOAWAY, FrameTypeMAX_PUSH_ID, FrameTypePRIORITY_UPDATE_REQUEST, FrameTypePRIORITY_UPDATE_PUSH:
+		return false
+	case FrameTypePUSH_PROMISE:
+		return !pushStream
+	}
+	return !IsHTTP2FrameType(frameType)
+}
+
 type HTTPFrame interface {
 	FrameType() uint64
 	Name() string
@@ -120,64 +202,40 @@ func NewHEADERS(headerBlock []byte) *HEADERS {
 	return &HEADERS{HTTPFrameHeader{NewVarInt(FrameTypeHEADERS), NewVarInt(uint64(len(headerBlock)))}, headerBlock}
 }
 
-const (
-	ElementTypeRequestStream = 0x00
-	ElementTypePushStream    = 0x01
-	ElementTypePlaceholder   = 0x10
-	ElementTypeRootOfTheTree = 0x11
-)
-
-type PRIORITY struct {
+type PRIORITY_UPDATE struct {
 	HTTPFrameHeader
-	PrioritizedType      uint8
-	DependencyType       uint8
-	Empty                uint8
-	Exclusive            bool
 	PrioritizedElementID VarInt
-	ElementDependencyID  VarInt
-	Weight               uint8
+	PriorityFieldValue   string
 }
 
-func (f *PRIORITY) Name() string { return "PRIORITY" }
-func (f *PRIORITY) WriteTo(buffer *bytes.Buffer) {
+func (f *PRIORITY_UPDATE) Name() string { return "PRIORITY_UPDATE" }
+func (f *PRIORITY_UPDATE) WriteTo(buffer *bytes.Buffer) {
 	f.HTTPFrameHeader.WriteTo(buffer)
-	firstByte := (f.PrioritizedType << 6) | (f.DependencyType << 4) | (f.Empty << 1)
-	if f.Exclusive {
-		firstByte |= 0x1
-	}
-	buffer.WriteByte(firstByte)
 	buffer.Write(f.PrioritizedElementID.Encode())
-	buffer.Write(f.ElementDependencyID.Encode())
-	buffer.WriteByte(f.Weight)
-}
-func ReadPRIORITY(buffer *bytes.Reader) *PRIORITY {
-	f := PRIORITY{HTTPFrameHeader: ReadHTTPFrameHeader(buffer)}
-	firstByte, _ := buffer.ReadByte()
-	f.PrioritizedType = (firstByte & 0xc0) >> 6
-	f.DependencyType = (firstByte & 0x30) >> 4
-	f.Empty = (firstByte & 0xe) >> 1
-	f.Exclusive = (firstByte & 0x1) == 0x1
+	buffer.WriteString(f.PriorityFieldValue)
+}
+func (f *PRIORITY_UPDATE) Priority() Priority { return ParsePriority(f.PriorityFieldValue) }
+func ReadPRIORITY_UPDATE(buffer *bytes.Reader) *PRIORITY_UPDATE {
+	f := PRIORITY_UPDATE{HTTPFrameHeader: ReadHTTPFrameHeader(buffer)}
 	f.PrioritizedElementID, _ = ReadVarInt(buffer)
-	f.ElementDependencyID, _ = ReadVarInt(buffer)
-	f.Weight, _ = buffer.ReadByte()
+	if f.Length.Value > uint64(f.PrioritizedElementID.Length) {
+		fieldValue := make([]byte, f.Length.Value-uint64(f.PrioritizedElementID.Length))
+		buffer.Read(fieldValue)
+		f.PriorityFieldValue = string(fieldValue)
+	}
 	return &f
 }
-func NewPRIORITY(prioritizedType uint8,
-	dependencyType uint8,
-	exclusive bool,
-	prioritizedElementID uint64,
-	elementDependencyID uint64,
-	weight uint8,
-) *PRIORITY {
-	return &PRIORITY{
-		HTTPFrameHeader{NewVarInt(FrameTypePRIORITY), NewVarInt(uint64(1 + lib.VarIntLen(prioritizedElementID) + lib.VarIntLen(elementDependencyID) + 1))},
-		prioritizedType,
-		dependencyType,
-		0,
-		exclusive,
+// Creates a PRIORITY_UPDATE frame for a request stream, or for a push when push is true.
+func NewPRIORITY_UPDATE(push bool, prioritizedElementID uint64, priority Priority) *PRIORITY_UPDATE {
+	frameType := uint64(FrameTypePRIORITY_UPDATE_REQUEST)
+	if push {
+		frameType = FrameTypePRIORITY_UPDATE_PUSH
+	}
+	fieldValue := priority.String()
+	return &PRIORITY_UPDATE{
+		HTTPFrameHeader{NewVarInt(frameType), NewVarInt(uint64(lib.VarIntLen(prioritizedElementID) + len(fieldValue)))},
 		NewVarInt(prioritizedElementID),
-		NewVarInt(elementDependencyID),
-		weight,
+		fieldValue,
 	}
 }
 
@@ -212,6 +270,9 @@ func (s Setting) WriteTo(buffer *bytes.Buffer) {
 	buffer.Write(s.Identifier.Encode())
 	buffer.Write(s.Value.Encode())
 }
+func NewSetting(identifier uint64, value uint64) Setting {
+	return Setting{NewVarInt(identifier), NewVarInt(value)}
+}
 func ReadSetting(buffer *bytes.Reader) Setting {
 	s := Setting{}
 	s.Identifier, _ = ReadVarInt(buffer)
@@ -220,10 +281,13 @@ func ReadSetting(buffer *bytes.Reader) Setting {
 }
 
 const (
-	SETTINGS_HEADER_TABLE_SIZE     = 0x01
-	SETTINGS_MAX_HEADER_LIST_SIZE  = 0x06
-	SETTINGS_QPACK_BLOCKED_STREAMS = 0x07
-	SETTINGS_NUM_PLACEHOLDERS      = 0x09
+	SETTINGS_QPACK_MAX_TABLE_CAPACITY = 0x01
+	SETTINGS_MAX_FIELD_SECTION_SIZE   = 0x06
+	SETTINGS_QPACK_BLOCKED_STREAMS    = 0x07
+	SETTINGS_NUM_PLACEHOLDERS         = 0x09
+
+	SETTINGS_ENABLE_CONNECT_PROTOCOL = 0x08 // See RFC 9220
+	SETTINGS_H3_DATAGRAM             = 0x33 // See RFC 9297
 )
 
 type SETTINGS struct {
@@ -248,10 +312,25 @@ func ReadSETTINGS(buffer *bytes.Reader) *SETTINGS {
 	}
 	return &f
 }
+// Returns whether the setting identifier is reserved as it was used in HTTP/2, or is the reserved identifier 0x00, see
+// RFC 9114 Sections 7.2.4.1 and 11.2.2.
+func IsHTTP2Setting(identifier uint64) bool {
+	return identifier == 0x00 || (identifier >= 0x02 && identifier <= 0x05)
+}
+
+// Returns the value of the given setting, if present.
+func (f *SETTINGS) Get(identifier uint64) (uint64, bool) {
+	for _, s := range f.Settings {
+		if s.Identifier.Value == identifier {
+			return s.Value.Value, true
+		}
+	}
+	return 0, false
+}
 func NewSETTINGS(settings []Setting) *SETTINGS {
 	length := 0
 	for _, s := range settings {
-		length += s.Value.Length + 2
+		length += s.Identifier.Length + s.Value.Length
 	}
 	return &SETTINGS{
 		HTTPFrameHeader{NewVarInt(FrameTypeSETTINGS), NewVarInt(uint64(length))},
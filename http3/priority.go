@@ -0,0 +1,57 @@
+package http3
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultUrgency    = 3
+	LowestUrgency     = 7
+	PriorityFieldName = "priority"
+)
+
+// The priority parameters of a request, see RFC 9218 Section 4. They are carried in the priority header field and in
+// PRIORITY_UPDATE frames.
+type Priority struct {
+	Urgency     uint8 // From 0, the most urgent, to 7
+	Incremental bool
+}
+
+var DefaultPriority = Priority{DefaultUrgency, false}
+
+// Serialises the parameters as a Structured Fields Dictionary, e.g. "u=1, i".
+func (p Priority) String() string {
+	s := fmt.Sprintf("u=%d", p.Urgency)
+	if p.Incremental {
+		s += ", i"
+	}
+	return s
+}
+
+// Parses a priority field value. As required by RFC 9218, unknown parameters and invalid values are ignored and the
+// default values are used instead.
+func ParsePriority(fieldValue string) Priority {
+	p := DefaultPriority
+	for _, member := range strings.Split(fieldValue, ",") {
+		member = strings.TrimSpace(member)
+		if i := strings.IndexByte(member, ';'); i >= 0 { // Parameters of the member are ignored
+			member = member[:i]
+		}
+		key, value, hasValue := strings.Cut(member, "=")
+		switch key {
+		case "u":
+			if u, err := strconv.ParseUint(value, 10, 8); err == nil && u <= LowestUrgency {
+				p.Urgency = uint8(u)
+			}
+		case "i":
+			if !hasValue || value == "?1" {
+				p.Incremental = true
+			} else if value == "?0" {
+				p.Incremental = false
+			}
+		}
+	}
+	return p
+}
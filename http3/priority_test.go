@@ -0,0 +1,60 @@
+package http3
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParsePriority(t *testing.T) {
+	tests := []struct {
+		fieldValue string
+		expected   Priority
+	}{
+		{"", DefaultPriority},
+		{"u=0", Priority{0, false}},
+		{"u=7", Priority{7, false}},
+		{"u=8", DefaultPriority},
+		{"u=-1", DefaultPriority},
+		{"u=256", DefaultPriority},
+		{"u=x", DefaultPriority},
+		{"i", Priority{DefaultUrgency, true}},
+		{"i=?1", Priority{DefaultUrgency, true}},
+		{"i=?0", DefaultPriority},
+		{"i=1", DefaultPriority},
+		{"u=1, i", Priority{1, true}},
+		{"u=5;a=b, i;c", Priority{5, true}},
+		{"x=1, u=2, y", Priority{2, false}},
+	}
+	for _, test := range tests {
+		if p := ParsePriority(test.fieldValue); p != test.expected {
+			t.Errorf("Expected %q to be parsed as %v, got %v", test.fieldValue, test.expected, p)
+		}
+	}
+	for _, p := range []Priority{DefaultPriority, {0, true}, {LowestUrgency, false}} {
+		if parsed := ParsePriority(p.String()); parsed != p {
+			t.Errorf("Expected %q to be parsed as %v, got %v", p.String(), p, parsed)
+		}
+	}
+}
+
+func TestPRIORITY_UPDATE_RoundTrip(t *testing.T) {
+	for _, push := range []bool{false, true} {
+		f := NewPRIORITY_UPDATE(push, 1<<20, Priority{1, true})
+		buffer := new(bytes.Buffer)
+		f.WriteTo(buffer)
+		read, ok := ReadHTTPFrame(bytes.NewReader(buffer.Bytes())).(*PRIORITY_UPDATE)
+		if !ok {
+			t.Fatalf("Expected a PRIORITY_UPDATE frame, got %x", buffer.Bytes())
+		}
+		expectedType := uint64(FrameTypePRIORITY_UPDATE_REQUEST)
+		if push {
+			expectedType = FrameTypePRIORITY_UPDATE_PUSH
+		}
+		if read.FrameType() != expectedType || read.PrioritizedElementID.Value != 1<<20 || read.Priority() != (Priority{1, true}) {
+			t.Errorf("Unexpected PRIORITY_UPDATE frame %+v", read)
+		}
+		if read.Length.Value != uint64(read.PrioritizedElementID.Length+len("u=1, i")) {
+			t.Errorf("Unexpected frame length %d", read.Length.Value)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package http3
+
+import "testing"
+
+func TestIsHTTP2Setting(t *testing.T) {
+	for identifier, reserved := range map[uint64]bool{
+		0x00:                              true,
+		SETTINGS_QPACK_MAX_TABLE_CAPACITY: false,
+		0x02:                              true,
+		0x03:                              true,
+		0x04:                              true,
+		0x05:                              true,
+		SETTINGS_MAX_FIELD_SECTION_SIZE:   false,
+		SETTINGS_QPACK_BLOCKED_STREAMS:    false,
+		SETTINGS_ENABLE_CONNECT_PROTOCOL:  false,
+		SETTINGS_H3_DATAGRAM:              false,
+	} {
+		if IsHTTP2Setting(identifier) != reserved {
+			t.Errorf("Expected IsHTTP2Setting(%#x) to be %v", identifier, reserved)
+		}
+	}
+}
@@ -38,6 +38,10 @@ const (
 	ConnectionCloseFrameJSON
 	ApplicationCloseFrameJSON
 	HandshakeDoneFrameJSON
+	DatagramFrameJSON
+	AckFrequencyFrameJSON
+	ImmediateAckFrameJSON
+	GreaseFrameJSON
 )
 
 var JSONTypeHandlers = map[JSONType]func() interface{} {
@@ -74,6 +78,10 @@ var JSONTypeHandlers = map[JSONType]func() interface{} {
 	ConnectionCloseFrameJSON:   func() interface{} { type local ConnectionCloseFrame; return new(local) },
 	ApplicationCloseFrameJSON:  func() interface{} { type local ApplicationCloseFrame; return new(local) },
 	HandshakeDoneFrameJSON:     func() interface{} { type local HandshakeDoneFrame; return new(local) },
+	DatagramFrameJSON:          func() interface{} { type local DatagramFrame; return new(local) },
+	AckFrequencyFrameJSON:      func() interface{} { type local AckFrequencyFrame; return new(local) },
+	ImmediateAckFrameJSON:      func() interface{} { type local ImmediateAckFrame; return new(local) },
+	GreaseFrameJSON:            func() interface{} { type local GreaseFrame; return new(local) },
 }
 
 type Envelope struct {
@@ -40,6 +40,10 @@ var (
 		"ConnectionCloseFrameJSON":     ConnectionCloseFrameJSON,
 		"ApplicationCloseFrameJSON":    ApplicationCloseFrameJSON,
 		"HandshakeDoneFrameJSON":       HandshakeDoneFrameJSON,
+		"DatagramFrameJSON":            DatagramFrameJSON,
+		"AckFrequencyFrameJSON":        AckFrequencyFrameJSON,
+		"ImmediateAckFrameJSON":        ImmediateAckFrameJSON,
+		"GreaseFrameJSON":              GreaseFrameJSON,
 	}
 
 	_JSONTypeValueToName = map[JSONType]string{
@@ -74,6 +78,10 @@ var (
 		ConnectionCloseFrameJSON:     "ConnectionCloseFrameJSON",
 		ApplicationCloseFrameJSON:    "ApplicationCloseFrameJSON",
 		HandshakeDoneFrameJSON:       "HandshakeDoneFrameJSON",
+		DatagramFrameJSON:            "DatagramFrameJSON",
+		AckFrequencyFrameJSON:        "AckFrequencyFrameJSON",
+		ImmediateAckFrameJSON:        "ImmediateAckFrameJSON",
+		GreaseFrameJSON:              "GreaseFrameJSON",
 	}
 )
 
@@ -112,6 +120,10 @@ func init() {
 			interface{}(ConnectionCloseFrameJSON).(fmt.Stringer).String():     ConnectionCloseFrameJSON,
 			interface{}(ApplicationCloseFrameJSON).(fmt.Stringer).String():    ApplicationCloseFrameJSON,
 			interface{}(HandshakeDoneFrameJSON).(fmt.Stringer).String():       HandshakeDoneFrameJSON,
+			interface{}(DatagramFrameJSON).(fmt.Stringer).String():            DatagramFrameJSON,
+			interface{}(AckFrequencyFrameJSON).(fmt.Stringer).String():        AckFrequencyFrameJSON,
+			interface{}(ImmediateAckFrameJSON).(fmt.Stringer).String():        ImmediateAckFrameJSON,
+			interface{}(GreaseFrameJSON).(fmt.Stringer).String():              GreaseFrameJSON,
 		}
 	}
 }
@@ -0,0 +1,160 @@
+package qlog
+
+import (
+	"reflect"
+	"time"
+)
+
+// An RTTSample is the RTT estimation of an endpoint at a given time, with durations in milliseconds.
+type RTTSample struct {
+	Time        time.Duration // Relative to the reference time of the trace
+	LatestRTT   float64
+	SmoothedRTT float64
+	MinRTT      float64
+	RTTVariance float64
+}
+
+// Returns the RTT estimations reported by the metrics_updated events of the trace.
+func (t *Trace) RTTSeries() []RTTSample {
+	var series []RTTSample
+	for _, e := range t.Events {
+		m, ok := e.Data.(*MetricUpdate)
+		if !ok || e.Event != "metrics_updated" || (m.LatestRTT == 0 && m.SmoothedRTT == 0 && m.MinRTT == 0) {
+			continue
+		}
+		series = append(series, RTTSample{e.Time(), m.LatestRTT, m.SmoothedRTT, m.MinRTT, m.RTTVariance})
+	}
+	return series
+}
+
+type Retransmissions struct {
+	PacketsLost         int            // The number of packet_lost events
+	LostByPacketType    map[string]int // The packets lost per packet type
+	FramesRetransmitted int            // The STREAM and CRYPTO frames sent with data that was already sent
+	BytesRetransmitted  uint64         // The amount of data these frames carried again
+}
+
+// Counts the packets declared lost and the data sent more than once in STREAM and CRYPTO frames by the vantage point
+// of the trace. The CRYPTO streams are told apart using the type of the packets carrying them.
+func (t *Trace) RetransmissionCounts() Retransmissions {
+	r := Retransmissions{LostByPacketType: make(map[string]int)}
+	streamsSent := make(map[uint64]uint64) // The largest offset sent per stream
+	cryptoSent := make(map[string]uint64)  // The largest offset sent per packet type
+	countFrame := func(largest uint64, offset uint64, length uint64) uint64 {
+		if offset < largest {
+			r.FramesRetransmitted++
+			if offset+length < largest {
+				r.BytesRetransmitted += length
+			} else {
+				r.BytesRetransmitted += largest - offset
+			}
+		}
+		if offset+length > largest {
+			return offset + length
+		}
+		return largest
+	}
+
+	for _, e := range t.Events {
+		switch d := e.Data.(type) {
+		case *PacketLost:
+			r.PacketsLost++
+			r.LostByPacketType[d.Header.PacketType]++
+		case *Packet:
+			if e.Event != "packet_sent" {
+				continue
+			}
+			for _, f := range d.Frames {
+				switch frame := f.(type) {
+				case *StreamFrame:
+					streamsSent[frame.StreamID] = countFrame(streamsSent[frame.StreamID], frame.Offset, frame.Length)
+				case *CryptoFrame:
+					cryptoSent[d.Header.PacketType] = countFrame(cryptoSent[d.Header.PacketType], frame.Offset, frame.Length)
+				}
+			}
+		}
+	}
+	return r
+}
+
+// A FrameHistogram counts the frames of each type sent and received.
+type FrameHistogram struct {
+	Sent     map[string]int
+	Received map[string]int
+}
+
+// Returns the number of frames of each type carried by the packets sent and received in the trace.
+func (t *Trace) FrameHistogram() FrameHistogram {
+	h := FrameHistogram{make(map[string]int), make(map[string]int)}
+	for _, e := range t.Events {
+		p, ok := e.Data.(*Packet)
+		if !ok {
+			continue
+		}
+		counts := h.Sent
+		if e.Event == "packet_received" {
+			counts = h.Received
+		}
+		for _, f := range p.Frames {
+			counts[FrameType(f)]++
+		}
+	}
+	return h
+}
+
+// Returns the time elapsed between the start of the connection, i.e. the first packet it sent or received, and the
+// completion of the handshake, i.e. the first connection_state_updated event to handshake_complete or
+// handshake_confirmed. When the trace contains no such event, the first HANDSHAKE_DONE frame sent or received marks the
+// completion of the handshake. It returns false if the trace does not contain the start or the completion of the
+// handshake.
+func (t *Trace) HandshakeDuration() (time.Duration, bool) {
+	var start, stateCompleted, handshakeDone *Event
+	for _, e := range t.Events {
+		switch d := e.Data.(type) {
+		case *Packet:
+			if start == nil {
+				start = e
+			}
+			if handshakeDone == nil {
+				for _, f := range d.Frames {
+					if FrameType(f) == "handshake_done" {
+						handshakeDone = e
+					}
+				}
+			}
+		case *ConnectionStateUpdated:
+			if stateCompleted == nil && (d.New == ConnectionStateHandshakeComplete || d.New == ConnectionStateHandshakeConfirmed) {
+				stateCompleted = e
+			}
+		}
+	}
+	end := stateCompleted
+	if end == nil {
+		end = handshakeDone
+	}
+	if start == nil || end == nil || end.RelativeTime < start.RelativeTime {
+		return 0, false
+	}
+	return end.Time() - start.Time(), true
+}
+
+// Returns the time of the event relative to the reference time of its trace.
+func (e *Event) Time() time.Duration {
+	return time.Duration(e.RelativeTime) * TimeUnits
+}
+
+// Returns the frame_type of a frame read from a qlog, whether it was decoded into one of the types of this package or
+// kept as a map.
+func FrameType(frame interface{}) string {
+	if m, ok := frame.(map[string]interface{}); ok {
+		frameType, _ := m["frame_type"].(string)
+		return frameType
+	}
+	v := reflect.Indirect(reflect.ValueOf(frame))
+	if v.Kind() == reflect.Struct {
+		if f := v.FieldByName("FrameType"); f.IsValid() && f.Kind() == reflect.String {
+			return f.String()
+		}
+	}
+	return ""
+}
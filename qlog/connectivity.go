@@ -0,0 +1,15 @@
+package qlog
+
+const (
+	ConnectionStateAttempted          = "attempted"
+	ConnectionStateHandshakeComplete  = "handshake_complete"
+	ConnectionStateHandshakeConfirmed = "handshake_confirmed"
+	ConnectionStateClosing            = "closing"
+	ConnectionStateDraining           = "draining"
+	ConnectionStateClosed             = "closed"
+)
+
+type ConnectionStateUpdated struct {
+	Old string `json:"old,omitempty"`
+	New string `json:"new"`
+}
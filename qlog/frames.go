@@ -6,7 +6,7 @@ type PingFrame struct {
 
 type AckFrame struct {
 	FrameType   string     `json:"frame_type"`
-	ACKDelay    uint64     `json:"ack_delay,string"`
+	ACKDelay    float64    `json:"ack_delay"` // In milliseconds
 	ACKedRanges [][]uint64 `json:"acked_ranges"`
 
 	ECT1 uint64 `json:"ect1,omitempty"`
@@ -16,90 +16,93 @@ type AckFrame struct {
 
 type StreamFrame struct {
 	FrameType string `json:"frame_type"`
-	StreamID  uint64 `json:"stream_id,string"`
-	Offset    uint64 `json:"offset,string"`
-	Length    uint64 `json:"length,string"`
+	StreamID  uint64 `json:"stream_id"`
+	Offset    uint64 `json:"offset"`
+	Length    uint64 `json:"length"`
 	Fin       bool   `json:"fin,omitempty"`
 }
 
 type ResetStreamFrame struct {
 	FrameType   string `json:"frame_type"`
-	StreamID    uint64 `json:"stream_id,string"`
-	ErrorCode   uint64 `json:"error_code,string"`
-	FinalOffset uint64 `json:"final_offset,string"`
+	StreamID    uint64 `json:"stream_id"`
+	ErrorCode   uint64 `json:"error_code"`
+	FinalOffset uint64 `json:"final_offset"`
 }
 
 type StopSendingFrame struct {
 	FrameType string `json:"frame_type"`
-	StreamID  uint64 `json:"stream_id,string"`
-	ErrorCode uint64 `json:"error_code,string"`
+	StreamID  uint64 `json:"stream_id"`
+	ErrorCode uint64 `json:"error_code"`
 }
 
 type CryptoFrame struct {
 	FrameType string `json:"frame_type"`
-	Offset    uint64 `json:"offset,string"`
-	Length    uint64 `json:"length,string"`
+	Offset    uint64 `json:"offset"`
+	Length    uint64 `json:"length"`
+}
+
+type Token struct {
+	Raw RawInfo `json:"raw"`
 }
 
 type NewTokenFrame struct {
 	FrameType string `json:"frame_type"`
-	Length    uint64 `json:"length,string"`
-	Token     string `json:"token"`
+	Token     Token  `json:"token"`
 }
 
 type ConnectionCloseFrame struct {
 	FrameType  string `json:"frame_type"`
 	ErrorSpace string `json:"error_space"`
-	ErrorCode  uint64 `json:"error_code,string"`
+	ErrorCode  uint64 `json:"error_code"`
 	Reason     string `json:"reason"`
 }
 
 type MaxDataFrame struct {
 	FrameType string `json:"frame_type"`
-	Maximum   uint64 `json:"maximum,string"`
+	Maximum   uint64 `json:"maximum"`
 }
 
 type MaxStreamDataFrame struct {
 	FrameType string `json:"frame_type"`
-	StreamID  uint64 `json:"stream_id,string"`
-	Maximum   uint64 `json:"maximum,string"`
+	StreamID  uint64 `json:"stream_id"`
+	Maximum   uint64 `json:"maximum"`
 }
 
 type MaxStreamsFrame struct {
 	FrameType  string `json:"frame_type"`
 	StreamType `json:"stream_type"`
-	Maximum    uint64 `json:"maximum,string"`
+	Maximum    uint64 `json:"maximum"`
 }
 
 type DataBlockedFrame struct {
 	FrameType string `json:"frame_type"`
-	Limit     uint64 `json:"limit,string"`
+	Limit     uint64 `json:"limit"`
 }
 
 type StreamDataBlockedFrame struct {
 	FrameType string `json:"frame_type"`
-	StreamID  uint64 `json:"stream_id,string"`
-	Limit     uint64 `json:"limit,string"`
+	StreamID  uint64 `json:"stream_id"`
+	Limit     uint64 `json:"limit"`
 }
 
 type StreamsBlockedFrame struct {
 	FrameType  string `json:"frame_type"`
 	StreamType `json:"stream_type"`
-	Limit      uint64 `json:"limit,string"`
+	Limit      uint64 `json:"limit"`
 }
 
 type NewConnectionIDFrame struct {
 	FrameType      string `json:"frame_type"`
-	SequenceNumber uint64 `json:"sequence_number,string"`
-	RetirePriorTo  uint64 `json:"retire_prior_to,string"`
-	Length         uint8  `json:"length"`
+	SequenceNumber uint64 `json:"sequence_number"`
+	RetirePriorTo  uint64 `json:"retire_prior_to"`
+	Length         uint8  `json:"connection_id_length"`
 	ConnectionID   string `json:"connection_id"`
-	ResetToken     string `json:"reset_token"`
+	ResetToken     string `json:"stateless_reset_token"`
 }
 
 type RetireConnectionIDFrame struct {
 	FrameType      string `json:"frame_type"`
-	SequenceNumber uint64 `json:"sequence_number,string"`
+	SequenceNumber uint64 `json:"sequence_number"`
 }
 
 type PathChallengeFrame struct {
@@ -116,7 +119,24 @@ type HandshakeDoneFrame struct {
 	FrameType string `json:"frame_type"`
 }
 
+type DatagramFrame struct {
+	FrameType string `json:"frame_type"`
+	Length    uint64 `json:"length"`
+}
+
+type AckFrequencyFrame struct {
+	FrameType             string `json:"frame_type"`
+	SequenceNumber        uint64 `json:"sequence_number"`
+	AckElicitingThreshold uint64 `json:"ack_eliciting_threshold"`
+	RequestedMaxAckDelay  uint64 `json:"requested_max_ack_delay"`
+	ReorderingThreshold   uint64 `json:"reordering_threshold"`
+}
+
+type ImmediateAckFrame struct {
+	FrameType string `json:"frame_type"`
+}
+
 type UnknownFrame struct {
 	FrameType    string `json:"frame_type"`
-	RawFrameType uint64 `json:"raw_frame_type,string"`
+	RawFrameType uint64 `json:"raw_frame_type"`
 }
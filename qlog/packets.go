@@ -3,42 +3,45 @@ package qlog
 type PacketTrigger string
 
 const (
-	PacketTriggerReordering = "retransmit_reorder"
-	PacketTriggerTimeout    = "retransmit_timeout"
-	PacketTriggerPTO        = "pro_probe"
-	PacketTriggerCrypto     = "retransmit_crypto"
-	PacketTriggerBWProbe    = "cc_bandwidth_probe"
+	PacketTriggerReordering      = "reordering_threshold"
+	PacketTriggerTimeout         = "time_threshold"
+	PacketTriggerPTO             = "pto_expired"
+	PacketTriggerKeysUnavailable = "keys_unavailable"
 )
 
 type PacketHeader struct {
-	PacketNumber  uint64 `json:"packet_number,string"`
-	PacketSize    int    `json:"packet_size,omitempty"`
-	PayloadLength int    `json:"payload_length,omitempty"`
+	PacketType   string  `json:"packet_type"`
+	PacketNumber *uint64 `json:"packet_number,omitempty"` // Not set for packets without a PN, e.g. Retry packets
 
 	Version string `json:"version,omitempty"`
-	SCIL    string `json:"scil,omitempty"`
-	DCIL    string `json:"dcil,omitempty"`
+	SCIL    uint8  `json:"scil,omitempty"`
+	DCIL    uint8  `json:"dcil,omitempty"`
 	SCID    string `json:"scid,omitempty"`
 	DCID    string `json:"dcid,omitempty"`
 }
 
+type RawInfo struct {
+	Length        uint64 `json:"length,omitempty"`
+	PayloadLength uint64 `json:"payload_length,omitempty"`
+	Data          string `json:"data,omitempty"`
+}
+
 type Packet struct {
-	PacketType string        `json:"packet_type"`
-	Header     PacketHeader  `json:"header"`
-	Frames     []interface{} `json:"frames,omitempty"`
+	Header PacketHeader  `json:"header"`
+	Frames []interface{} `json:"frames,omitempty"`
+	Raw    *RawInfo      `json:"raw,omitempty"`
 
 	IsCoalesced bool   `json:"is_coalesced,omitempty"`
 	Trigger     string `json:"trigger,omitempty"`
 }
 
 type PacketLost struct {
-	PacketType   string        `json:"packet_type"`
-	PacketNumber uint64        `json:"packet_number,string"`
-	Frames       []interface{} `json:"frames"`
-	Trigger      string        `json:"trigger"`
+	Header  PacketHeader  `json:"header"`
+	Frames  []interface{} `json:"frames"`
+	Trigger string        `json:"trigger"`
 }
 
 type PacketBuffered struct {
-	PacketType string `json:"packet_type"`
-	Trigger    string `json:"trigger"`
+	Header  PacketHeader `json:"header"`
+	Trigger string       `json:"trigger"`
 }
@@ -2,13 +2,20 @@ package qlog
 
 import (
 	"encoding/json"
+	"io"
 	"sort"
+	"sync"
 	"time"
 )
 
 const (
-	TimeUnits       = time.Microsecond
-	TimeUnitsString = "us"
+	Version       = "0.3"
+	FormatJSON    = "JSON"
+	FormatJSONSeq = "JSON-SEQ"
+
+	RecordSeparator = 0x1e // Precedes each record of a JSON Text Sequence
+
+	TimeUnits = time.Microsecond // The resolution of the relative time of events
 )
 
 type StreamType string
@@ -27,15 +34,26 @@ var Categories = struct {
 		SpinBitUpdated         string
 		ConnectionRetried      string
 		ConnectionStateUpdated string
+		MTUUpdated             string
 	}
 	Transport struct {
 		Category           string
+		ParametersSet      string
+		VersionInformation string
+		ALPNInformation    string
 		PacketSent         string
 		PacketReceived     string
 		PacketDropped      string
 		PacketBuffered     string
+		DatagramsSent      string
+		DatagramsReceived  string
 		StreamStateUpdated string
 	}
+	Security struct {
+		Category     string
+		KeyUpdated   string
+		KeyDiscarded string
+	}
 	Recovery struct {
 		Category               string
 		MetricsUpdated         string
@@ -45,6 +63,10 @@ var Categories = struct {
 		PacketLost             string
 		MarkedForRetransmit    string
 	}
+	Conformance struct {
+		Category          string
+		ViolationDetected string
+	}
 }{
 	struct {
 		Category               string
@@ -54,15 +76,26 @@ var Categories = struct {
 		SpinBitUpdated         string
 		ConnectionRetried      string
 		ConnectionStateUpdated string
-	}{"connectivity", "server_listening", "connection_started", "connection_id_updated", "spin_bit_updated", "connection_retried", "connection_state_updated"},
+		MTUUpdated             string
+	}{"connectivity", "server_listening", "connection_started", "connection_id_updated", "spin_bit_updated", "connection_retried", "connection_state_updated", "mtu_updated"},
 	struct {
 		Category           string
+		ParametersSet      string
+		VersionInformation string
+		ALPNInformation    string
 		PacketSent         string
 		PacketReceived     string
 		PacketDropped      string
 		PacketBuffered     string
+		DatagramsSent      string
+		DatagramsReceived  string
 		StreamStateUpdated string
-	}{"transport", "packet_sent", "packet_received", "packet_dropped", "packet_buffered", "stream_state_updated"},
+	}{"transport", "parameters_set", "version_information", "alpn_information", "packet_sent", "packet_received", "packet_dropped", "packet_buffered", "datagrams_sent", "datagrams_received", "stream_state_updated"},
+	struct {
+		Category     string
+		KeyUpdated   string
+		KeyDiscarded string
+	}{"security", "key_updated", "key_discarded"},
 	struct {
 		Category               string
 		MetricsUpdated         string
@@ -72,6 +105,10 @@ var Categories = struct {
 		PacketLost             string
 		MarkedForRetransmit    string
 	}{"recovery", "metrics_updated", "congestion_state_updated", "loss_timer_set", "loss_timer_fired", "packet_lost", "marked_for_retransmit"},
+	struct {
+		Category          string
+		ViolationDetected string
+	}{"conformance", "violation_detected"},
 }
 
 type Event struct {
@@ -81,30 +118,32 @@ type Event struct {
 	Data         interface{}
 }
 
+// Events are serialised following the main schema, with their time in milliseconds relative to the reference time of
+// the trace and their name prefixed by their category, e.g. transport:packet_sent.
 func (e *Event) MarshalJSON() ([]byte, error) {
-	return json.Marshal([]interface{}{e.RelativeTime, e.Category, e.Event, e.Data})
+	return json.Marshal(struct {
+		Time float64     `json:"time"`
+		Name string      `json:"name"`
+		Data interface{} `json:"data"`
+	}{float64(e.RelativeTime) / float64(time.Millisecond/TimeUnits), e.Category + ":" + e.Event, e.Data})
 }
 
-func DefaultEventFields() []string {
-	return []string{"relative_time", "category", "event", "data"}
+type VantagePoint struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
 }
 
 type Trace struct {
-	VantagePoint struct {
-		Name string `json:"name"`
-		Type string `json:"type"`
-	} `json:"vantage_point"`
-	Title         string `json:"title"`
-	Description   string `json:"description"`
-	Configuration struct {
-		TimeOffset uint64 `json:"time_offset,string"`
-		TimeUnits  string `json:"time_units"`
-	} `json:"configuration"`
+	Title        string                 `json:"title"`
+	Description  string                 `json:"description"`
+	VantagePoint VantagePoint           `json:"vantage_point"`
 	CommonFields map[string]interface{} `json:"common_fields"`
-	EventFields  []string               `json:"event_fields"`
 	Events       []*Event               `json:"events"`
 
 	ReferenceTime time.Time `json:"-"`
+
+	lock   sync.Mutex
+	stream io.Writer // When set, the events are also written to it as JSON Text Sequences
 }
 
 func (t *Trace) NewEvent(category, eventType string, data interface{}) *Event {
@@ -117,19 +156,79 @@ func (t *Trace) NewEvent(category, eventType string, data interface{}) *Event {
 }
 
 func (t *Trace) Add(e *Event) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
 	t.Events = append(t.Events, e)
+	if t.stream != nil && writeRecord(t.stream, e) != nil {
+		t.stream = nil
+	}
 }
 
 func (t *Trace) Sort() {
-	sort.Slice(t.Events, func(i, j int) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	sort.SliceStable(t.Events, func(i, j int) bool {
 		return t.Events[i].RelativeTime < t.Events[j].RelativeTime
 	})
 }
 
 type QLog struct {
 	Version     string                 `json:"qlog_version"`
+	Format      string                 `json:"qlog_format"`
 	Title       string                 `json:"title"`
 	Description string                 `json:"description"`
-	Summary     map[string]interface{} `json:"summary"`
+	Summary     map[string]interface{} `json:"summary,omitempty"`
 	Traces      []*Trace               `json:"traces"`
 }
+
+// Streams the given trace of the qlog to w as JSON Text Sequences (RFC 7464), the format of .sqlog files. A header
+// record describing the qlog and the trace is written first, then one record per event. The events already added to
+// the trace are written immediately, and the next ones as soon as they are added, so that a trace written to a file is
+// kept if the program stops abruptly. Streaming stops at the first write error.
+func (q *QLog) StreamTo(w io.Writer, t *Trace) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	header := struct {
+		Version     string `json:"qlog_version"`
+		Format      string `json:"qlog_format"`
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Trace       struct {
+			Title        string                 `json:"title"`
+			Description  string                 `json:"description"`
+			VantagePoint VantagePoint           `json:"vantage_point"`
+			CommonFields map[string]interface{} `json:"common_fields"`
+		} `json:"trace"`
+	}{Version: q.Version, Format: FormatJSONSeq, Title: q.Title, Description: q.Description}
+	header.Trace.Title = t.Title
+	header.Trace.Description = t.Description
+	header.Trace.VantagePoint = t.VantagePoint
+	header.Trace.CommonFields = t.CommonFields
+
+	if err := writeRecord(w, header); err != nil {
+		return err
+	}
+	for _, e := range t.Events {
+		if err := writeRecord(w, e); err != nil {
+			return err
+		}
+	}
+	t.stream = w
+	return nil
+}
+
+// Writes the JSON Text Sequence record of v, i.e. its JSON serialisation preceded by a record separator and followed
+// by a line feed.
+func writeRecord(w io.Writer, v interface{}) error {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	record := make([]byte, 0, len(content)+2)
+	record = append(record, RecordSeparator)
+	record = append(record, content...)
+	record = append(record, '\n')
+	_, err = w.Write(record)
+	return err
+}
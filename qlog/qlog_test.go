@@ -0,0 +1,116 @@
+package qlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamTo(t *testing.T) {
+	q := QLog{Version: Version, Format: FormatJSON, Title: "test"}
+	trace := &Trace{ReferenceTime: time.Now()}
+	q.Traces = append(q.Traces, trace)
+
+	trace.Add(&Event{RelativeTime: 1500, Category: "transport", Event: "packet_sent"})
+	buffer := new(bytes.Buffer)
+	if err := q.StreamTo(buffer, trace); err != nil {
+		t.Fatal(err)
+	}
+	trace.Add(&Event{RelativeTime: 2000, Category: "transport", Event: "packet_received"})
+
+	records := bytes.Split(buffer.Bytes(), []byte{RecordSeparator})
+	if len(records) != 4 || len(records[0]) != 0 {
+		t.Fatalf("Expected 3 records, got %q", buffer.String())
+	}
+
+	var header struct {
+		Format string `json:"qlog_format"`
+		Title  string `json:"title"`
+	}
+	if err := json.Unmarshal(records[1], &header); err != nil || header.Format != FormatJSONSeq || header.Title != "test" {
+		t.Errorf("Unexpected header record %q", records[1])
+	}
+
+	var event struct {
+		Time float64 `json:"time"`
+		Name string  `json:"name"`
+	}
+	if err := json.Unmarshal(records[3], &event); err != nil || event.Time != 2 || event.Name != "transport:packet_received" {
+		t.Errorf("Unexpected event record %q", records[3])
+	}
+}
+
+func TestRead(t *testing.T) {
+	q := QLog{Version: Version, Format: FormatJSON, Title: "test"}
+	trace := &Trace{ReferenceTime: time.Now(), CommonFields: map[string]interface{}{"time_format": "relative"}}
+	q.Traces = append(q.Traces, trace)
+	pn := uint64(0)
+	trace.Add(&Event{RelativeTime: 1000, Category: "transport", Event: "packet_sent", Data: &Packet{Header: PacketHeader{PacketType: "initial", PacketNumber: &pn}, Frames: []interface{}{&CryptoFrame{"crypto", 0, 300}}}})
+	trace.Add(&Event{RelativeTime: 2000, Category: "transport", Event: "packet_sent", Data: &Packet{Header: PacketHeader{PacketType: "initial", PacketNumber: &pn}, Frames: []interface{}{&CryptoFrame{"crypto", 0, 300}}}})
+	trace.Add(&Event{RelativeTime: 9000, Category: "connectivity", Event: "connection_state_updated", Data: &ConnectionStateUpdated{New: ConnectionStateHandshakeComplete}})
+
+	seq := new(bytes.Buffer)
+	if err := q.StreamTo(seq, trace); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := json.Marshal(q)
+	for _, input := range [][]byte{content, seq.Bytes()} {
+		read, err := Read(bytes.NewReader(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(read.Traces) != 1 || len(read.Traces[0].Events) != 3 {
+			t.Fatalf("Unexpected traces read from %q", input)
+		}
+		readTrace := read.Traces[0]
+		if p, ok := readTrace.Events[0].Data.(*Packet); !ok || len(p.Frames) != 1 {
+			t.Errorf("Expected a typed packet, got %#v", readTrace.Events[0].Data)
+		} else if _, ok := p.Frames[0].(*CryptoFrame); !ok {
+			t.Errorf("Expected a typed CRYPTO frame, got %#v", p.Frames[0])
+		}
+		if d, ok := readTrace.HandshakeDuration(); !ok || d != 8*time.Millisecond {
+			t.Errorf("Expected a handshake duration of 8ms, got %v", d)
+		}
+		if r := readTrace.RetransmissionCounts(); r.FramesRetransmitted != 1 || r.BytesRetransmitted != 300 {
+			t.Errorf("Unexpected retransmissions %+v", r)
+		}
+		if h := readTrace.FrameHistogram(); h.Sent["crypto"] != 2 || len(h.Received) != 0 {
+			t.Errorf("Unexpected frame histogram %+v", h)
+		}
+	}
+}
+
+func TestReadOtherFormats(t *testing.T) {
+	legacy := `{"qlog_version": "draft-01", "traces": [{"configuration": {"time_units": "us"}, "common_fields": {"reference_time": 1000},
+		"event_fields": ["relative_time", "category", "event", "data"], "events": [
+		[1500, "transport", "packet_received", {"packet_type": "initial", "header": {"packet_number": "2", "packet_size": 1252}, "frames": [{"frame_type": "ack", "ack_delay": "0", "acked_ranges": [[0, 0]]}]}],
+		[2500, "recovery", "metrics_updated", {"latest_rtt": 12, "smoothed_rtt": 12, "min_rtt": 12}]]}]}`
+	read, err := Read(strings.NewReader(legacy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := read.Traces[0].Events
+	if p, ok := events[0].Data.(*Packet); !ok || p.Header.PacketType != "initial" || *p.Header.PacketNumber != 2 || p.Raw.Length != 1252 {
+		t.Errorf("Unexpected packet %#v", events[0].Data)
+	}
+	if s := read.Traces[0].RTTSeries(); len(s) != 1 || s[0].Time != 2500*time.Microsecond || s[0].SmoothedRTT != 12 {
+		t.Errorf("Unexpected RTT series %+v", s)
+	}
+
+	other := `{"qlog_version": "0.4", "traces": [{"common_fields": {"time_format": "delta"}, "events": [
+		{"time": 1, "name": "quic:packet_received", "data": {"header": {"packet_type": "1RTT"}, "frames": [{"frame_type": "connection_close", "error_code": "no_error"}]}},
+		{"time": 2, "name": "quic:packet_sent", "data": {"header": {"packet_type": "1RTT"}, "frames": [{"frame_type": "ping"}]}}]}]}`
+	read, err = Read(strings.NewReader(other))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events = read.Traces[0].Events
+	if events[1].Event != "packet_sent" || events[1].Time() != 3*time.Millisecond {
+		t.Errorf("Unexpected event %+v", events[1])
+	}
+	if h := read.Traces[0].FrameHistogram(); h.Received["connection_close"] != 1 || h.Sent["ping"] != 1 {
+		t.Errorf("Unexpected frame histogram %+v", h)
+	}
+}
@@ -2,7 +2,7 @@ package qt2qlog
 
 import (
 	"encoding/hex"
-	"strconv"
+	"fmt"
 
 	. "github.com/PROGNOSISTool/adapter-quic"
 	"github.com/PROGNOSISTool/adapter-quic/qlog"
@@ -21,30 +21,32 @@ func ConvertPacket(p Packet) *qlog.Packet {
 	j := &qlog.Packet{}
 	switch p.(type) {
 	case *InitialPacket, *HandshakePacket, *ZeroRTTProtectedPacket, *ProtectedPacket:
-		j.PacketType = qlogPacketType[p.GetHeader().GetPacketType()]
+		j.Header.PacketType = qlogPacketType[p.GetHeader().GetPacketType()]
 	case *RetryPacket:
-		j.PacketType = qlogPacketType[Retry]
+		j.Header.PacketType = qlogPacketType[Retry]
 	case *VersionNegotiationPacket:
-		j.PacketType = qlogPacketType[VersionNegotiation]
+		j.Header.PacketType = qlogPacketType[VersionNegotiation]
 	default:
-		j.PacketType = "unknown"
+		j.Header.PacketType = "unknown"
 	}
-	// TODO handle PacketSize computation here
 	switch p.(type) {
 	case *VersionNegotiationPacket, *RetryPacket, *StatelessResetPacket:
 	default:
-		j.Header.PacketNumber = uint64(p.GetHeader().GetPacketNumber())
+		pn := uint64(p.GetHeader().GetPacketNumber())
+		j.Header.PacketNumber = &pn
 	}
 
+	j.Raw = &qlog.RawInfo{}
 	switch h := p.GetHeader().(type) {
 		case *ShortHeader:
-			j.Header.DCIL = strconv.Itoa(int(h.DestinationCID.CIDL()))
+			j.Header.DCIL = h.DestinationCID.CIDL()
 			j.Header.DCID = h.DestinationCID.String()
 		case *LongHeader:
-			j.Header.PayloadLength = int(h.Length.Value)
-			j.Header.SCIL = strconv.Itoa(int(h.SourceCID.CIDL()))
+			j.Raw.PayloadLength = h.Length.Value
+			j.Header.Version = ConvertVersion(h.Version)
+			j.Header.SCIL = h.SourceCID.CIDL()
 			j.Header.SCID = h.SourceCID.String()
-			j.Header.DCIL = strconv.Itoa(int(h.DestinationCID.CIDL()))
+			j.Header.DCIL = h.DestinationCID.CIDL()
 			j.Header.DCID = h.DestinationCID.String()
 	}
 
@@ -53,7 +55,7 @@ func ConvertPacket(p Packet) *qlog.Packet {
 		j.Frames = convertFrames(fr.GetFrames())
 	}
 	if p.ReceiveContext().WasBuffered {
-		j.Trigger = "keys_unavailable"
+		j.Trigger = qlog.PacketTriggerKeysUnavailable
 	}
 	return j
 }
@@ -99,8 +101,7 @@ func convertFrames(frames []Frame) []interface{} {
 		case *NewTokenFrame:
 			qf = &qlog.NewTokenFrame{
 				FrameType: "new_token",
-				Length: uint64(len(ft.Token)),
-				Token: hex.EncodeToString(ft.Token),
+				Token: qlog.Token{Raw: qlog.RawInfo{Length: uint64(len(ft.Token)), Data: hex.EncodeToString(ft.Token)}},
 			}
 		case *ConnectionCloseFrame:
 			qf = &qlog.ConnectionCloseFrame{FrameType: "connection_close",
@@ -156,6 +157,25 @@ func convertFrames(frames []Frame) []interface{} {
 			qf = &qlog.HandshakeDoneFrame{
 				FrameType: "handshake_done",
 			}
+		case *DatagramFrame:
+			qf = &qlog.DatagramFrame{
+				FrameType: "datagram",
+				Length: uint64(len(ft.Data)),
+			}
+		case *AckFrequencyFrame:
+			qf = &qlog.AckFrequencyFrame{
+				FrameType: "ack_frequency",
+				SequenceNumber: ft.SequenceNumber,
+				AckElicitingThreshold: ft.AckElicitingThreshold,
+				RequestedMaxAckDelay: ft.RequestedMaxAckDelay,
+				ReorderingThreshold: ft.ReorderingThreshold,
+			}
+		case *ImmediateAckFrame:
+			qf = &qlog.ImmediateAckFrame{
+				FrameType: "immediate_ack",
+			}
+		case *GreaseFrame:
+			qf = &qlog.UnknownFrame{FrameType: "unknown", RawFrameType: ft.RawType}
 		case *PaddingFrame:
 			continue
 		default:
@@ -167,7 +187,8 @@ func convertFrames(frames []Frame) []interface{} {
 }
 
 func ackFrameToQLog(a *AckFrame) *qlog.AckFrame {
-	q := qlog.AckFrame{FrameType: "ack", ACKDelay: a.AckDelay}
+	// The ACK delay is scaled assuming the default exponent of 3, which is the one we advertise
+	q := qlog.AckFrame{FrameType: "ack", ACKDelay: float64(a.AckDelay<<3) / 1000}
 
 	largest := uint64(a.LargestAcknowledged)
 	rang := a.AckRanges[0].AckRange
@@ -205,11 +226,12 @@ func unknownFrameToQLog(u Frame) *qlog.UnknownFrame {
 func ConvertPacketLost(packetType PacketType, number PacketNumber, frames []Frame, trigger string) *qlog.PacketLost {
 	j := &qlog.PacketLost{Frames: convertFrames(frames), Trigger: trigger}
 	if pType, ok := qlogPacketType[packetType]; ok {
-		j.PacketType = pType
+		j.Header.PacketType = pType
 	} else {
-		j.PacketType = "unknown"
+		j.Header.PacketType = "unknown"
 	}
-	j.PacketNumber = uint64(number)
+	pn := uint64(number)
+	j.Header.PacketNumber = &pn
 	return j
 }
 
@@ -220,5 +242,83 @@ func ConvertPacketBuffered(packetType PacketType, trigger string) *qlog.PacketBu
 	} else {
 		typeStr = "unknown"
 	}
-	return &qlog.PacketBuffered{PacketType: typeStr, Trigger: trigger}
+	return &qlog.PacketBuffered{Header: qlog.PacketHeader{PacketType: typeStr}, Trigger: trigger}
+}
+
+func ConvertVersion(version uint32) string {
+	return fmt.Sprintf("%08x", version)
+}
+
+func ConvertParameters(owner string, p *QuicTransportParameters) *qlog.ParametersSet {
+	return &qlog.ParametersSet{
+		Owner:                           owner,
+		OriginalDestinationConnectionID: hex.EncodeToString(p.OriginalDestinationConnectionId),
+		InitialSourceConnectionID:       hex.EncodeToString(p.InitialSourceConnectionId),
+		RetrySourceConnectionID:         hex.EncodeToString(p.RetrySourceConnectionId),
+		StatelessResetToken:             hex.EncodeToString(p.StatelessResetToken),
+		DisableActiveMigration:          p.DisableMigration,
+		MaxIdleTimeout:                  p.IdleTimeout,
+		MaxUDPPayloadSize:               p.MaxPacketSize,
+		AckDelayExponent:                p.AckDelayExponent,
+		MaxAckDelay:                     p.MaxAckDelay,
+		ActiveConnectionIDLimit:         p.ActiveConnectionIdLimit,
+		InitialMaxData:                  p.MaxData,
+		InitialMaxStreamDataBidiLocal:   p.MaxStreamDataBidiLocal,
+		InitialMaxStreamDataBidiRemote:  p.MaxStreamDataBidiRemote,
+		InitialMaxStreamDataUni:         p.MaxStreamDataUni,
+		InitialMaxStreamsBidi:           p.MaxBidiStreams,
+		InitialMaxStreamsUni:            p.MaxUniStreams,
+		MaxDatagramFrameSize:            p.MaxDatagramFrameSize,
+		MinAckDelay:                     p.MinAckDelay,
+		GreaseQuicBit:                   p.GreaseQuicBit,
+	}
+}
+
+var qlogKeyLevel = map[EncryptionLevel]string{
+	EncryptionLevelInitial:   "initial",
+	EncryptionLevelHandshake: "handshake",
+	EncryptionLevel0RTT:      "0rtt",
+	EncryptionLevel1RTT:      "1rtt",
+}
+
+// Returns the qlog key type of the secret of the given encryption level used in the given direction. As a client, the
+// server secrets are used to read and the client secrets to write.
+func ConvertKeyType(level EncryptionLevel, read bool) string {
+	if read {
+		return "server_" + qlogKeyLevel[level] + "_secret"
+	}
+	return "client_" + qlogKeyLevel[level] + "_secret"
+}
+
+var qlogSendStreamState = map[SendStreamState]string{
+	SendStateReady:      "ready",
+	SendStateSend:       "send",
+	SendStateDataSent:   "data_sent",
+	SendStateResetSent:  "reset_sent",
+	SendStateDataRecvd:  "data_received",
+	SendStateResetRecvd: "reset_received",
+}
+
+var qlogRecvStreamState = map[RecvStreamState]string{
+	RecvStateRecv:       "receive",
+	RecvStateSizeKnown:  "size_known",
+	RecvStateDataRecvd:  "data_received",
+	RecvStateResetRecvd: "reset_received",
+	RecvStateDataRead:   "data_read",
+	RecvStateResetRead:  "reset_read",
+}
+
+func ConvertStreamStateUpdate(u StreamStateUpdate) *qlog.StreamStateUpdated {
+	j := &qlog.StreamStateUpdated{StreamID: u.StreamId, StreamType: qlog.StreamTypeUni}
+	if IsBidi(u.StreamId) {
+		j.StreamType = qlog.StreamTypeBidi
+	}
+	if u.Sending {
+		j.StreamSide = qlog.StreamSideSending
+		j.Old, j.New = qlogSendStreamState[u.OldSendState], qlogSendStreamState[u.NewSendState]
+	} else {
+		j.StreamSide = qlog.StreamSideReceiving
+		j.Old, j.New = qlogRecvStreamState[u.OldRecvState], qlogRecvStreamState[u.NewRecvState]
+	}
+	return j
 }
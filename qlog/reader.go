@@ -0,0 +1,388 @@
+package qlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// The types of the data of the events the reader decodes, indexed by event type. The data of other events is kept as
+// a map[string]interface{}.
+var eventDataTypes = map[string]func() interface{}{
+	"packet_sent":              func() interface{} { return new(Packet) },
+	"packet_received":          func() interface{} { return new(Packet) },
+	"packet_lost":              func() interface{} { return new(PacketLost) },
+	"packet_buffered":          func() interface{} { return new(PacketBuffered) },
+	"metrics_updated":          func() interface{} { return new(MetricUpdate) },
+	"mtu_updated":              func() interface{} { return new(MTUUpdated) },
+	"parameters_set":           func() interface{} { return new(ParametersSet) },
+	"version_information":      func() interface{} { return new(VersionInformation) },
+	"alpn_information":         func() interface{} { return new(ALPNInformation) },
+	"datagrams_sent":           func() interface{} { return new(Datagrams) },
+	"datagrams_received":       func() interface{} { return new(Datagrams) },
+	"stream_state_updated":     func() interface{} { return new(StreamStateUpdated) },
+	"key_updated":              func() interface{} { return new(KeyUpdated) },
+	"key_discarded":            func() interface{} { return new(KeyDiscarded) },
+	"connection_state_updated": func() interface{} { return new(ConnectionStateUpdated) },
+}
+
+// The types of the frames the reader decodes, indexed by frame type. Other frames are kept as a map[string]interface{}.
+var frameTypes = map[string]func() interface{}{
+	"ping":                 func() interface{} { return new(PingFrame) },
+	"ack":                  func() interface{} { return new(AckFrame) },
+	"stream":               func() interface{} { return new(StreamFrame) },
+	"reset_stream":         func() interface{} { return new(ResetStreamFrame) },
+	"stop_sending":         func() interface{} { return new(StopSendingFrame) },
+	"crypto":               func() interface{} { return new(CryptoFrame) },
+	"new_token":            func() interface{} { return new(NewTokenFrame) },
+	"connection_close":     func() interface{} { return new(ConnectionCloseFrame) },
+	"max_data":             func() interface{} { return new(MaxDataFrame) },
+	"max_stream_data":      func() interface{} { return new(MaxStreamDataFrame) },
+	"max_streams":          func() interface{} { return new(MaxStreamsFrame) },
+	"data_blocked":         func() interface{} { return new(DataBlockedFrame) },
+	"stream_data_blocked":  func() interface{} { return new(StreamDataBlockedFrame) },
+	"streams_blocked":      func() interface{} { return new(StreamsBlockedFrame) },
+	"new_connection_id":    func() interface{} { return new(NewConnectionIDFrame) },
+	"retire_connection_id": func() interface{} { return new(RetireConnectionIDFrame) },
+	"path_challenge":       func() interface{} { return new(PathChallengeFrame) },
+	"path_response":        func() interface{} { return new(PathResponseFrame) },
+	"handshake_done":       func() interface{} { return new(HandshakeDoneFrame) },
+	"datagram":             func() interface{} { return new(DatagramFrame) },
+	"ack_frequency":        func() interface{} { return new(AckFrequencyFrame) },
+	"immediate_ack":        func() interface{} { return new(ImmediateAckFrame) },
+	"unknown":              func() interface{} { return new(UnknownFrame) },
+}
+
+// Reads a qlog in the JSON format, as a .qlog file, or in the JSON-SEQ format, as a .sqlog file. Besides the main
+// schema written by this package, it accepts the draft-01 format we used to write, in which events are arrays described
+// by the event_fields of their trace, and the event names of later schemas, e.g. quic:packet_sent.
+//
+// Events are decoded into the types of this package when they are known, their data being otherwise kept as a
+// map[string]interface{}. This is also the case when the data of an event does not match its type, which happens with
+// the non-numeric error codes other implementations log for instance. The RelativeTime of events is expressed in
+// TimeUnits from the reference time of their trace, regardless of the time format of the file.
+func Read(r io.Reader) (*QLog, error) {
+	reader := bufio.NewReader(r)
+	for {
+		b, err := reader.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		if b[0] == ' ' || b[0] == '\t' || b[0] == '\r' || b[0] == '\n' {
+			reader.ReadByte()
+			continue
+		}
+		if b[0] == RecordSeparator {
+			return readJSONSeq(reader)
+		}
+		return readJSON(reader)
+	}
+}
+
+type rawTrace struct {
+	Title         string                 `json:"title"`
+	Description   string                 `json:"description"`
+	VantagePoint  VantagePoint           `json:"vantage_point"`
+	CommonFields  map[string]interface{} `json:"common_fields"`
+	EventFields   []string               `json:"event_fields"`
+	Configuration struct {
+		TimeOffset json.Number `json:"time_offset"`
+		TimeUnits  string      `json:"time_units"`
+	} `json:"configuration"`
+	Events []json.RawMessage `json:"events"`
+}
+
+type rawQLog struct {
+	Version     string                 `json:"qlog_version"`
+	Format      string                 `json:"qlog_format"`
+	Title       string                 `json:"title"`
+	Description string                 `json:"description"`
+	Summary     map[string]interface{} `json:"summary"`
+	Traces      []rawTrace             `json:"traces"`
+	Trace       *rawTrace              `json:"trace"` // The trace of a JSON-SEQ header record
+}
+
+func readJSON(r io.Reader) (*QLog, error) {
+	var raw rawQLog
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+	q := &QLog{Version: raw.Version, Format: raw.Format, Title: raw.Title, Description: raw.Description, Summary: raw.Summary}
+	if q.Format == "" {
+		q.Format = FormatJSON
+	}
+	for i := range raw.Traces {
+		t, err := readTrace(&raw.Traces[i], raw.Version)
+		if err != nil {
+			return nil, fmt.Errorf("trace %d: %v", i, err)
+		}
+		q.Traces = append(q.Traces, t)
+	}
+	return q, nil
+}
+
+// Reads a JSON Text Sequence whose first record describes the qlog and its trace, and whose following records are the
+// events of this trace. A truncated last record, as left by a program that stopped abruptly, is ignored.
+func readJSONSeq(r *bufio.Reader) (*QLog, error) {
+	var records [][]byte
+	for {
+		record, err := r.ReadBytes(RecordSeparator)
+		record = bytes.TrimSpace(bytes.TrimSuffix(record, []byte{RecordSeparator}))
+		if len(record) > 0 {
+			records = append(records, record)
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if len(records) == 0 {
+		return nil, errors.New("the JSON text sequence contains no records")
+	}
+
+	var raw rawQLog
+	decoder := json.NewDecoder(bytes.NewReader(records[0]))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("header record: %v", err)
+	}
+	if raw.Trace == nil {
+		raw.Trace = &rawTrace{}
+	}
+	for i, record := range records[1:] {
+		if !json.Valid(record) {
+			if i == len(records)-2 {
+				break
+			}
+			return nil, fmt.Errorf("record %d is not valid JSON", i+1)
+		}
+		raw.Trace.Events = append(raw.Trace.Events, record)
+	}
+
+	q := &QLog{Version: raw.Version, Format: FormatJSONSeq, Title: raw.Title, Description: raw.Description, Summary: raw.Summary}
+	t, err := readTrace(raw.Trace, raw.Version)
+	if err != nil {
+		return nil, err
+	}
+	q.Traces = append(q.Traces, t)
+	return q, nil
+}
+
+func readTrace(raw *rawTrace, version string) (*Trace, error) {
+	t := &Trace{Title: raw.Title, Description: raw.Description, VantagePoint: raw.VantagePoint, CommonFields: raw.CommonFields}
+	legacy := len(raw.EventFields) > 0 || strings.HasPrefix(version, "draft-")
+
+	// The reference time is in milliseconds, unless the draft-01 configuration states otherwise
+	unit := float64(time.Millisecond / TimeUnits)
+	if legacy {
+		switch raw.Configuration.TimeUnits {
+		case "us":
+			unit = float64(time.Microsecond / TimeUnits)
+		case "ns":
+			unit = 1 / float64(TimeUnits)
+		}
+	}
+	var referenceTime float64
+	if n, ok := raw.CommonFields["reference_time"].(json.Number); ok {
+		referenceTime, _ = n.Float64()
+		t.ReferenceTime = time.Unix(0, int64(referenceTime*unit*float64(TimeUnits)))
+	}
+	timeFormat, _ := raw.CommonFields["time_format"].(string)
+	var offset float64
+	if raw.Configuration.TimeOffset != "" {
+		offset, _ = raw.Configuration.TimeOffset.Float64()
+	}
+
+	var previous float64
+	for i, message := range raw.Events {
+		var e *Event
+		var eventTime float64
+		var err error
+		if legacy && len(message) > 0 && message[0] == '[' {
+			e, eventTime, err = readLegacyEvent(message, raw.EventFields)
+		} else {
+			e, eventTime, err = readEvent(message, legacy)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %v", i, err)
+		}
+
+		eventTime += offset
+		switch timeFormat {
+		case "absolute":
+			eventTime -= referenceTime
+		case "delta":
+			eventTime += previous
+		}
+		previous = eventTime
+		if eventTime > 0 {
+			e.RelativeTime = uint64(eventTime * unit)
+		}
+		t.Events = append(t.Events, e)
+	}
+	t.Sort()
+	return t, nil
+}
+
+func readEvent(message json.RawMessage, legacy bool) (*Event, float64, error) {
+	var raw struct {
+		Time     json.Number     `json:"time"`
+		Name     string          `json:"name"`
+		Category string          `json:"category"` // Used instead of the name before the main schema
+		Event    string          `json:"event"`
+		Data     json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(message, &raw); err != nil {
+		return nil, 0, err
+	}
+	e := &Event{Category: raw.Category, Event: raw.Event}
+	if raw.Name != "" {
+		if i := strings.Index(raw.Name, ":"); i >= 0 {
+			e.Category, e.Event = raw.Name[:i], raw.Name[i+1:]
+		} else {
+			e.Event = raw.Name
+		}
+	}
+	eventTime, _ := raw.Time.Float64()
+	e.Data = decodeEventData(e.Event, raw.Data, legacy)
+	return e, eventTime, nil
+}
+
+func readLegacyEvent(message json.RawMessage, fields []string) (*Event, float64, error) {
+	var values []json.RawMessage
+	if err := json.Unmarshal(message, &values); err != nil {
+		return nil, 0, err
+	}
+	e := &Event{}
+	var eventTime float64
+	var data json.RawMessage
+	for i, field := range fields {
+		if i >= len(values) {
+			break
+		}
+		switch field {
+		case "relative_time", "time", "delta_time":
+			var n json.Number // Either a number or a string containing one
+			json.Unmarshal(bytes.Trim(values[i], `"`), &n)
+			eventTime, _ = n.Float64()
+		case "category":
+			json.Unmarshal(values[i], &e.Category)
+		case "event":
+			json.Unmarshal(values[i], &e.Event)
+		case "data":
+			data = values[i]
+		}
+	}
+	e.Data = decodeEventData(e.Event, data, true)
+	return e, eventTime, nil
+}
+
+func decodeEventData(eventType string, data json.RawMessage, legacy bool) interface{} {
+	var generic map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if len(data) == 0 || decoder.Decode(&generic) != nil {
+		return nil
+	}
+	if legacy {
+		upgradeLegacyData(generic)
+	}
+	newData, ok := eventDataTypes[eventType]
+	if !ok {
+		return generic
+	}
+	typed := newData()
+	if !convert(generic, typed) {
+		return generic
+	}
+	switch d := typed.(type) {
+	case *Packet:
+		d.Frames = decodeFrames(d.Frames)
+	case *PacketLost:
+		d.Frames = decodeFrames(d.Frames)
+	}
+	return typed
+}
+
+func decodeFrames(frames []interface{}) []interface{} {
+	var decoded []interface{}
+	for _, f := range frames {
+		frame, ok := f.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		frameType, _ := frame["frame_type"].(string)
+		if newFrame, ok := frameTypes[frameType]; ok {
+			typed := newFrame()
+			if convert(frame, typed) {
+				decoded = append(decoded, typed)
+				continue
+			}
+		}
+		decoded = append(decoded, frame)
+	}
+	return decoded
+}
+
+// Decodes the JSON representation of v into the given value, and returns whether it matches its type.
+func convert(v interface{}, typed interface{}) bool {
+	content, err := json.Marshal(v)
+	return err == nil && json.Unmarshal(content, typed) == nil
+}
+
+var digits = regexp.MustCompile(`^[0-9]+$`)
+
+// Upgrades the data of a draft-01 event in place to the main schema: numbers were serialised as strings, and the type
+// and size of packets were not in the same place.
+func upgradeLegacyData(data map[string]interface{}) {
+	for key, value := range data {
+		switch v := value.(type) {
+		case string:
+			if digits.MatchString(v) && !strings.Contains(key, "cid") && !strings.Contains(key, "connection_id") && key != "version" && key != "data" && key != "token" && key != "reason" {
+				data[key] = json.Number(v)
+			}
+		case map[string]interface{}:
+			upgradeLegacyData(v)
+		case []interface{}:
+			for _, e := range v {
+				if m, ok := e.(map[string]interface{}); ok {
+					upgradeLegacyData(m)
+				}
+			}
+		}
+	}
+	header, _ := data["header"].(map[string]interface{})
+	if packetType, ok := data["packet_type"]; ok {
+		if header == nil {
+			header = make(map[string]interface{})
+			data["header"] = header
+		}
+		header["packet_type"] = packetType
+		delete(data, "packet_type")
+		if packetNumber, ok := data["packet_number"]; ok { // Of packet_lost events
+			header["packet_number"] = packetNumber
+			delete(data, "packet_number")
+		}
+	}
+	if header == nil {
+		return
+	}
+	if size, ok := header["packet_size"]; ok {
+		raw := map[string]interface{}{"length": size}
+		if payloadLength, ok := header["payload_length"]; ok {
+			raw["payload_length"] = payloadLength
+		}
+		data["raw"] = raw
+		delete(header, "packet_size")
+		delete(header, "payload_length")
+	}
+}
@@ -1,13 +1,20 @@
 package qlog
 
+// The durations of a MetricUpdate are in milliseconds.
 type MetricUpdate struct {
-	CongestionWindow uint64 `json:"congestion_window,omitempty"`
-	BytesInFlight    uint64 `json:"bytes_in_flight,omitempty"`
-	MinRTT           uint64 `json:"min_rtt,omitempty"`
-	SmoothedRTT      uint64 `json:"smoothed_rtt,omitempty"`
-	LatestRTT        uint64 `json:"latest_rtt,omitempty"`
-	MaxAckDelay      uint64 `json:"max_ack_delay,omitempty"`
-	RTTVariance      uint64 `json:"rtt_variance,omitempty"`
-	SSThresh         uint64 `json:"ssthresh,omitempty"`
-	PacingRate       uint64 `json:"pacing_rate,omitempty"`
+	CongestionWindow uint64  `json:"congestion_window,omitempty"`
+	BytesInFlight    uint64  `json:"bytes_in_flight,omitempty"`
+	MinRTT           float64 `json:"min_rtt,omitempty"`
+	SmoothedRTT      float64 `json:"smoothed_rtt,omitempty"`
+	LatestRTT        float64 `json:"latest_rtt,omitempty"`
+	MaxAckDelay      float64 `json:"max_ack_delay,omitempty"`
+	RTTVariance      float64 `json:"rtt_variance,omitempty"`
+	SSThresh         uint64  `json:"ssthresh,omitempty"`
+	PacingRate       uint64  `json:"pacing_rate,omitempty"`
+}
+
+type MTUUpdated struct {
+	Old  uint16 `json:"old,omitempty"`
+	New  uint16 `json:"new"`
+	Done bool   `json:"done,omitempty"`
 }
@@ -0,0 +1,18 @@
+package qlog
+
+const (
+	KeyTriggerTLS         = "tls"
+	KeyTriggerLocalUpdate = "local_update"
+)
+
+type KeyUpdated struct {
+	KeyType    string `json:"key_type"`
+	Generation uint   `json:"generation,omitempty"` // The key phase of 1-RTT keys
+	Trigger    string `json:"trigger,omitempty"`
+}
+
+type KeyDiscarded struct {
+	KeyType    string `json:"key_type"`
+	Generation uint   `json:"generation,omitempty"`
+	Trigger    string `json:"trigger,omitempty"`
+}
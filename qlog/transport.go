@@ -0,0 +1,62 @@
+package qlog
+
+const (
+	OwnerLocal  = "local"
+	OwnerRemote = "remote"
+
+	StreamSideSending   = "sending"
+	StreamSideReceiving = "receiving"
+)
+
+type ParametersSet struct {
+	Owner string `json:"owner"`
+
+	OriginalDestinationConnectionID string `json:"original_destination_connection_id,omitempty"`
+	InitialSourceConnectionID       string `json:"initial_source_connection_id,omitempty"`
+	RetrySourceConnectionID         string `json:"retry_source_connection_id,omitempty"`
+	StatelessResetToken             string `json:"stateless_reset_token,omitempty"`
+	DisableActiveMigration          bool   `json:"disable_active_migration,omitempty"`
+
+	MaxIdleTimeout          uint64 `json:"max_idle_timeout,omitempty"`
+	MaxUDPPayloadSize       uint64 `json:"max_udp_payload_size,omitempty"`
+	AckDelayExponent        uint64 `json:"ack_delay_exponent,omitempty"`
+	MaxAckDelay             uint64 `json:"max_ack_delay,omitempty"`
+	ActiveConnectionIDLimit uint64 `json:"active_connection_id_limit,omitempty"`
+
+	InitialMaxData                 uint64 `json:"initial_max_data,omitempty"`
+	InitialMaxStreamDataBidiLocal  uint64 `json:"initial_max_stream_data_bidi_local,omitempty"`
+	InitialMaxStreamDataBidiRemote uint64 `json:"initial_max_stream_data_bidi_remote,omitempty"`
+	InitialMaxStreamDataUni        uint64 `json:"initial_max_stream_data_uni,omitempty"`
+	InitialMaxStreamsBidi          uint64 `json:"initial_max_streams_bidi,omitempty"`
+	InitialMaxStreamsUni           uint64 `json:"initial_max_streams_uni,omitempty"`
+
+	MaxDatagramFrameSize uint64 `json:"max_datagram_frame_size,omitempty"`
+	MinAckDelay          uint64 `json:"min_ack_delay,omitempty"`
+	GreaseQuicBit        bool   `json:"grease_quic_bit,omitempty"`
+}
+
+type VersionInformation struct {
+	ServerVersions []string `json:"server_versions,omitempty"`
+	ClientVersions []string `json:"client_versions,omitempty"`
+	ChosenVersion  string   `json:"chosen_version,omitempty"`
+}
+
+type ALPNInformation struct {
+	ServerALPNs []string `json:"server_alpns,omitempty"`
+	ClientALPNs []string `json:"client_alpns,omitempty"`
+	ChosenALPN  string   `json:"chosen_alpn,omitempty"`
+}
+
+// Describes the UDP datagrams of a datagrams_sent or datagrams_received event.
+type Datagrams struct {
+	Count uint64    `json:"count"`
+	Raw   []RawInfo `json:"raw"`
+}
+
+type StreamStateUpdated struct {
+	StreamID   uint64     `json:"stream_id"`
+	StreamType StreamType `json:"stream_type"`
+	Old        string     `json:"old,omitempty"`
+	New        string     `json:"new"`
+	StreamSide string     `json:"stream_side"`
+}
@@ -0,0 +1,313 @@
+package qpack
+
+import (
+	"bytes"
+	"errors"
+)
+
+type blockedSection struct {
+	streamID            uint64
+	requiredInsertCount uint64
+	data                []byte
+}
+
+// The Decoder decodes field sections. Sections referencing entries not yet received on the encoder stream are blocked
+// until they are. Decoded sections and the instructions to send on the decoder stream are retrieved separately.
+type Decoder struct {
+	table                   dynamicTable
+	maxTableCapacity        uint64
+	maxBlockedStreams       uint64
+	encoderStream           []byte
+	blocked                 []blockedSection
+	decoded                 []HeaderBlock
+	decoderStream           []byte
+	acknowledgedInsertCount uint64
+}
+
+// Creates a decoder using the SETTINGS_QPACK_MAX_TABLE_CAPACITY and SETTINGS_QPACK_BLOCKED_STREAMS we advertise.
+func NewDecoder(maxTableCapacity uint64, maxBlockedStreams uint64) *Decoder {
+	return &Decoder{maxTableCapacity: maxTableCapacity, maxBlockedStreams: maxBlockedStreams}
+}
+
+// Processes the instructions received on the encoder stream. Incomplete instructions are kept until more data is
+// received. The blocked sections that can be decoded afterwards are.
+func (d *Decoder) EncoderIn(data []byte) error {
+	d.encoderStream = append(d.encoderStream, data...)
+	for len(d.encoderStream) > 0 {
+		r := bytes.NewReader(d.encoderStream)
+		err := d.readEncoderInstruction(r)
+		if err == errIncomplete {
+			break
+		} else if err != nil {
+			return &Error{EncoderStreamError, err.Error()}
+		}
+		d.encoderStream = d.encoderStream[len(d.encoderStream)-r.Len():]
+	}
+
+	var stillBlocked []blockedSection
+	streamsBlocked := make(map[uint64]bool)
+	for _, s := range d.blocked {
+		if s.requiredInsertCount > d.table.insertCount() || streamsBlocked[s.streamID] {
+			stillBlocked = append(stillBlocked, s)
+			streamsBlocked[s.streamID] = true
+		} else if err := d.decode(s.streamID, s.data); err != nil {
+			return err
+		}
+	}
+	d.blocked = stillBlocked
+	return nil
+}
+
+// Returns the number of streams with blocked field sections, and whether the given stream is one of them.
+func (d *Decoder) blockedStreams(streamID uint64) (int, bool) {
+	streams := make(map[uint64]bool)
+	for _, s := range d.blocked {
+		streams[s.streamID] = true
+	}
+	return len(streams), streams[streamID]
+}
+
+func (d *Decoder) readEncoderInstruction(r *bytes.Reader) error {
+	first, _ := r.ReadByte()
+	r.UnreadByte()
+	switch {
+	case first&0x80 != 0: // Insert with Name Reference
+		_, index, err := readInt(r, 6)
+		if err != nil {
+			return err
+		}
+		value, err := readString(r, 7)
+		if err != nil {
+			return err
+		}
+		var name string
+		if first&0x40 != 0 {
+			if index >= uint64(len(staticTable)) {
+				return errors.New("invalid static table index")
+			}
+			name = staticTable[index].Name
+		} else {
+			f, ok := d.table.get(d.table.insertCount() - 1 - index)
+			if !ok || index >= d.table.insertCount() {
+				return errors.New("invalid dynamic table index")
+			}
+			name = f.Name
+		}
+		return d.insert(HeaderField{name, value})
+	case first&0x40 != 0: // Insert with Literal Name
+		name, err := readString(r, 5)
+		if err != nil {
+			return err
+		}
+		value, err := readString(r, 7)
+		if err != nil {
+			return err
+		}
+		return d.insert(HeaderField{name, value})
+	case first&0x20 != 0: // Set Dynamic Table Capacity
+		_, capacity, err := readInt(r, 5)
+		if err != nil {
+			return err
+		}
+		if capacity > d.maxTableCapacity {
+			return errors.New("capacity exceeds the maximum table capacity")
+		}
+		d.table.setCapacity(capacity)
+		return nil
+	default: // Duplicate
+		_, index, err := readInt(r, 5)
+		if err != nil {
+			return err
+		}
+		f, ok := d.table.get(d.table.insertCount() - 1 - index)
+		if !ok || index >= d.table.insertCount() {
+			return errors.New("invalid dynamic table index")
+		}
+		return d.insert(f)
+	}
+}
+
+func (d *Decoder) insert(f HeaderField) error {
+	if !d.table.insert(f) {
+		return errors.New("entry larger than the capacity")
+	}
+	return nil
+}
+
+// Processes an encoded field section received on the given stream.
+func (d *Decoder) HeaderIn(data []byte, streamID uint64) error {
+	requiredInsertCount, _, err := d.readPrefix(bytes.NewReader(data))
+	if err != nil {
+		return &Error{DecompressionFailed, err.Error()}
+	}
+	blockedStreams, streamBlocked := d.blockedStreams(streamID)
+	if streamBlocked { // The sections of a stream are decoded in order
+		d.blocked = append(d.blocked, blockedSection{streamID, requiredInsertCount, append([]byte{}, data...)})
+		return nil
+	}
+	if requiredInsertCount > d.table.insertCount() {
+		if uint64(blockedStreams) >= d.maxBlockedStreams {
+			return &Error{DecompressionFailed, "too many blocked streams"}
+		}
+		d.blocked = append(d.blocked, blockedSection{streamID, requiredInsertCount, append([]byte{}, data...)})
+		return nil
+	}
+	return d.decode(streamID, data)
+}
+
+// Reads the prefix of a field section, see RFC 9204 Section 4.5.1.
+func (d *Decoder) readPrefix(r *bytes.Reader) (requiredInsertCount uint64, base uint64, err error) {
+	_, encodedInsertCount, err := readInt(r, 8)
+	if err != nil {
+		return 0, 0, errors.New("truncated field section prefix")
+	}
+	if encodedInsertCount > 0 {
+		fullRange := 2 * maxEntries(d.maxTableCapacity)
+		if encodedInsertCount > fullRange {
+			return 0, 0, errors.New("invalid required insert count")
+		}
+		maxValue := d.table.insertCount() + maxEntries(d.maxTableCapacity)
+		requiredInsertCount = maxValue/fullRange*fullRange + encodedInsertCount - 1
+		if requiredInsertCount > maxValue {
+			if requiredInsertCount <= fullRange {
+				return 0, 0, errors.New("invalid required insert count")
+			}
+			requiredInsertCount -= fullRange
+		}
+		if requiredInsertCount == 0 {
+			return 0, 0, errors.New("invalid required insert count")
+		}
+	}
+	first, deltaBase, err := readInt(r, 7)
+	if err != nil {
+		return 0, 0, errors.New("truncated field section prefix")
+	}
+	if first&0x80 == 0 {
+		base = requiredInsertCount + deltaBase
+	} else if deltaBase < requiredInsertCount {
+		base = requiredInsertCount - deltaBase - 1
+	} else {
+		return 0, 0, errors.New("invalid base")
+	}
+	return requiredInsertCount, base, nil
+}
+
+func (d *Decoder) decode(streamID uint64, data []byte) error {
+	headers, requiredInsertCount, err := d.decodeFieldLines(bytes.NewReader(data))
+	if err != nil {
+		return &Error{DecompressionFailed, err.Error()}
+	}
+	d.decoded = append(d.decoded, HeaderBlock{streamID, headers})
+	if requiredInsertCount > 0 {
+		d.decoderStream = AppendSectionAcknowledgement(d.decoderStream, streamID)
+		if requiredInsertCount > d.acknowledgedInsertCount {
+			d.acknowledgedInsertCount = requiredInsertCount
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) decodeFieldLines(r *bytes.Reader) ([]HeaderField, uint64, error) {
+	requiredInsertCount, base, err := d.readPrefix(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	dynamicField := func(absoluteIndex uint64) (HeaderField, error) {
+		f, ok := d.table.get(absoluteIndex)
+		if !ok || absoluteIndex >= requiredInsertCount {
+			return f, errors.New("invalid dynamic table reference")
+		}
+		return f, nil
+	}
+	staticField := func(index uint64) (HeaderField, error) {
+		if index >= uint64(len(staticTable)) {
+			return HeaderField{}, errors.New("invalid static table index")
+		}
+		return staticTable[index], nil
+	}
+
+	var headers []HeaderField
+	for r.Len() > 0 {
+		first, _ := r.ReadByte()
+		r.UnreadByte()
+		var f HeaderField
+		var index uint64
+		switch {
+		case first&0x80 != 0: // Indexed Field Line
+			if _, index, err = readInt(r, 6); err == nil {
+				if first&0x40 != 0 {
+					f, err = staticField(index)
+				} else if index < base {
+					f, err = dynamicField(base - 1 - index)
+				} else {
+					err = errors.New("invalid relative index")
+				}
+			}
+		case first&0x40 != 0: // Literal Field Line with Name Reference
+			if _, index, err = readInt(r, 4); err == nil {
+				if first&0x10 != 0 {
+					f, err = staticField(index)
+				} else if index < base {
+					f, err = dynamicField(base - 1 - index)
+				} else {
+					err = errors.New("invalid relative index")
+				}
+			}
+			if err == nil {
+				f.Value, err = readString(r, 7)
+			}
+		case first&0x20 != 0: // Literal Field Line with Literal Name
+			if f.Name, err = readString(r, 3); err == nil {
+				f.Value, err = readString(r, 7)
+			}
+		case first&0x10 != 0: // Indexed Field Line with Post-Base Index
+			if _, index, err = readInt(r, 4); err == nil {
+				f, err = dynamicField(base + index)
+			}
+		default: // Literal Field Line with Post-Base Name Reference
+			if _, index, err = readInt(r, 3); err == nil {
+				if f, err = dynamicField(base + index); err == nil {
+					f.Value, err = readString(r, 7)
+				}
+			}
+		}
+		if err == errIncomplete {
+			return nil, 0, errors.New("truncated field line")
+		} else if err != nil {
+			return nil, 0, err
+		}
+		headers = append(headers, f)
+	}
+	return headers, requiredInsertCount, nil
+}
+
+// Returns the field sections decoded since the last call.
+func (d *Decoder) DecodedHeaderBlocks() []HeaderBlock {
+	decoded := d.decoded
+	d.decoded = nil
+	return decoded
+}
+
+// Abandons the blocked field sections of the given stream, e.g. when it is reset, and signals it to the encoder.
+func (d *Decoder) CancelStream(streamID uint64) {
+	var stillBlocked []blockedSection
+	for _, s := range d.blocked {
+		if s.streamID != streamID {
+			stillBlocked = append(stillBlocked, s)
+		}
+	}
+	d.blocked = stillBlocked
+	d.decoderStream = AppendStreamCancellation(d.decoderStream, streamID)
+}
+
+// Returns the instructions to send on the decoder stream since the last call. Insertions not acknowledged by a Section
+// Acknowledgement are acknowledged with an Insert Count Increment.
+func (d *Decoder) DecoderStream() []byte {
+	if d.table.insertCount() > d.acknowledgedInsertCount {
+		d.decoderStream = AppendInsertCountIncrement(d.decoderStream, d.table.insertCount()-d.acknowledgedInsertCount)
+		d.acknowledgedInsertCount = d.table.insertCount()
+	}
+	instructions := d.decoderStream
+	d.decoderStream = nil
+	return instructions
+}
@@ -0,0 +1,87 @@
+package qpack
+
+// The dynamic table of RFC 9204 Section 3.2. Entries are identified by their absolute index, i.e. the number of
+// entries inserted before them.
+type dynamicTable struct {
+	entries  []HeaderField
+	dropped  uint64 // The number of entries evicted
+	size     uint64
+	capacity uint64
+}
+
+func (t *dynamicTable) insertCount() uint64 {
+	return t.dropped + uint64(len(t.entries))
+}
+
+func (t *dynamicTable) get(absoluteIndex uint64) (HeaderField, bool) {
+	if absoluteIndex < t.dropped || absoluteIndex >= t.insertCount() {
+		return HeaderField{}, false
+	}
+	return t.entries[absoluteIndex-t.dropped], true
+}
+
+// Returns the absolute index of the most recent entry matching the field, and of the most recent entry matching its
+// name.
+func (t *dynamicTable) find(f HeaderField) (fieldIndex uint64, fieldFound bool, nameIndex uint64, nameFound bool) {
+	for i := len(t.entries) - 1; i >= 0 && !fieldFound; i-- {
+		if t.entries[i].Name != f.Name {
+			continue
+		}
+		if !nameFound {
+			nameIndex, nameFound = t.dropped+uint64(i), true
+		}
+		if t.entries[i].Value == f.Value {
+			fieldIndex, fieldFound = t.dropped+uint64(i), true
+		}
+	}
+	return
+}
+
+// Returns the number of entries to evict for the table to hold the given number of additional bytes, and whether it
+// is possible.
+func (t *dynamicTable) evictionsFor(size uint64) (int, bool) {
+	if size > t.capacity {
+		return 0, false
+	}
+	n, available := 0, t.capacity-t.size
+	for available < size {
+		available += t.entries[n].size()
+		n++
+	}
+	return n, true
+}
+
+func (t *dynamicTable) evict(n int) {
+	for _, e := range t.entries[:n] {
+		t.size -= e.size()
+	}
+	t.entries = t.entries[n:]
+	t.dropped += uint64(n)
+}
+
+// Sets the capacity and evicts the entries that no longer fit.
+func (t *dynamicTable) setCapacity(capacity uint64) {
+	t.capacity = capacity
+	n := 0
+	for size := t.size; size > capacity; n++ {
+		size -= t.entries[n].size()
+	}
+	t.evict(n)
+}
+
+// Inserts the field, evicting entries when needed. It returns false when the field is larger than the capacity.
+func (t *dynamicTable) insert(f HeaderField) bool {
+	n, ok := t.evictionsFor(f.size())
+	if !ok {
+		return false
+	}
+	t.evict(n)
+	t.entries = append(t.entries, f)
+	t.size += f.size()
+	return true
+}
+
+// The maximum number of entries of a table of the given maximum capacity, used to encode the Required Insert Count.
+func maxEntries(maxTableCapacity uint64) uint64 {
+	return maxTableCapacity / entryOverhead
+}
@@ -0,0 +1,225 @@
+package qpack
+
+import (
+	"bytes"
+	"errors"
+)
+
+// The options of the Encoder.
+const (
+	EncoderOptIndexAggressively uint32 = 1 << iota // Inserts fields in the dynamic table the first time they are encoded
+)
+
+// A fieldSection is a field section that references the dynamic table and has not been acknowledged yet.
+type fieldSection struct {
+	requiredInsertCount uint64
+	minReference        uint64 // The smallest absolute index referenced, entries from there cannot be evicted
+}
+
+// The Encoder encodes field sections. It only uses the dynamic table once initialised with the settings of the peer.
+// Fields are inserted the second time they are encoded, or the first time with EncoderOptIndexAggressively.
+type Encoder struct {
+	table              dynamicTable
+	maxTableCapacity   uint64
+	maxBlockedStreams  uint64
+	knownReceivedCount uint64
+	sections           map[uint64][]fieldSection
+	options            uint32
+	seen               map[HeaderField]bool
+	decoderStream      []byte
+}
+
+func NewEncoder() *Encoder {
+	return &Encoder{sections: make(map[uint64][]fieldSection), seen: make(map[HeaderField]bool)}
+}
+
+// Initialises the encoder with the SETTINGS_QPACK_MAX_TABLE_CAPACITY and SETTINGS_QPACK_BLOCKED_STREAMS of the peer,
+// and the capacity of the dynamic table, which is capped to the maximum. It returns the instructions to send on the
+// encoder stream.
+func (e *Encoder) Init(maxTableCapacity uint64, capacity uint64, maxBlockedStreams uint64, options uint32) []byte {
+	if capacity > maxTableCapacity {
+		capacity = maxTableCapacity
+	}
+	e.maxTableCapacity = maxTableCapacity
+	e.maxBlockedStreams = maxBlockedStreams
+	e.options = options
+	if capacity == e.table.capacity {
+		return nil
+	}
+	e.table.setCapacity(capacity)
+	return AppendSetDynamicTableCapacity(nil, capacity)
+}
+
+func (e *Encoder) isBlocking(streamID uint64) bool {
+	for _, s := range e.sections[streamID] {
+		if s.requiredInsertCount > e.knownReceivedCount {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Encoder) blockedStreams() uint64 {
+	var n uint64
+	for streamID := range e.sections {
+		if e.isBlocking(streamID) {
+			n++
+		}
+	}
+	return n
+}
+
+// Returns whether the number of entries can be evicted, i.e. none of them is referenced by an unacknowledged section.
+func (e *Encoder) canEvict(n int, minReference uint64) bool {
+	if n == 0 {
+		return true
+	}
+	for _, sections := range e.sections {
+		for _, s := range sections {
+			if s.minReference < minReference {
+				minReference = s.minReference
+			}
+		}
+	}
+	return e.table.dropped+uint64(n) <= minReference
+}
+
+// Encodes the field section sent on the given stream. It returns the encoded field section and the instructions to
+// send on the encoder stream.
+func (e *Encoder) Encode(streamID uint64, headers []HeaderField) ([]byte, []byte) {
+	var encoderStream, fieldLines []byte
+	base := e.table.insertCount()
+	canBlock := e.isBlocking(streamID) || e.blockedStreams() < e.maxBlockedStreams
+	var requiredInsertCount uint64
+	minReference := ^uint64(0)
+	reference := func(absoluteIndex uint64) {
+		if absoluteIndex+1 > requiredInsertCount {
+			requiredInsertCount = absoluteIndex + 1
+		}
+		if absoluteIndex < minReference {
+			minReference = absoluteIndex
+		}
+	}
+	usable := func(absoluteIndex uint64) bool {
+		return absoluteIndex < e.knownReceivedCount || canBlock
+	}
+
+	for _, f := range headers {
+		if index, ok := staticFieldIndex[f]; ok {
+			fieldLines = appendInt(fieldLines, 6, 0xc0, index)
+			continue
+		}
+		fieldIndex, fieldFound, nameIndex, nameFound := e.table.find(f)
+		if fieldFound && usable(fieldIndex) {
+			reference(fieldIndex)
+			fieldLines = appendIndexedField(fieldLines, base, fieldIndex)
+			continue
+		}
+		if canBlock && (e.options&EncoderOptIndexAggressively != 0 || e.seen[f]) {
+			if n, ok := e.table.evictionsFor(f.size()); ok && e.canEvict(n, minReference) {
+				if staticIndex, ok := staticNameIndex[f.Name]; ok {
+					encoderStream = AppendInsertWithNameReference(encoderStream, true, staticIndex, f.Value, true)
+				} else {
+					encoderStream = AppendInsertWithLiteralName(encoderStream, f.Name, f.Value, true)
+				}
+				e.table.insert(f)
+				reference(e.table.insertCount() - 1)
+				fieldLines = appendIndexedField(fieldLines, base, e.table.insertCount()-1)
+				continue
+			}
+		}
+		e.seen[f] = true
+		if staticIndex, ok := staticNameIndex[f.Name]; ok {
+			fieldLines = appendInt(fieldLines, 4, 0x50, staticIndex)
+		} else if nameFound && usable(nameIndex) && nameIndex >= e.table.dropped {
+			reference(nameIndex)
+			if nameIndex < base {
+				fieldLines = appendInt(fieldLines, 4, 0x40, base-1-nameIndex)
+			} else {
+				fieldLines = appendInt(fieldLines, 3, 0x00, nameIndex-base)
+			}
+		} else {
+			fieldLines = appendString(fieldLines, 3, 0x20, f.Name, true)
+		}
+		fieldLines = appendString(fieldLines, 7, 0, f.Value, true)
+	}
+
+	var encodedInsertCount uint64
+	if requiredInsertCount > 0 {
+		encodedInsertCount = requiredInsertCount%(2*maxEntries(e.maxTableCapacity)) + 1
+		e.sections[streamID] = append(e.sections[streamID], fieldSection{requiredInsertCount, minReference})
+	}
+	prefix := appendInt(nil, 8, 0, encodedInsertCount)
+	if base >= requiredInsertCount {
+		prefix = appendInt(prefix, 7, 0x00, base-requiredInsertCount)
+	} else {
+		prefix = appendInt(prefix, 7, 0x80, requiredInsertCount-base-1)
+	}
+	return append(prefix, fieldLines...), encoderStream
+}
+
+func appendIndexedField(b []byte, base uint64, absoluteIndex uint64) []byte {
+	if absoluteIndex < base {
+		return appendInt(b, 6, 0x80, base-1-absoluteIndex)
+	}
+	return appendInt(b, 4, 0x10, absoluteIndex-base)
+}
+
+// Processes the instructions received on the decoder stream. Incomplete instructions are kept until more data is
+// received.
+func (e *Encoder) DecoderIn(data []byte) error {
+	e.decoderStream = append(e.decoderStream, data...)
+	for len(e.decoderStream) > 0 {
+		r := bytes.NewReader(e.decoderStream)
+		first := e.decoderStream[0]
+		var err error
+		switch {
+		case first&0x80 != 0:
+			var streamID uint64
+			if _, streamID, err = readInt(r, 7); err == nil {
+				err = e.acknowledgeSection(streamID)
+			}
+		case first&0x40 != 0:
+			var streamID uint64
+			if _, streamID, err = readInt(r, 6); err == nil {
+				delete(e.sections, streamID)
+			}
+		default:
+			var increment uint64
+			if _, increment, err = readInt(r, 6); err == nil {
+				err = e.incrementInsertCount(increment)
+			}
+		}
+		if err == errIncomplete {
+			return nil
+		} else if err != nil {
+			return &Error{DecoderStreamError, err.Error()}
+		}
+		e.decoderStream = e.decoderStream[len(e.decoderStream)-r.Len():]
+	}
+	return nil
+}
+
+func (e *Encoder) acknowledgeSection(streamID uint64) error {
+	sections := e.sections[streamID]
+	if len(sections) == 0 {
+		return errors.New("acknowledgement of a section that is not outstanding")
+	}
+	if sections[0].requiredInsertCount > e.knownReceivedCount {
+		e.knownReceivedCount = sections[0].requiredInsertCount
+	}
+	if len(sections) == 1 {
+		delete(e.sections, streamID)
+	} else {
+		e.sections[streamID] = sections[1:]
+	}
+	return nil
+}
+
+func (e *Encoder) incrementInsertCount(increment uint64) error {
+	if increment == 0 || e.knownReceivedCount+increment > e.table.insertCount() {
+		return errors.New("invalid insert count increment")
+	}
+	e.knownReceivedCount += increment
+	return nil
+}
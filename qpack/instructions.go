@@ -0,0 +1,43 @@
+package qpack
+
+// Appends a Set Dynamic Table Capacity instruction of the encoder stream.
+func AppendSetDynamicTableCapacity(b []byte, capacity uint64) []byte {
+	return appendInt(b, 5, 0x20, capacity)
+}
+
+// Appends an Insert with Name Reference instruction of the encoder stream. A dynamic index is relative to the number
+// of entries inserted.
+func AppendInsertWithNameReference(b []byte, static bool, index uint64, value string, huffman bool) []byte {
+	flags := byte(0x80)
+	if static {
+		flags |= 0x40
+	}
+	b = appendInt(b, 6, flags, index)
+	return appendString(b, 7, 0, value, huffman)
+}
+
+// Appends an Insert with Literal Name instruction of the encoder stream.
+func AppendInsertWithLiteralName(b []byte, name string, value string, huffman bool) []byte {
+	b = appendString(b, 5, 0x40, name, huffman)
+	return appendString(b, 7, 0, value, huffman)
+}
+
+// Appends a Duplicate instruction of the encoder stream. The index is relative to the number of entries inserted.
+func AppendDuplicate(b []byte, index uint64) []byte {
+	return appendInt(b, 5, 0x00, index)
+}
+
+// Appends a Section Acknowledgement instruction of the decoder stream.
+func AppendSectionAcknowledgement(b []byte, streamID uint64) []byte {
+	return appendInt(b, 7, 0x80, streamID)
+}
+
+// Appends a Stream Cancellation instruction of the decoder stream.
+func AppendStreamCancellation(b []byte, streamID uint64) []byte {
+	return appendInt(b, 6, 0x40, streamID)
+}
+
+// Appends an Insert Count Increment instruction of the decoder stream.
+func AppendInsertCountIncrement(b []byte, increment uint64) []byte {
+	return appendInt(b, 6, 0x00, increment)
+}
@@ -0,0 +1,127 @@
+// This package implements QPACK, the field compression format of HTTP/3, as specified in RFC 9204.
+//
+// The Encoder and the Decoder maintain the dynamic table and process the instructions received on the decoder and
+// encoder streams respectively. The Append functions build individual instructions without any validation, so that
+// malformed instructions can be sent to test the robustness of a peer.
+package qpack
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// The error codes of QPACK, see RFC 9204 Section 6.
+const (
+	DecompressionFailed = 0x200
+	EncoderStreamError  = 0x201
+	DecoderStreamError  = 0x202
+)
+
+// The types of the QPACK unidirectional streams, see RFC 9204 Section 4.2.
+const (
+	StreamTypeEncoder = 0x02
+	StreamTypeDecoder = 0x03
+)
+
+const entryOverhead = 32 // The size of an entry is the sum of the lengths of its name and value plus 32 bytes
+
+type HeaderField struct {
+	Name, Value string
+}
+
+func (f HeaderField) size() uint64 {
+	return uint64(len(f.Name) + len(f.Value) + entryOverhead)
+}
+
+// A HeaderBlock is a field section decoded for a given request stream.
+type HeaderBlock struct {
+	StreamID uint64
+	Headers  []HeaderField
+}
+
+// An Error is a connection error of QPACK.
+type Error struct {
+	Code   uint64
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("QPACK error 0x%x: %s", e.Code, e.Reason)
+}
+
+var errIncomplete = errors.New("incomplete instruction")
+
+// Appends the integer using the prefixed integer representation of RFC 7541 Section 5.1. The flags occupy the bits of
+// the first byte that are not part of the prefix.
+func appendInt(b []byte, prefix uint8, flags byte, v uint64) []byte {
+	max := uint64(1)<<prefix - 1
+	if v < max {
+		return append(b, flags|byte(v))
+	}
+	b = append(b, flags|byte(max))
+	v -= max
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// Reads a prefixed integer and returns the first byte, which also contains the flags.
+func readInt(r *bytes.Reader, prefix uint8) (byte, uint64, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, errIncomplete
+	}
+	max := uint64(1)<<prefix - 1
+	v := uint64(first) & max
+	if v < max {
+		return first, v, nil
+	}
+	for shift := uint(0); ; shift += 7 {
+		if shift > 56 {
+			return first, 0, errors.New("integer overflow")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return first, 0, errIncomplete
+		}
+		v += uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return first, v, nil
+		}
+	}
+}
+
+// Appends the string literal of RFC 7541 Section 5.2. The Huffman encoding is used when it is shorter and allowed.
+func appendString(b []byte, prefix uint8, flags byte, s string, huffman bool) []byte {
+	if huffman && hpack.HuffmanEncodeLength(s) < uint64(len(s)) {
+		b = appendInt(b, prefix, flags|1<<prefix, hpack.HuffmanEncodeLength(s))
+		return hpack.AppendHuffmanString(b, s)
+	}
+	b = appendInt(b, prefix, flags, uint64(len(s)))
+	return append(b, s...)
+}
+
+func readString(r *bytes.Reader, prefix uint8) (string, error) {
+	first, length, err := readInt(r, prefix)
+	if err != nil {
+		return "", err
+	}
+	if uint64(r.Len()) < length {
+		return "", errIncomplete
+	}
+	data := make([]byte, length)
+	r.Read(data)
+	if first&(1<<prefix) == 0 {
+		return string(data), nil
+	}
+	s, err := hpack.HuffmanDecodeToString(data)
+	if err != nil {
+		return "", errors.New("invalid Huffman-encoded string")
+	}
+	return s, nil
+}
@@ -0,0 +1,100 @@
+package qpack
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func unhex(s string) []byte {
+	b, _ := hex.DecodeString(s)
+	return b
+}
+
+// Uses the examples of RFC 9204 Appendix B.1 and B.2.
+func TestDecoder_Examples(t *testing.T) {
+	d := NewDecoder(220, 1)
+	if err := d.HeaderIn(unhex("0000510b2f696e6465782e68746d6c"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if blocks := d.DecodedHeaderBlocks(); !reflect.DeepEqual(blocks, []HeaderBlock{{0, []HeaderField{{":path", "/index.html"}}}}) {
+		t.Errorf("Unexpected decoded header blocks %v", blocks)
+	}
+
+	if err := d.HeaderIn(unhex("03811011"), 4); err != nil {
+		t.Fatal(err)
+	}
+	if blocks := d.DecodedHeaderBlocks(); len(blocks) != 0 {
+		t.Errorf("Expected the section to be blocked, got %v", blocks)
+	}
+	if err := d.EncoderIn(unhex("3fbd01c00f7777772e6578616d706c652e636f6dc10c2f73616d706c652f70617468")); err != nil {
+		t.Fatal(err)
+	}
+	expected := []HeaderBlock{{4, []HeaderField{{":authority", "www.example.com"}, {":path", "/sample/path"}}}}
+	if blocks := d.DecodedHeaderBlocks(); !reflect.DeepEqual(blocks, expected) {
+		t.Errorf("Unexpected decoded header blocks %v", blocks)
+	}
+	if instructions := d.DecoderStream(); !bytes.Equal(instructions, unhex("84")) {
+		t.Errorf("Unexpected decoder stream instructions %x", instructions)
+	}
+
+	if err := d.EncoderIn(unhex("3fe1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.EncoderIn(unhex("01")); err == nil {
+		t.Error("Expected a capacity larger than the maximum to be rejected")
+	}
+}
+
+func TestEncoder_RoundTrip(t *testing.T) {
+	e, d := NewEncoder(), NewDecoder(4096, 10)
+	if err := d.EncoderIn(e.Init(4096, 1024, 10, EncoderOptIndexAggressively)); err != nil {
+		t.Fatal(err)
+	}
+	headers := []HeaderField{{":method", "GET"}, {":scheme", "https"}, {":authority", "example.com"}, {":path", "/index.html"}, {"x-custom", "value"}}
+	for i, streamID := range []uint64{0, 4, 8} {
+		block, encoderStream := e.Encode(streamID, headers)
+		if (i == 0) == (len(encoderStream) == 0) {
+			t.Errorf("Unexpected encoder stream instructions %x for section %d", encoderStream, i)
+		}
+		if err := d.HeaderIn(block, streamID); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.EncoderIn(encoderStream); err != nil {
+			t.Fatal(err)
+		}
+		if blocks := d.DecodedHeaderBlocks(); !reflect.DeepEqual(blocks, []HeaderBlock{{streamID, headers}}) {
+			t.Errorf("Unexpected decoded header blocks %v", blocks)
+		}
+		if err := e.DecoderIn(d.DecoderStream()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if e.knownReceivedCount != 3 || len(e.sections) != 0 {
+		t.Errorf("Expected all the insertions and sections to be acknowledged")
+	}
+	if err := e.DecoderIn(AppendSectionAcknowledgement(nil, 0)); err == nil {
+		t.Error("Expected an unexpected acknowledgement to be rejected")
+	}
+}
+
+// The limit of blocked streams applies to streams, not to the field sections blocked on them.
+func TestDecoder_BlockedStreams(t *testing.T) {
+	d := NewDecoder(220, 1)
+	for i := 0; i < 2; i++ {
+		if err := d.HeaderIn(unhex("03811011"), 4); err != nil {
+			t.Fatalf("Expected section %d of a blocked stream to be accepted, got %v", i, err)
+		}
+	}
+	if err := d.HeaderIn(unhex("03811011"), 8); err == nil {
+		t.Error("Expected a second blocked stream to be rejected")
+	}
+	if err := d.EncoderIn(unhex("3fbd01c00f7777772e6578616d706c652e636f6dc10c2f73616d706c652f70617468")); err != nil {
+		t.Fatal(err)
+	}
+	fields := []HeaderField{{":authority", "www.example.com"}, {":path", "/sample/path"}}
+	if blocks := d.DecodedHeaderBlocks(); !reflect.DeepEqual(blocks, []HeaderBlock{{4, fields}, {4, fields}}) {
+		t.Errorf("Unexpected decoded header blocks %v", blocks)
+	}
+}
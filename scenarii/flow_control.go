@@ -40,6 +40,7 @@ func (s *FlowControlScenario) Run(conn *qt.Connection, trace *qt.Trace, preferre
 	defer connAgents.CloseConnection(false, 0, "")
 
 	incPackets := conn.IncomingPackets.RegisterNewChan(1000)
+	violations := conn.FlowControlViolations.RegisterNewChan(100)
 
 	conn.SendHTTP09GETRequest(preferredPath, 0)
 
@@ -68,6 +69,11 @@ forLoop:
 				conn.FrameQueue.Submit(qt.QueuedFrame{&qt.MaxStreamDataFrame{0, uint64(conn.TLSTPHandler.MaxStreamDataBidiLocal)}, qt.EncryptionLevel1RTT})
 				shouldResume = true
 			}
+		case i := <-violations:
+			v := i.(qt.FlowControlViolation)
+			trace.Results["flow_control_violation"] = v.Error()
+			trace.MarkError(FC_HostSentMoreThanLimit, v.Error(), nil)
+			return
 		case <-conn.ConnectionClosed:
 			return
 		case <-s.Timeout():
@@ -0,0 +1,99 @@
+package scenarii
+
+import (
+	"fmt"
+
+	qt "github.com/PROGNOSISTool/adapter-quic"
+)
+
+const (
+	G_TLSHandshakeFailed                = 1
+	G_HostDidNotRespond                 = 2
+	G_GreaseFrameNotRejected            = 3
+	G_GreaseFrameRejectedWithWrongError = 4
+)
+
+// Uses a reserved version in the first Initial packet, sends reserved transport parameters, advertises grease_quic_bit
+// and clears the QUIC bit when the host also advertises it. The host must ignore all of these and answer to a request.
+// It then sends a frame of an unknown type, which the host must reject with a FRAME_ENCODING_ERROR.
+type GreaseScenario struct {
+	AbstractScenario
+}
+
+func NewGreaseScenario() *GreaseScenario {
+	return &GreaseScenario{AbstractScenario{name: "grease", version: 1}}
+}
+func (s *GreaseScenario) Run(conn *qt.Connection, trace *qt.Trace, preferredPath string, debug bool) {
+	conn.SetGrease(qt.GreaseOptions{TransportParameters: true, Version: true, QuicBit: true})
+	trace.Results["greased_version"] = fmt.Sprintf("0x%08x", conn.Version)
+
+	incomingPackets := conn.IncomingPackets.RegisterNewChan(1000)
+	quicBitCleared := 0
+	countQuicBitCleared := func(i interface{}) {
+		if p, ok := i.(qt.Framer); ok {
+			switch h := p.GetHeader().(type) {
+			case *qt.LongHeader:
+				if h.QuicBitCleared {
+					quicBitCleared++
+				}
+			case *qt.ShortHeader:
+				if h.QuicBitCleared {
+					quicBitCleared++
+				}
+			}
+		}
+	}
+	defer func() { trace.Results["quic_bit_cleared_packets_received"] = quicBitCleared }()
+
+	connAgents := s.CompleteHandshake(conn, trace, G_TLSHandshakeFailed)
+	if connAgents == nil {
+		return
+	}
+	defer connAgents.CloseConnection(false, 0, "")
+
+	trace.Results["peer_grease_quic_bit"] = conn.TLSTPHandler.ReceivedParameters.GreaseQuicBit
+	trace.Results["quic_bit_cleared"] = conn.ClearQuicBit()
+
+	responseChan := connAgents.AddHTTPAgent().SendRequest(preferredPath, "GET", trace.Host, nil)
+
+	trace.ErrorCode = G_HostDidNotRespond
+responseLoop:
+	for {
+		select {
+		case i := <-incomingPackets:
+			countQuicBitCleared(i)
+		case <-responseChan:
+			break responseLoop
+		case <-conn.ConnectionClosed:
+			return
+		case <-s.Timeout():
+			return
+		}
+	}
+
+	greaseFrame := qt.NewGreaseFrame()
+	trace.Results["grease_frame_type"] = fmt.Sprintf("0x%x", greaseFrame.RawType)
+	conn.FrameQueue.Submit(qt.QueuedFrame{Frame: greaseFrame, EncryptionLevel: qt.EncryptionLevel1RTT})
+
+	trace.ErrorCode = G_GreaseFrameNotRejected
+	for {
+		select {
+		case i := <-incomingPackets:
+			countQuicBitCleared(i)
+			if p, ok := i.(qt.Framer); ok && p.Contains(qt.ConnectionCloseType) {
+				cc := p.GetFirst(qt.ConnectionCloseType).(*qt.ConnectionCloseFrame)
+				trace.Results["connection_closed_error_code"] = fmt.Sprintf("0x%x", cc.ErrorCode)
+				if cc.ErrorCode != qt.ERR_FRAME_ENCODING_ERROR {
+					trace.MarkError(G_GreaseFrameRejectedWithWrongError, fmt.Sprintf("Expected 0x%02x, got 0x%02x", qt.ERR_FRAME_ENCODING_ERROR, cc.ErrorCode), p)
+					return
+				}
+				trace.ErrorCode = 0
+				return
+			}
+		case <-conn.ConnectionClosed:
+			return
+		case <-s.Timeout():
+			return
+		}
+	}
+}
@@ -6,7 +6,7 @@ import (
 	qt "github.com/PROGNOSISTool/adapter-quic"
 	"github.com/PROGNOSISTool/adapter-quic/agents"
 	"github.com/PROGNOSISTool/adapter-quic/http3"
-	ls_qpack_go "github.com/PROGNOSISTool/ls-qpack-go"
+	"github.com/PROGNOSISTool/adapter-quic/qpack"
 )
 
 const (
@@ -26,7 +26,7 @@ func NewHTTP3EncoderStreamScenario() *HTTP3EncoderStreamScenario {
 func (s *HTTP3EncoderStreamScenario) Run(conn *qt.Connection, trace *qt.Trace, preferredPath string, debug bool) {
 	conn.TLSTPHandler.MaxUniStreams = 3
 
-	http := agents.HTTP3Agent{QPACKEncoderOpts: ls_qpack_go.LSQPackEncOptIxAggr}
+	http := agents.HTTP3Agent{QPACKEncoderOpts: qpack.EncoderOptIndexAggressively}
 	connAgents := s.CompleteHandshake(conn, trace, H3ES_TLSHandshakeFailed, &http)
 	if connAgents == nil {
 		return
@@ -0,0 +1,121 @@
+package scenarii
+
+import (
+	qt "github.com/PROGNOSISTool/adapter-quic"
+	"github.com/PROGNOSISTool/adapter-quic/agents"
+	"github.com/PROGNOSISTool/adapter-quic/http3"
+)
+
+const (
+	H3P_TLSHandshakeFailed        = 1
+	H3P_RequestTimeout            = 2
+	H3P_NotEnoughStreamsAvailable = 3
+	H3P_PrioritiesNotHonoured     = 4
+	H3P_ResponsesTooShort         = 5
+)
+
+const h3pBackgroundRequests = 3
+
+// The HTTP3PrioritiesScenario sends several non-urgent requests, then an urgent one once the DATA frames of their
+// responses start being received. It records the order in which the DATA frames of the responses are received and
+// checks that the urgent response was completed before the other non-urgent responses that were still in flight when it
+// was requested, as expected from a server honouring RFC 9218 priorities. The responses must be large enough for the
+// non-urgent ones not to complete before the urgent request is sent.
+type HTTP3PrioritiesScenario struct {
+	AbstractScenario
+}
+
+func NewHTTP3PrioritiesScenario() *HTTP3PrioritiesScenario {
+	return &HTTP3PrioritiesScenario{AbstractScenario{name: "http3_priorities", version: 1, http3: true}}
+}
+func (s *HTTP3PrioritiesScenario) Run(conn *qt.Connection, trace *qt.Trace, preferredPath string, debug bool) {
+	conn.TLSTPHandler.MaxUniStreams = 3
+
+	http := agents.HTTP3Agent{}
+	connAgents := s.CompleteHandshake(conn, trace, H3P_TLSHandshakeFailed, &http)
+	if connAgents == nil {
+		return
+	}
+	defer connAgents.CloseConnection(false, 0, "")
+
+	if conn.TLSTPHandler.ReceivedParameters.MaxUniStreams < 3 || conn.TLSTPHandler.ReceivedParameters.MaxBidiStreams < h3pBackgroundRequests+1 {
+		trace.ErrorCode = H3P_NotEnoughStreamsAvailable
+		trace.Results["max_uni_streams"] = conn.TLSTPHandler.ReceivedParameters.MaxUniStreams
+		trace.Results["max_bidi_streams"] = conn.TLSTPHandler.ReceivedParameters.MaxBidiStreams
+		return
+	}
+	frameReceived := http.FrameReceived.RegisterNewChan(1000)
+	httpResponseReceived := http.HTTPResponseReceived()
+	responseReceived := httpResponseReceived.RegisterNewChan(1000)
+
+	background := http3.Priority{Urgency: http3.LowestUrgency}
+	urgent := http3.Priority{Urgency: 0}
+	var backgroundStreams []uint64
+	inFlight := make(map[uint64]bool) // The non-urgent responses not completed yet
+	for i := 0; i < h3pBackgroundRequests; i++ {
+		backgroundStreams = append(backgroundStreams, conn.CurrentStreamID)
+		inFlight[conn.CurrentStreamID] = true
+		http.SendHTTP3Request(agents.HTTP3Request{Method: "GET", Authority: trace.Host, Path: preferredPath, Priority: &background})
+	}
+	urgentStream := agents.HTTPNoStream
+	var inFlightWhenUrgent []uint64 // The non-urgent responses in flight when the urgent request was sent
+
+	var dataFramesOrder []uint64
+	var completionOrder []uint64
+	defer func() {
+		trace.Results["urgent_stream"] = urgentStream
+		trace.Results["background_streams"] = backgroundStreams
+		trace.Results["in_flight_when_urgent"] = inFlightWhenUrgent
+		trace.Results["data_frames_order"] = dataFramesOrder
+		trace.Results["completion_order"] = completionOrder
+	}()
+
+	trace.ErrorCode = H3P_RequestTimeout
+	for len(completionOrder) < h3pBackgroundRequests+1 {
+		select {
+		case i := <-frameReceived:
+			fr := i.(agents.HTTP3FrameReceived)
+			if _, ok := fr.Frame.(*http3.DATA); ok && qt.IsBidi(fr.StreamID) {
+				dataFramesOrder = append(dataFramesOrder, fr.StreamID)
+				if urgentStream == agents.HTTPNoStream && inFlight[fr.StreamID] {
+					for _, stream := range backgroundStreams { // The response being received may be completed first
+						if inFlight[stream] && stream != fr.StreamID {
+							inFlightWhenUrgent = append(inFlightWhenUrgent, stream)
+						}
+					}
+					urgentStream = conn.CurrentStreamID
+					http.SendHTTP3Request(agents.HTTP3Request{Method: "GET", Authority: trace.Host, Path: preferredPath, Priority: &urgent})
+				}
+			}
+		case i := <-responseReceived:
+			response := i.(agents.HTTP3Response)
+			completionOrder = append(completionOrder, response.StreamID())
+			delete(inFlight, response.StreamID())
+			if urgentStream == agents.HTTPNoStream && len(inFlight) == 0 {
+				trace.ErrorCode = H3P_ResponsesTooShort
+				return
+			}
+		case <-conn.ConnectionClosed:
+			return
+		case <-s.Timeout():
+			return
+		}
+	}
+
+	trace.ErrorCode = 0
+	if len(inFlightWhenUrgent) == 0 {
+		trace.ErrorCode = H3P_ResponsesTooShort
+	}
+	for _, stream := range completionOrder {
+		if stream == urgentStream {
+			break
+		}
+		for _, inFlightStream := range inFlightWhenUrgent {
+			if stream == inFlightStream {
+				trace.ErrorCode = H3P_PrioritiesNotHonoured
+			}
+		}
+	}
+	s.Finished()
+	<-s.Timeout()
+}
@@ -0,0 +1,97 @@
+package scenarii
+
+import (
+	qt "github.com/PROGNOSISTool/adapter-quic"
+	"github.com/PROGNOSISTool/adapter-quic/agents"
+)
+
+const (
+	H3SP_TLSHandshakeFailed        = 1
+	H3SP_RequestTimeout            = 2
+	H3SP_NotEnoughStreamsAvailable = 3
+	H3SP_NoPushPromised            = 4
+)
+
+const h3spMaxPushes = 8
+
+// The HTTP3ServerPushScenario allows the server to push responses and sends a request. It records the pushes promised
+// by the server and the responses received on push streams, along with the violations of RFC 9114 observed.
+type HTTP3ServerPushScenario struct {
+	AbstractScenario
+}
+
+func NewHTTP3ServerPushScenario() *HTTP3ServerPushScenario {
+	return &HTTP3ServerPushScenario{AbstractScenario{name: "http3_server_push", version: 1, http3: true}}
+}
+func (s *HTTP3ServerPushScenario) Run(conn *qt.Connection, trace *qt.Trace, preferredPath string, debug bool) {
+	conn.TLSTPHandler.MaxUniStreams = 3 + h3spMaxPushes
+
+	http := agents.HTTP3Agent{MaxPushes: h3spMaxPushes}
+	connAgents := s.CompleteHandshake(conn, trace, H3SP_TLSHandshakeFailed, &http)
+	if connAgents == nil {
+		return
+	}
+	defer connAgents.CloseConnection(false, 0, "")
+
+	if conn.TLSTPHandler.ReceivedParameters.MaxUniStreams < 3 {
+		trace.ErrorCode = H3SP_NotEnoughStreamsAvailable
+		trace.Results["max_uni_streams"] = conn.TLSTPHandler.ReceivedParameters.MaxUniStreams
+		return
+	}
+	pushPromised := http.PushPromised.RegisterNewChan(1000)
+	pushReceived := http.PushReceived.RegisterNewChan(1000)
+
+	responseChan := http.SendHTTP3Request(agents.HTTP3Request{Method: "GET", Authority: trace.Host, Path: preferredPath})
+
+	pushes := make(map[uint64]agents.HTTP3Push)
+	var pushIDs []uint64
+	pushUpdated := func(push agents.HTTP3Push) {
+		if _, ok := pushes[push.PushID]; !ok {
+			pushIDs = append(pushIDs, push.PushID)
+		}
+		pushes[push.PushID] = push
+	}
+	defer func() {
+		var results []map[string]interface{}
+		for _, id := range pushIDs {
+			push := pushes[id]
+			result := map[string]interface{}{
+				"push_id":           push.PushID,
+				"promise_streams":   push.PromiseStreams,
+				"promised_headers":  push.PromisedHeaders,
+				"completed":         push.Response != nil && push.Response.Complete,
+				"cancelled_by_peer": push.CancelledByPeer,
+				"errors":            push.Errors,
+			}
+			if push.StreamID != agents.HTTPNoStream {
+				result["push_stream"] = push.StreamID
+			}
+			if push.Response != nil {
+				result["status"] = push.Response.Status
+				result["response_errors"] = push.Response.Errors
+			}
+			results = append(results, result)
+		}
+		trace.Results["pushes"] = results
+	}()
+
+	trace.ErrorCode = H3SP_RequestTimeout
+	for {
+		select {
+		case <-responseChan:
+			if trace.ErrorCode == H3SP_RequestTimeout {
+				trace.ErrorCode = H3SP_NoPushPromised
+			}
+			responseChan = nil
+		case i := <-pushPromised:
+			pushUpdated(i.(agents.HTTP3Push))
+			trace.ErrorCode = 0
+		case i := <-pushReceived:
+			pushUpdated(i.(agents.HTTP3Push))
+		case <-conn.ConnectionClosed:
+			return
+		case <-s.Timeout():
+			return
+		}
+	}
+}
@@ -2,7 +2,8 @@ package scenarii
 
 import (
 	qt "github.com/PROGNOSISTool/adapter-quic"
-	"github.com/PROGNOSISTool/pigotls"
+	"github.com/PROGNOSISTool/adapter-quic/qlog"
+	"github.com/PROGNOSISTool/adapter-quic/qlog/qt2qlog"
 )
 
 const (
@@ -47,8 +48,8 @@ forLoop1:
 	}
 
 	// TODO: Move this to crypto.go
-	readSecret := conn.Tls.HkdfExpandLabel(conn.Tls.ProtectedReadSecret(), "ku", nil, conn.Tls.HashDigestSize(), pigotls.QuicBaseLabel)
-	writeSecret := conn.Tls.HkdfExpandLabel(conn.Tls.ProtectedWriteSecret(), "ku", nil, conn.Tls.HashDigestSize(), pigotls.QuicBaseLabel)
+	readSecret := conn.Tls.HkdfExpandLabel(conn.Tls.ProtectedReadSecret(), "ku", nil, conn.Tls.HashDigestSize(), qt.QuicBaseLabel)
+	writeSecret := conn.Tls.HkdfExpandLabel(conn.Tls.ProtectedWriteSecret(), "ku", nil, conn.Tls.HashDigestSize(), qt.QuicBaseLabel)
 
 	conn.CryptoStateLock.Lock()
 	oldState := conn.CryptoStates[qt.EncryptionLevel1RTT]
@@ -58,6 +59,9 @@ forLoop1:
 	conn.CryptoStates[qt.EncryptionLevel1RTT].HeaderWrite = oldState.HeaderWrite
 	conn.KeyPhaseIndex++
 	conn.CryptoStateLock.Unlock()
+	for _, read := range []bool{false, true} {
+		conn.QLogEvents <- conn.QLogTrace.NewEvent(qlog.Categories.Security.Category, qlog.Categories.Security.KeyUpdated, qlog.KeyUpdated{KeyType: qt2qlog.ConvertKeyType(qt.EncryptionLevel1RTT, read), Generation: conn.KeyPhaseIndex, Trigger: qlog.KeyTriggerLocalUpdate})
+	}
 
 	responseChan := connAgents.AddHTTPAgent().SendRequest(preferredPath, "GET", trace.Host, nil)
 
@@ -0,0 +1,90 @@
+package scenarii
+
+import (
+	"fmt"
+
+	qt "github.com/PROGNOSISTool/adapter-quic"
+	"github.com/PROGNOSISTool/adapter-quic/agents"
+)
+
+const (
+	MUPS_TLSHandshakeFailed          = 1
+	MUPS_DatagramTooLarge            = 2
+	MUPS_HostDidNotRespond           = 3
+	MUPS_PMTUDiscoveryDidNotComplete = 4
+)
+
+const MUPS_AdvertisedMaxUDPPayloadSize = 1200
+
+// Advertises the smallest max_udp_payload_size allowed and checks that the host never sends UDP datagrams larger than
+// this value, neither during the handshake nor when sending a response. It also discovers the PMTU towards the host.
+type MaxUDPPayloadSizeScenario struct {
+	AbstractScenario
+}
+
+func NewMaxUDPPayloadSizeScenario() *MaxUDPPayloadSizeScenario {
+	return &MaxUDPPayloadSizeScenario{AbstractScenario{name: "max_udp_payload_size", version: 1}}
+}
+func (s *MaxUDPPayloadSizeScenario) Run(conn *qt.Connection, trace *qt.Trace, preferredPath string, debug bool) {
+	conn.TLSTPHandler.MaxPacketSize = MUPS_AdvertisedMaxUDPPayloadSize
+
+	incomingPayloads := conn.IncomingPayloads.RegisterNewChan(1000)
+	largestDatagram := uint16(0)
+	checkPayload := func(i interface{}) {
+		payload := i.(qt.IncomingPayload)
+		if payload.DatagramSize > largestDatagram {
+			largestDatagram = payload.DatagramSize
+		}
+		if payload.DatagramSize > MUPS_AdvertisedMaxUDPPayloadSize {
+			trace.MarkError(MUPS_DatagramTooLarge, fmt.Sprintf("received a %d-byte datagram while advertising a max_udp_payload_size of %d", payload.DatagramSize, MUPS_AdvertisedMaxUDPPayloadSize), nil)
+		}
+	}
+
+	connAgents := s.CompleteHandshake(conn, trace, MUPS_TLSHandshakeFailed)
+	if connAgents == nil {
+		return
+	}
+	defer connAgents.CloseConnection(false, 0, "")
+
+	pmtudAgent := &agents.PMTUDAgent{SendingAgent: connAgents.Get("SendingAgent").(*agents.SendingAgent)}
+	connAgents.Add(pmtudAgent)
+	pmtuStatus := pmtudAgent.PMTUStatus.RegisterNewChan(10)
+
+	responseChan := connAgents.AddHTTPAgent().SendRequest(preferredPath, "GET", trace.Host, nil)
+	responseReceived := false
+	pmtu := agents.PMTUStatus{PMTU: agents.PMTUDBasePMTU}
+
+forLoop:
+	for {
+		select {
+		case i := <-incomingPayloads:
+			checkPayload(i)
+		case i := <-pmtuStatus:
+			pmtu = i.(agents.PMTUStatus)
+			if pmtu.SearchDone && responseReceived {
+				s.Finished()
+			}
+		case <-responseChan:
+			responseReceived = true
+			if pmtu.SearchDone {
+				s.Finished()
+			}
+		case <-conn.ConnectionClosed:
+			break forLoop
+		case <-s.Timeout():
+			break forLoop
+		}
+	}
+
+	trace.Results["largest_datagram_received"] = largestDatagram
+	trace.Results["discovered_pmtu"] = pmtu.PMTU
+	trace.Results["peer_max_udp_payload_size"] = conn.TLSTPHandler.ReceivedParameters.MaxPacketSize
+
+	if trace.ErrorCode == 0 {
+		if !responseReceived {
+			trace.ErrorCode = MUPS_HostDidNotRespond
+		} else if !pmtu.SearchDone {
+			trace.ErrorCode = MUPS_PMTUDiscoveryDidNotComplete
+		}
+	}
+}
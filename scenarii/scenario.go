@@ -123,11 +123,15 @@ func GetAllScenarii() map[string]Scenario {
 		"http3_uni_streams_limits":   NewHTTP3UniStreamsLimitsScenario(),
 		"http3_reserved_frames":      NewHTTP3ReservedFramesScenario(),
 		"http3_reserved_streams":     NewHTTP3ReservedStreamsScenario(),
+		"http3_priorities":           NewHTTP3PrioritiesScenario(),
+		"http3_server_push":          NewHTTP3ServerPushScenario(),
 		"spin_bit":                   NewSpinBitScenario(),
 		"server_flow_control":        NewServerFlowControlScenario(),
 		"connection_migration_v4_v6": NewConnectionMigrationv4v6Scenario(),
 		"zero_length_cid": 			  NewZeroLengthCID(),
 		"multi_packet_client_hello":  NewMultiPacketClientHello(),
 		"closed_connection":          NewClosedConnectionScenario(),
+		"max_udp_payload_size":       NewMaxUDPPayloadSizeScenario(),
+		"grease":                     NewGreaseScenario(),
 	}
 }
@@ -0,0 +1,110 @@
+package quictracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// When set, NewDefaultConnection loads the resumption state of the server from this store and the SessionStoreAgent
+// saves the state it learns in it.
+var DefaultSessionStore *SessionStore
+
+// Contains the state learned from a server that is needed to resume a connection with it in a later connection.
+type SessionEntry struct {
+	ResumptionTicket    []byte                   `json:"resumption_ticket,omitempty"`    // The content of the last NewSessionTicket message
+	TransportParameters *QuicTransportParameters `json:"transport_parameters,omitempty"` // The server transport parameters to remember for 0-RTT
+	Token               []byte                   `json:"token,omitempty"`                // The last token received in a NEW_TOKEN frame
+	UpdatedAt           int64                    `json:"updated_at"`
+}
+
+// A SessionStore persists SessionEntry in a JSON file, so that resumption and 0-RTT can be tested across separate
+// process invocations. Entries are keyed by server name, ALPN and QUIC version. The store is safe for concurrent use.
+type SessionStore struct {
+	Path    string
+	Entries map[string]*SessionEntry
+	lock    sync.Mutex
+}
+
+func SessionKey(serverName string, ALPN string, version uint32) string {
+	return fmt.Sprintf("%s/%s/%08x", serverName, ALPN, version)
+}
+
+// Opens the store backed by the given file. The file is created when the store is first saved.
+func OpenSessionStore(path string) (*SessionStore, error) {
+	s := &SessionStore{Path: path, Entries: make(map[string]*SessionEntry)}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(content) > 0 {
+		if err := json.Unmarshal(content, &s.Entries); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Returns a copy of the entry stored for the given server, or nil if there is none.
+func (s *SessionStore) Get(serverName string, ALPN string, version uint32) *SessionEntry {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if e, ok := s.Entries[SessionKey(serverName, ALPN, version)]; ok {
+		entry := *e
+		return &entry
+	}
+	return nil
+}
+
+// Applies the given function to the entry of the server of the given connection and saves the store.
+func (s *SessionStore) Update(conn *Connection, update func(e *SessionEntry)) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	key := SessionKey(conn.ServerName, conn.ALPN, conn.Version)
+	e, ok := s.Entries[key]
+	if !ok {
+		e = new(SessionEntry)
+		s.Entries[key] = e
+	}
+	update(e)
+	e.UpdatedAt = time.Now().Unix()
+	return s.save()
+}
+
+func (s *SessionStore) SaveResumptionTicket(conn *Connection, ticket []byte) error {
+	return s.Update(conn, func(e *SessionEntry) { e.ResumptionTicket = ticket })
+}
+
+func (s *SessionStore) SaveTransportParameters(conn *Connection, parameters QuicTransportParameters) error {
+	return s.Update(conn, func(e *SessionEntry) { e.TransportParameters = &parameters })
+}
+
+func (s *SessionStore) SaveToken(conn *Connection, token []byte) error {
+	return s.Update(conn, func(e *SessionEntry) { e.Token = token })
+}
+
+func (s *SessionStore) save() error {
+	content, err := json.Marshal(s.Entries)
+	if err != nil {
+		return err
+	}
+	tmpFile, err := ioutil.TempFile(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), s.Path)
+}
@@ -0,0 +1,44 @@
+package quictracker
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestSessionStore_SaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	store, err := OpenSessionStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := &Connection{ServerName: "example.org", ALPN: "h3", Version: 0x00000001}
+	if err := store.SaveResumptionTicket(conn, []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveToken(conn, []byte{4, 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveTransportParameters(conn, QuicTransportParameters{MaxData: 1024, MaxBidiStreams: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := OpenSessionStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := loaded.Get("example.org", "h3", 0x00000002); e != nil {
+		t.Error("Expected no entry for another version, got", e)
+	}
+	e := loaded.Get("example.org", "h3", 0x00000001)
+	if e == nil {
+		t.Fatal("Expected an entry for the saved session")
+	}
+	if !bytes.Equal(e.ResumptionTicket, []byte{1, 2, 3}) || !bytes.Equal(e.Token, []byte{4, 5}) {
+		t.Error("Unexpected ticket or token", e.ResumptionTicket, e.Token)
+	}
+	if e.TransportParameters == nil || e.TransportParameters.MaxData != 1024 || e.TransportParameters.MaxBidiStreams != 3 {
+		t.Error("Unexpected transport parameters", e.TransportParameters)
+	}
+}
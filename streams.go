@@ -1,6 +1,7 @@
 package quictracker
 
 import (
+	"bytes"
 	"fmt"
 	"math"
 	"sync"
@@ -44,16 +45,104 @@ type StreamInput struct {
 	AppErrorCode uint64
 }
 
+// The sending part of a stream, see RFC 9000 Section 3.1.
+type SendStreamState uint8
+
+const (
+	SendStateReady SendStreamState = iota
+	SendStateSend
+	SendStateDataSent
+	SendStateResetSent
+	SendStateDataRecvd
+	SendStateResetRecvd
+)
+
+func (s SendStreamState) String() string {
+	switch s {
+	case SendStateReady:
+		return "Ready"
+	case SendStateSend:
+		return "Send"
+	case SendStateDataSent:
+		return "Data Sent"
+	case SendStateResetSent:
+		return "Reset Sent"
+	case SendStateDataRecvd:
+		return "Data Recvd"
+	case SendStateResetRecvd:
+		return "Reset Recvd"
+	default:
+		return "Unknown"
+	}
+}
+
+// The receiving part of a stream, see RFC 9000 Section 3.2.
+type RecvStreamState uint8
+
+const (
+	RecvStateRecv RecvStreamState = iota
+	RecvStateSizeKnown
+	RecvStateDataRecvd
+	RecvStateResetRecvd
+	RecvStateDataRead
+	RecvStateResetRead
+)
+
+func (s RecvStreamState) String() string {
+	switch s {
+	case RecvStateRecv:
+		return "Recv"
+	case RecvStateSizeKnown:
+		return "Size Known"
+	case RecvStateDataRecvd:
+		return "Data Recvd"
+	case RecvStateResetRecvd:
+		return "Reset Recvd"
+	case RecvStateDataRead:
+		return "Data Read"
+	case RecvStateResetRead:
+		return "Reset Read"
+	default:
+		return "Unknown"
+	}
+}
+
+// A StreamViolation describes a frame received from the peer that is not allowed in the current state of its stream.
+// ErrorCode is the transport error a conformant endpoint would close the connection with.
+type StreamViolation struct {
+	StreamId  uint64
+	FrameType FrameType
+	ErrorCode uint64
+	Reason    string
+}
+
+func (v StreamViolation) Error() string {
+	return fmt.Sprintf("%s frame on stream %d violates its state (0x%02x): %s", v.FrameType.String(), v.StreamId, v.ErrorCode, v.Reason)
+}
+
+// A StreamStateUpdate reports that the sending or the receiving part of a stream moved to a new state.
+type StreamStateUpdate struct {
+	StreamId     uint64
+	Sending      bool // Whether the sending part of the stream changed, otherwise its receiving part did
+	OldSendState SendStreamState
+	NewSendState SendStreamState
+	OldRecvState RecvStreamState
+	NewRecvState RecvStreamState
+}
+
 type Streams struct {
-	streams map[uint64]*Stream
-	lock    *sync.Mutex
-	input   *Broadcaster
+	streams      map[uint64]*Stream
+	lock         *sync.Mutex
+	input        *Broadcaster
+	violations   *Broadcaster
+	stateUpdates *Broadcaster
 }
 
 func (s Streams) Get(streamId uint64) *Stream {
 	s.lock.Lock()
 	if s.streams[streamId] == nil {
 		s.streams[streamId] = NewStream()
+		s.streams[streamId].id, s.streams[streamId].stateUpdates = streamId, s.stateUpdates
 	}
 	s.lock.Unlock()
 	return s.streams[streamId]
@@ -94,6 +183,107 @@ func (s Streams) Send(streamId uint64, data []byte, close bool) {
 	s.input.Submit(StreamInput{StreamId: streamId, Data: data, Close: close})
 }
 
+// Moves the sending part of the stream to the given state.
+func (s Streams) SetSendState(streamId uint64, state SendStreamState) {
+	stream := s.Get(streamId)
+	old := stream.SendState
+	stream.SendState = state
+	if old != state && s.stateUpdates != nil {
+		s.stateUpdates.Submit(StreamStateUpdate{StreamId: streamId, Sending: true, OldSendState: old, NewSendState: state})
+	}
+}
+
+func (s Streams) recvStateUpdated(streamId uint64, old RecvStreamState, state RecvStreamState) {
+	if old != state && s.stateUpdates != nil {
+		s.stateUpdates.Submit(StreamStateUpdate{StreamId: streamId, OldRecvState: old, NewRecvState: state})
+	}
+}
+
+func (s Streams) violation(streamId uint64, frameType FrameType, errorCode uint64, reason string) {
+	s.violations.Submit(StreamViolation{streamId, frameType, errorCode, reason})
+}
+
+// Returns whether the stream can be referenced by the peer, i.e. whether it is a stream initiated by the peer or a
+// stream we already opened.
+func (s Streams) isOpenable(streamId uint64) bool {
+	if IsServer(streamId) {
+		return true
+	}
+	_, present := s.Has(streamId)
+	return present
+}
+
+// Validates a STREAM frame received from the peer against the state of its stream and adds its data to the stream.
+func (s Streams) ReceiveStreamFrame(f *StreamFrame) {
+	if IsUniClient(f.StreamId) {
+		s.violation(f.StreamId, f.FrameType(), ERR_STREAM_STATE_ERROR, "stream is send-only")
+		return
+	}
+	if !s.isOpenable(f.StreamId) {
+		s.violation(f.StreamId, f.FrameType(), ERR_STREAM_STATE_ERROR, "stream has not been opened")
+		return
+	}
+	stream := s.Get(f.StreamId)
+	old := stream.RecvState
+	if v := stream.addToRead(f); v != nil {
+		s.violations.Submit(*v)
+	}
+	s.recvStateUpdated(f.StreamId, old, stream.RecvState)
+}
+
+// Validates a RESET_STREAM frame received from the peer against the state of its stream and records its final size.
+func (s Streams) ReceiveResetStream(f *ResetStream) {
+	if IsUniClient(f.StreamId) {
+		s.violation(f.StreamId, f.FrameType(), ERR_STREAM_STATE_ERROR, "stream is send-only")
+		return
+	}
+	if !s.isOpenable(f.StreamId) {
+		s.violation(f.StreamId, f.FrameType(), ERR_STREAM_STATE_ERROR, "stream has not been opened")
+		return
+	}
+	stream := s.Get(f.StreamId)
+	stream.lock.Lock()
+	defer stream.lock.Unlock()
+	if stream.ReadCloseOffset != math.MaxUint64 && stream.ReadCloseOffset != f.FinalSize {
+		s.violation(f.StreamId, f.FrameType(), ERR_FINAL_SIZE_ERROR, fmt.Sprintf("final size changed from %d to %d", stream.ReadCloseOffset, f.FinalSize))
+		return
+	}
+	if f.FinalSize < stream.maxReadReceived {
+		s.violation(f.StreamId, f.FrameType(), ERR_FINAL_SIZE_ERROR, fmt.Sprintf("final size %d is lower than the %d bytes received", f.FinalSize, stream.maxReadReceived))
+		return
+	}
+	stream.ReadCloseOffset = f.FinalSize
+	if stream.RecvState < RecvStateDataRecvd {
+		s.recvStateUpdated(f.StreamId, stream.RecvState, RecvStateResetRecvd)
+		stream.RecvState = RecvStateResetRecvd
+		stream.resetReceived, stream.resetErrorCode = true, f.ApplicationErrorCode
+		stream.notifyReader()
+	}
+}
+
+// Validates a STOP_SENDING frame received from the peer against the state of its stream.
+func (s Streams) ReceiveStopSending(f *StopSendingFrame) {
+	if IsUniServer(f.StreamId) {
+		s.violation(f.StreamId, f.FrameType(), ERR_STREAM_STATE_ERROR, "stream is receive-only")
+	} else if !s.isOpenable(f.StreamId) {
+		s.violation(f.StreamId, f.FrameType(), ERR_STREAM_STATE_ERROR, "stream has not been opened")
+	} else {
+		stream := s.Get(f.StreamId)
+		stream.lock.Lock()
+		stream.stopSendingReceived, stream.stopSendingErrorCode = true, f.ApplicationErrorCode
+		stream.lock.Unlock()
+	}
+}
+
+// Validates a MAX_STREAM_DATA frame received from the peer against the state of its stream.
+func (s Streams) ReceiveMaxStreamData(f *MaxStreamDataFrame) {
+	if IsUniServer(f.StreamId) {
+		s.violation(f.StreamId, f.FrameType(), ERR_STREAM_STATE_ERROR, "stream is receive-only")
+	} else if !s.isOpenable(f.StreamId) {
+		s.violation(f.StreamId, f.FrameType(), ERR_STREAM_STATE_ERROR, "stream has not been opened")
+	}
+}
+
 type CryptoStreams map[PNSpace]*Stream
 
 func (s CryptoStreams) Get(space PNSpace) *Stream {
@@ -125,7 +315,19 @@ type Stream struct {
 	WriteClosed      bool
 	WriteCloseOffset uint64
 
+	SendState SendStreamState
+	RecvState RecvStreamState
+
 	readFeedback chan interface{}
+
+	id                   uint64
+	stateUpdates         *Broadcaster
+	lock                 sync.Mutex
+	dataReceived         chan struct{}
+	resetReceived        bool
+	resetErrorCode       uint64
+	stopSendingReceived  bool
+	stopSendingErrorCode uint64
 }
 
 func NewStream() *Stream {
@@ -134,6 +336,7 @@ func NewStream() *Stream {
 	s.readFeedback = make(chan interface{}, 1)
 	s.ReadChan.Register(s.readFeedback)
 	s.gaps = NewbyteIntervalList().Init()
+	s.dataReceived = make(chan struct{})
 	s.ReadCloseOffset = math.MaxUint64
 	s.WriteCloseOffset = math.MaxUint64
 	s.ReadLimit = math.MaxUint64
@@ -141,17 +344,47 @@ func NewStream() *Stream {
 	return s
 }
 
-func (s *Stream) addToRead(f *StreamFrame) { // TODO: Flag implementations that retransmit different data for a given offset
-	if f.Offset > s.ReadCloseOffset {
-		// TODO: report this: write past fin bit
-		return
+// Adds the data of the frame to the stream, or returns the violation it represents when it conflicts with the data or
+// the final size received so far. The data received in order is submitted to ReadChan once the lock is released, so
+// that a slow consumer does not block the other users of the stream.
+func (s *Stream) addToRead(f *StreamFrame) *StreamViolation {
+	s.lock.Lock()
+	data, closed, v := s.receive(f)
+	s.notifyReader()
+	s.lock.Unlock()
+
+	for _, d := range data {
+		s.ReadChan.Submit(d)
+		<-s.readFeedback // Makes sure it propagates before returning
+	}
+	if closed {
+		s.ReadChan.Close()
+	}
+	return v
+}
+
+// Adds the data of the frame to the stream and returns the data that can be read in order, and whether the stream was
+// read up to its final size. It must be called with the lock held.
+func (s *Stream) receive(f *StreamFrame) ([][]byte, bool, *StreamViolation) {
+	var data [][]byte
+	if f.Offset+f.Length > s.ReadCloseOffset {
+		return nil, false, &StreamViolation{f.StreamId, f.FrameType(), ERR_FINAL_SIZE_ERROR, fmt.Sprintf("data up to offset %d exceeds the final size %d", f.Offset+f.Length, s.ReadCloseOffset)}
 	}
 	if f.FinBit {
 		if s.ReadCloseOffset != math.MaxUint64 && s.ReadCloseOffset != f.Offset+f.Length {
-			// TODO: report this: new fin bit offset
-			return
-		} else {
-			s.ReadCloseOffset = f.Offset + f.Length
+			return nil, false, &StreamViolation{f.StreamId, f.FrameType(), ERR_FINAL_SIZE_ERROR, fmt.Sprintf("final size changed from %d to %d", s.ReadCloseOffset, f.Offset+f.Length)}
+		} else if f.Offset+f.Length < s.maxReadReceived {
+			return nil, false, &StreamViolation{f.StreamId, f.FrameType(), ERR_FINAL_SIZE_ERROR, fmt.Sprintf("final size %d is lower than the %d bytes received", f.Offset+f.Length, s.maxReadReceived)}
+		}
+		s.ReadCloseOffset = f.Offset + f.Length
+		if s.RecvState == RecvStateRecv {
+			s.RecvState = RecvStateSizeKnown
+		}
+	}
+	if f.Offset < s.ReadOffset && len(f.StreamData) > 0 {
+		end := Min(int(s.ReadOffset), int(f.Offset)+len(f.StreamData))
+		if !bytes.Equal(s.ReadData[f.Offset:end], f.StreamData[:end-int(f.Offset)]) {
+			return nil, false, &StreamViolation{f.StreamId, f.FrameType(), ERR_PROTOCOL_VIOLATION, fmt.Sprintf("data retransmitted at offset %d differs from the data received", f.Offset)}
 		}
 	}
 
@@ -160,8 +393,7 @@ func (s *Stream) addToRead(f *StreamFrame) { // TODO: Flag implementations that
 		s.maxReadReceived = s.ReadOffset
 		if len(f.StreamData) > 0 {
 			s.ReadData = append(s.ReadData, f.StreamData...)
-			s.ReadChan.Submit(f.StreamData)
-			<-s.readFeedback // Makes sure it propagates before returning
+			data = append(data, f.StreamData)
 		}
 	} else if f.Offset+f.Length > s.maxReadReceived {
 		if s.maxReadReceived < f.Offset {
@@ -172,6 +404,10 @@ func (s *Stream) addToRead(f *StreamFrame) { // TODO: Flag implementations that
 		copy(newSlice, s.ReadData)
 		copy(newSlice[f.Offset:int(f.Offset)+len(f.StreamData)], f.StreamData)
 		s.ReadData = newSlice
+		if f.Offset <= s.ReadOffset && s.gaps.Len() == 0 { // The frame overlaps data already read and extends it
+			data = append(data, s.ReadData[s.ReadOffset:s.maxReadReceived])
+			s.ReadOffset = s.maxReadReceived
+		}
 	} else if len(f.StreamData) > 0 {
 		s.gaps.Fill(byteInterval{f.Offset, f.Offset + f.Length})
 		copy(s.ReadData[f.Offset:], f.StreamData)
@@ -183,16 +419,63 @@ func (s *Stream) addToRead(f *StreamFrame) { // TODO: Flag implementations that
 		}
 
 		if s.ReadOffset < firstGap {
-			s.ReadChan.Submit(s.ReadData[s.ReadOffset:firstGap])
-			<-s.readFeedback // Makes sure it propagates before returning
+			data = append(data, s.ReadData[s.ReadOffset:firstGap])
 			s.ReadOffset = firstGap
 		}
 	}
 
 	if s.ReadOffset == s.ReadCloseOffset && !s.ReadClosed {
 		s.ReadClosed = true
-		s.ReadChan.Close()
+		if s.RecvState == RecvStateSizeKnown {
+			s.RecvState = RecvStateDataRecvd
+		}
+		return data, true, nil
+	}
+	return data, false, nil
+}
+
+// Returns a copy of at most length bytes of the data received in order from the given offset, whether the peer finished
+// the stream with this data and a channel that is closed as soon as more data or a RESET_STREAM frame is received. The
+// stream moves to the Data Read state once the data is read up to the final size.
+func (s *Stream) ReceivedData(offset uint64, length int) ([]byte, bool, <-chan struct{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	end := s.ReadOffset
+	if offset < end && end-offset > uint64(length) {
+		end = offset + uint64(length)
 	}
+	var data []byte
+	if offset < end {
+		data = append(data, s.ReadData[offset:end]...)
+	}
+	fin := s.ReadClosed && end == s.ReadOffset
+	if fin && s.RecvState == RecvStateDataRecvd {
+		s.RecvState = RecvStateDataRead
+		if s.stateUpdates != nil {
+			s.stateUpdates.Submit(StreamStateUpdate{StreamId: s.id, OldRecvState: RecvStateDataRecvd, NewRecvState: RecvStateDataRead})
+		}
+	}
+	return data, fin, s.dataReceived
+}
+
+// Returns the application error code of the RESET_STREAM frame received on the stream, if any.
+func (s *Stream) ResetReceived() (uint64, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.resetErrorCode, s.resetReceived
+}
+
+// Returns the application error code of the STOP_SENDING frame received on the stream, if any.
+func (s *Stream) StopSendingReceived() (uint64, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.stopSendingErrorCode, s.stopSendingReceived
+}
+
+// Wakes up the readers waiting for data. The lock of the stream must be held.
+func (s *Stream) notifyReader() {
+	close(s.dataReceived)
+	s.dataReceived = make(chan struct{})
 }
 
 // Linked list implementation from the Go standard library.
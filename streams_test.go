@@ -3,6 +3,8 @@ package quictracker
 import (
 	"testing"
 	"bytes"
+	"sync"
+	"time"
 	"github.com/davecgh/go-spew/spew"
 )
 
@@ -157,6 +159,87 @@ read2:
 	}
 }
 
+func TestStreamAddToReadViolations(t *testing.T) {
+	s := NewStream()
+
+	if v := s.addToRead(&StreamFrame{Offset: 0, Length: 4, StreamData: []byte{0, 1, 2, 3}}); v != nil {
+		t.Error("Should not be a violation", v)
+	}
+	if v := s.addToRead(&StreamFrame{Offset: 2, Length: 4, StreamData: []byte{2, 3, 4, 5}}); v != nil {
+		t.Error("Should not be a violation", v)
+	}
+	if v := s.addToRead(&StreamFrame{Offset: 2, Length: 2, StreamData: []byte{2, 2}}); v == nil || v.ErrorCode != ERR_PROTOCOL_VIOLATION {
+		t.Error("Different data should be a protocol violation, got", v)
+	}
+	if v := s.addToRead(&StreamFrame{Offset: 4, Length: 0, FinBit: true}); v == nil || v.ErrorCode != ERR_FINAL_SIZE_ERROR {
+		t.Error("Final size lower than the data received should be a final size error, got", v)
+	}
+	if v := s.addToRead(&StreamFrame{Offset: 6, Length: 2, StreamData: []byte{6, 7}, FinBit: true}); v != nil {
+		t.Error("Should not be a violation", v)
+	}
+	if s.RecvState != RecvStateDataRecvd {
+		t.Error("Expected state", RecvStateDataRecvd, "got", s.RecvState)
+	}
+	if v := s.addToRead(&StreamFrame{Offset: 8, Length: 2, StreamData: []byte{8, 9}}); v == nil || v.ErrorCode != ERR_FINAL_SIZE_ERROR {
+		t.Error("Data past the final size should be a final size error, got", v)
+	}
+	if v := s.addToRead(&StreamFrame{Offset: 6, Length: 0, FinBit: true}); v == nil || v.ErrorCode != ERR_FINAL_SIZE_ERROR {
+		t.Error("A new final size should be a final size error, got", v)
+	}
+}
+
+func TestStreamReceivedData(t *testing.T) {
+	s := NewStream()
+
+	_, _, dataReceived := s.ReceivedData(0, 10)
+	s.addToRead(&StreamFrame{Offset: 0, Length: 4, StreamData: []byte{0, 1, 2, 3}})
+	select {
+	case <-dataReceived:
+	default:
+		t.Error("Readers should be notified of the data received")
+	}
+
+	if data, fin, _ := s.ReceivedData(1, 2); !bytes.Equal(data, []byte{1, 2}) || fin {
+		t.Error("Expected two bytes without FIN, got", data, fin)
+	}
+	s.addToRead(&StreamFrame{Offset: 4, Length: 2, StreamData: []byte{4, 5}, FinBit: true})
+	if data, fin, _ := s.ReceivedData(3, 2); !bytes.Equal(data, []byte{3, 4}) || fin {
+		t.Error("FIN should only be reported with the last byte, got", data, fin)
+	}
+	if s.RecvState != RecvStateDataRecvd {
+		t.Error("Expected state", RecvStateDataRecvd, "got", s.RecvState)
+	}
+	if data, fin, _ := s.ReceivedData(5, 10); !bytes.Equal(data, []byte{5}) || !fin {
+		t.Error("Expected the last byte with FIN, got", data, fin)
+	}
+	if s.RecvState != RecvStateDataRead {
+		t.Error("Expected state", RecvStateDataRead, "got", s.RecvState)
+	}
+}
+
+func TestStreamsReceiveResetStream(t *testing.T) {
+	violations := NewBroadcaster(10)
+	streams := Streams{streams: make(map[uint64]*Stream), lock: &sync.Mutex{}, violations: &violations}
+
+	streams.ReceiveStreamFrame(&StreamFrame{StreamId: 1, Offset: 0, Length: 2, StreamData: []byte{0, 1}, FinBit: true})
+	streams.ReceiveResetStream(&ResetStream{StreamId: 1, ApplicationErrorCode: 42, FinalSize: 2})
+	if s := streams.Get(1); s.RecvState != RecvStateDataRecvd {
+		t.Error("A RESET_STREAM after all the data should be ignored, got state", s.RecvState)
+	}
+	if _, reset := streams.Get(1).ResetReceived(); reset {
+		t.Error("A RESET_STREAM after all the data should not be reported")
+	}
+
+	streams.ReceiveStreamFrame(&StreamFrame{StreamId: 5, Offset: 0, Length: 2, StreamData: []byte{0, 1}})
+	streams.ReceiveResetStream(&ResetStream{StreamId: 5, ApplicationErrorCode: 42, FinalSize: 4})
+	if s := streams.Get(5); s.RecvState != RecvStateResetRecvd {
+		t.Error("Expected state", RecvStateResetRecvd, "got", s.RecvState)
+	}
+	if code, reset := streams.Get(5).ResetReceived(); !reset || code != 42 {
+		t.Error("Expected the RESET_STREAM to be reported, got", code, reset)
+	}
+}
+
 func iterEquals(l *byteIntervalList, expected []byteInterval) (bool, *byteInterval, *byteInterval) {
 	i := 0
 	if l.Len() != len(expected) {
@@ -170,3 +253,22 @@ func iterEquals(l *byteIntervalList, expected []byteInterval) (bool, *byteInterv
 	}
 	return true, nil, nil
 }
+
+func TestStreamsRecvStateUpdates(t *testing.T) {
+	violations, stateUpdates := NewBroadcaster(10), NewBroadcaster(10)
+	updates := stateUpdates.RegisterNewChan(10)
+	streams := Streams{streams: make(map[uint64]*Stream), lock: &sync.Mutex{}, violations: &violations, stateUpdates: &stateUpdates}
+
+	streams.ReceiveStreamFrame(&StreamFrame{StreamId: 1, Offset: 0, Length: 2, StreamData: []byte{0, 1}, FinBit: true})
+	streams.Get(1).ReceivedData(0, 10)
+	for _, expected := range []RecvStreamState{RecvStateDataRecvd, RecvStateDataRead} {
+		select {
+		case i := <-updates:
+			if u := i.(StreamStateUpdate); u.NewRecvState != expected {
+				t.Error("Expected state", expected, "got", u.NewRecvState)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected an update to state", expected)
+		}
+	}
+}
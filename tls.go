@@ -0,0 +1,83 @@
+package quictracker
+
+// The labels prefixing the HKDF labels of TLS 1.3 and of QUIC, see RFC 8446 Section 7.1 and RFC 9001 Section 5.1.
+const (
+	BaseLabel     = "tls13 "
+	QuicBaseLabel = BaseLabel + "quic "
+)
+
+// An Epoch identifies the keys used by TLS to protect its messages, see RFC 9001 Section 4.
+type Epoch int
+
+const (
+	EpochInitial   Epoch = 0
+	Epoch0RTT      Epoch = 1
+	EpochHandshake Epoch = 2
+	Epoch1RTT      Epoch = 3
+)
+
+// A TLSMessage contains handshake data to send in CRYPTO frames of the given epoch.
+type TLSMessage struct {
+	Data  []byte
+	Epoch Epoch
+}
+
+// An AEAD protects the payload of packets, using the packet number as a sequence number.
+type AEAD interface {
+	Encrypt(cleartext []byte, seq uint64, aad []byte) []byte
+	Decrypt(ciphertext []byte, seq uint64, aad []byte) []byte // Returns nil when the ciphertext cannot be authenticated
+	Overhead() int
+}
+
+// A HeaderCipher computes the header protection masks. It encrypts the data with the sample of the packet as IV.
+type HeaderCipher interface {
+	Encrypt(iv []byte, data []byte) []byte
+}
+
+// A TLSBackend performs the TLS handshake of a connection and provides the cryptographic primitives of the negotiated
+// cipher suite. The hash and AEAD of TLS_AES_128_GCM_SHA256 are used until a cipher suite is negotiated.
+type TLSBackend interface {
+	// Processes the handshake data received in the given epoch and returns the messages to send in response, and
+	// whether the handshake is still in progress. The first call, with nil data, returns the ClientHello.
+	HandleMessage(data []byte, epoch Epoch) ([]TLSMessage, bool, error)
+	SetQUICTransportParameters(extensionData []byte)
+	ReceivedQUICTransportParameters() []byte
+	ResumptionTicket() []byte // An opaque ticket that can be given to the backend of a later connection
+
+	ZeroRTTSecret() []byte
+	HandshakeReadSecret() []byte
+	HandshakeWriteSecret() []byte
+	ProtectedReadSecret() []byte
+	ProtectedWriteSecret() []byte
+	ClientRandom() []byte
+
+	HashDigestSize() int
+	AEADKeySize() int
+	HkdfExtract(saltIn, input []byte) []byte
+	HkdfExpandLabel(secret []byte, label string, hashValue []byte, length int, baseLabel string) []byte
+	NewAEAD(secret []byte, encryption bool) AEAD // Derives the packet protection key and IV from the secret
+	NewCipher(key []byte) HeaderCipher
+
+	Close()
+}
+
+// Creates the TLS backend of a connection using the given QUIC version. The transport parameters TLS extension uses
+// the codepoint of RFC 9001 from draft-33 onwards, which only the crypto/tls backend sends, and the codepoint 0xffa5
+// before, which only the picotls backend sends. The crypto/tls backend is used unless the version is such a draft and
+// the picotls backend is built, see SupportsVersion.
+func NewTLSBackend(version uint32, serverName string, ALPN string, resumptionTicket []byte) TLSBackend {
+	if isDraftBefore33(version) && newDraftTLSBackend != nil {
+		return newDraftTLSBackend(serverName, ALPN, resumptionTicket)
+	}
+	return NewCryptoTLSBackend(serverName, ALPN, resumptionTicket)
+}
+
+// Returns whether the TLS backends of this build can exchange the transport parameters of the given QUIC version. The
+// drafts older than draft-33 require the picotls backend, which is only built with the pigotls build tag.
+func SupportsVersion(version uint32) bool {
+	return !isDraftBefore33(version) || newDraftTLSBackend != nil
+}
+
+func isDraftBefore33(version uint32) bool {
+	return version&0xffffff00 == 0xff000000 && version&0xff < 33
+}
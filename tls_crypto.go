@@ -0,0 +1,364 @@
+package quictracker
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"sync"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+var epochToQUICLevel = map[Epoch]tls.QUICEncryptionLevel{
+	EpochInitial:   tls.QUICEncryptionLevelInitial,
+	Epoch0RTT:      tls.QUICEncryptionLevelEarly,
+	EpochHandshake: tls.QUICEncryptionLevelHandshake,
+	Epoch1RTT:      tls.QUICEncryptionLevelApplication,
+}
+
+var quicLevelToEpoch = map[tls.QUICEncryptionLevel]Epoch{
+	tls.QUICEncryptionLevelInitial:     EpochInitial,
+	tls.QUICEncryptionLevelEarly:       Epoch0RTT,
+	tls.QUICEncryptionLevelHandshake:   EpochHandshake,
+	tls.QUICEncryptionLevelApplication: Epoch1RTT,
+}
+
+// The cryptoTLSBackend implements the TLSBackend using the QUIC API of crypto/tls. It does not require cgo, but
+// crypto/tls only uses the transport parameters TLS extension codepoint of RFC 9001, i.e. it interoperates with QUIC
+// version 1 and the drafts starting from draft-33. Like the picotls backend, it does not verify the certificates.
+type cryptoTLSBackend struct {
+	conn          *tls.QUICConn
+	started       bool
+	done          bool
+	initialFlight []TLSMessage
+	sessionCache  *ticketCache
+
+	lock                        sync.Mutex
+	suite                       uint16
+	transportParameters         []byte
+	receivedTransportParameters []byte
+	secrets                     map[Epoch][2][]byte // The read and write secrets of each epoch
+	clientRandom                []byte
+}
+
+func NewCryptoTLSBackend(serverName string, ALPN string, resumptionTicket []byte) TLSBackend {
+	b := &cryptoTLSBackend{suite: tls.TLS_AES_128_GCM_SHA256, secrets: make(map[Epoch][2][]byte)}
+	b.sessionCache = &ticketCache{}
+	if len(resumptionTicket) > 0 {
+		b.sessionCache.session, _ = decodeResumptionTicket(resumptionTicket)
+	}
+	config := &tls.Config{
+		ServerName:         serverName,
+		NextProtos:         []string{ALPN},
+		MinVersion:         tls.VersionTLS13,
+		InsecureSkipVerify: true,
+		ClientSessionCache: b.sessionCache,
+		KeyLogWriter:       keyLogWriter{b},
+	}
+	b.conn = tls.QUICClient(&tls.QUICConfig{TLSConfig: config})
+	return b
+}
+
+func (b *cryptoTLSBackend) HandleMessage(data []byte, epoch Epoch) ([]TLSMessage, bool, error) {
+	if !b.started {
+		b.started = true
+		b.conn.SetTransportParameters(b.getTransportParameters())
+		if err := b.conn.Start(context.Background()); err != nil {
+			return nil, false, err
+		}
+		messages := b.processEvents()
+		b.initialFlight = messages
+		return messages, !b.done, nil
+	}
+	if data == nil { // The first flight is asked again, e.g. when the ClientHello is resent
+		return b.initialFlight, !b.done, nil
+	}
+	if err := b.conn.HandleData(epochToQUICLevel[epoch], data); err != nil {
+		return nil, false, err
+	}
+	return b.processEvents(), !b.done, nil
+}
+
+// Consumes the events of the connection and returns the messages to send, merged by epoch.
+func (b *cryptoTLSBackend) processEvents() []TLSMessage {
+	var messages []TLSMessage
+	for {
+		e := b.conn.NextEvent()
+		switch e.Kind {
+		case tls.QUICNoEvent:
+			return messages
+		case tls.QUICSetReadSecret:
+			b.setSecret(e.Level, e.Suite, e.Data, 0)
+		case tls.QUICSetWriteSecret:
+			b.setSecret(e.Level, e.Suite, e.Data, 1)
+		case tls.QUICWriteData:
+			epoch := quicLevelToEpoch[e.Level]
+			if len(messages) > 0 && messages[len(messages)-1].Epoch == epoch {
+				messages[len(messages)-1].Data = append(messages[len(messages)-1].Data, e.Data...)
+			} else {
+				messages = append(messages, TLSMessage{append([]byte{}, e.Data...), epoch})
+			}
+		case tls.QUICTransportParameters:
+			b.lock.Lock()
+			b.receivedTransportParameters = append([]byte{}, e.Data...)
+			b.lock.Unlock()
+		case tls.QUICTransportParametersRequired:
+			b.conn.SetTransportParameters(b.getTransportParameters())
+		case tls.QUICHandshakeDone:
+			b.done = true
+		}
+	}
+}
+
+func (b *cryptoTLSBackend) setSecret(level tls.QUICEncryptionLevel, suite uint16, secret []byte, direction int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.suite = suite
+	epoch := quicLevelToEpoch[level]
+	secrets := b.secrets[epoch]
+	secrets[direction] = append([]byte{}, secret...)
+	b.secrets[epoch] = secrets
+}
+
+func (b *cryptoTLSBackend) secret(epoch Epoch, direction int) []byte {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.secrets[epoch][direction]
+}
+
+func (b *cryptoTLSBackend) getTransportParameters() []byte {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.transportParameters
+}
+
+func (b *cryptoTLSBackend) SetQUICTransportParameters(extensionData []byte) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.transportParameters = extensionData
+}
+
+func (b *cryptoTLSBackend) ReceivedQUICTransportParameters() []byte {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.receivedTransportParameters
+}
+
+func (b *cryptoTLSBackend) ResumptionTicket() []byte {
+	return b.sessionCache.ticket()
+}
+
+func (b *cryptoTLSBackend) ZeroRTTSecret() []byte        { return b.secret(Epoch0RTT, 1) }
+func (b *cryptoTLSBackend) HandshakeReadSecret() []byte  { return b.secret(EpochHandshake, 0) }
+func (b *cryptoTLSBackend) HandshakeWriteSecret() []byte { return b.secret(EpochHandshake, 1) }
+func (b *cryptoTLSBackend) ProtectedReadSecret() []byte  { return b.secret(Epoch1RTT, 0) }
+func (b *cryptoTLSBackend) ProtectedWriteSecret() []byte { return b.secret(Epoch1RTT, 1) }
+
+func (b *cryptoTLSBackend) ClientRandom() []byte {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.clientRandom
+}
+
+func (b *cryptoTLSBackend) cipherSuite() uint16 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.suite
+}
+
+func (b *cryptoTLSBackend) hash() crypto.Hash {
+	if b.cipherSuite() == tls.TLS_AES_256_GCM_SHA384 {
+		return crypto.SHA384
+	}
+	return crypto.SHA256
+}
+
+func (b *cryptoTLSBackend) HashDigestSize() int {
+	return b.hash().Size()
+}
+
+func (b *cryptoTLSBackend) AEADKeySize() int {
+	if b.cipherSuite() == tls.TLS_AES_128_GCM_SHA256 {
+		return 16
+	}
+	return 32
+}
+
+func (b *cryptoTLSBackend) HkdfExtract(saltIn, input []byte) []byte {
+	return hkdf.Extract(b.hash().New, input, saltIn)
+}
+
+func (b *cryptoTLSBackend) HkdfExpandLabel(secret []byte, label string, hashValue []byte, length int, baseLabel string) []byte {
+	fullLabel := baseLabel + label
+	info := make([]byte, 0, 4+len(fullLabel)+len(hashValue))
+	info = binary.BigEndian.AppendUint16(info, uint16(length))
+	info = append(info, byte(len(fullLabel)))
+	info = append(info, fullLabel...)
+	info = append(info, byte(len(hashValue)))
+	info = append(info, hashValue...)
+	output := make([]byte, length)
+	hkdf.Expand(b.hash().New, secret, info).Read(output)
+	return output
+}
+
+func (b *cryptoTLSBackend) NewAEAD(secret []byte, encryption bool) AEAD {
+	key := b.HkdfExpandLabel(secret, "key", nil, b.AEADKeySize(), QuicBaseLabel)
+	iv := b.HkdfExpandLabel(secret, "iv", nil, 12, QuicBaseLabel)
+	var aead cipher.AEAD
+	if b.cipherSuite() == tls.TLS_CHACHA20_POLY1305_SHA256 {
+		aead, _ = chacha20poly1305.New(key)
+	} else {
+		block, _ := aes.NewCipher(key)
+		aead, _ = cipher.NewGCM(block)
+	}
+	return &packetAEAD{aead, iv}
+}
+
+func (b *cryptoTLSBackend) NewCipher(key []byte) HeaderCipher {
+	if b.cipherSuite() == tls.TLS_CHACHA20_POLY1305_SHA256 {
+		return chachaHeaderCipher(key)
+	}
+	block, _ := aes.NewCipher(key)
+	return aesHeaderCipher{block}
+}
+
+func (b *cryptoTLSBackend) Close() {
+	b.conn.Close()
+}
+
+// Implements the AEAD using the packet number to build the nonce, see RFC 9001 Section 5.3.
+type packetAEAD struct {
+	aead cipher.AEAD
+	iv   []byte
+}
+
+func (a *packetAEAD) nonce(seq uint64) []byte {
+	nonce := append([]byte{}, a.iv...)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(seq >> (8 * i))
+	}
+	return nonce
+}
+
+func (a *packetAEAD) Encrypt(cleartext []byte, seq uint64, aad []byte) []byte {
+	return a.aead.Seal(nil, a.nonce(seq), cleartext, aad)
+}
+
+func (a *packetAEAD) Decrypt(ciphertext []byte, seq uint64, aad []byte) []byte {
+	cleartext, err := a.aead.Open(nil, a.nonce(seq), ciphertext, aad)
+	if err != nil || len(cleartext) == 0 {
+		return nil
+	}
+	return cleartext
+}
+
+func (a *packetAEAD) Overhead() int {
+	return a.aead.Overhead()
+}
+
+// The header protection of AES-based cipher suites, i.e. AES-CTR keyed with the sample, see RFC 9001 Section 5.4.3.
+type aesHeaderCipher struct {
+	block cipher.Block
+}
+
+func (c aesHeaderCipher) Encrypt(iv []byte, data []byte) []byte {
+	output := make([]byte, len(data))
+	cipher.NewCTR(c.block, iv).XORKeyStream(output, data)
+	return output
+}
+
+// The header protection of ChaCha20-based cipher suites, the sample provides the counter and the nonce, see RFC 9001
+// Section 5.4.4.
+type chachaHeaderCipher []byte
+
+func (c chachaHeaderCipher) Encrypt(iv []byte, data []byte) []byte {
+	output := make([]byte, len(data))
+	stream, err := chacha20.NewUnauthenticatedCipher(c, iv[4:16])
+	if err != nil {
+		return output
+	}
+	stream.SetCounter(binary.LittleEndian.Uint32(iv[:4]))
+	stream.XORKeyStream(output, data)
+	return output
+}
+
+// Records the session ticket received and provides the one to resume. A connection uses its own cache, so the server
+// name is not used as a key.
+type ticketCache struct {
+	lock    sync.Mutex
+	session *tls.ClientSessionState
+}
+
+func (c *ticketCache) Get(sessionKey string) (*tls.ClientSessionState, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.session, c.session != nil
+}
+
+func (c *ticketCache) Put(sessionKey string, cs *tls.ClientSessionState) {
+	if cs == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.session = cs
+}
+
+// Returns the session as an opaque ticket, i.e. the ticket of the server followed by the state of the session.
+func (c *ticketCache) ticket() []byte {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.session == nil {
+		return nil
+	}
+	ticket, state, err := c.session.ResumptionState()
+	if err != nil || state == nil {
+		return nil
+	}
+	stateBytes, err := state.Bytes()
+	if err != nil {
+		return nil
+	}
+	encoded := binary.BigEndian.AppendUint32(nil, uint32(len(ticket)))
+	return append(append(encoded, ticket...), stateBytes...)
+}
+
+func decodeResumptionTicket(encoded []byte) (*tls.ClientSessionState, error) {
+	if len(encoded) < 4 || uint64(len(encoded)-4) < uint64(binary.BigEndian.Uint32(encoded)) {
+		return nil, errors.New("invalid resumption ticket")
+	}
+	ticketLength := binary.BigEndian.Uint32(encoded)
+	state, err := tls.ParseSessionState(encoded[4+ticketLength:])
+	if err != nil {
+		return nil, err
+	}
+	return tls.NewResumptionState(encoded[4:4+ticketLength], state)
+}
+
+// Extracts the client random from the lines written in the NSS key log format.
+type keyLogWriter struct {
+	backend *cryptoTLSBackend
+}
+
+func (w keyLogWriter) Write(line []byte) (int, error) {
+	fields := bytes.Fields(line)
+	if len(fields) == 3 {
+		if clientRandom, err := hex.DecodeString(string(fields[1])); err == nil {
+			w.backend.lock.Lock()
+			w.backend.clientRandom = clientRandom
+			w.backend.lock.Unlock()
+		}
+	}
+	return len(line), nil
+}
@@ -0,0 +1,157 @@
+package quictracker
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func unhex(s string) []byte {
+	b, _ := hex.DecodeString(s)
+	return b
+}
+
+// Uses the client initial keys of RFC 9001 Appendix A.1.
+func TestCryptoTLSBackend_InitialKeys(t *testing.T) {
+	tls := NewCryptoTLSBackend("example.com", "hq", nil).(*cryptoTLSBackend)
+	initialSecret := tls.HkdfExtract(quicVersionSalt(0x00000001), unhex("8394c8f03e515708"))
+	if !bytes.Equal(initialSecret, unhex("7db5df06e7a69e432496adedb00851923595221596ae2ae9fb8115c1e9ed0a44")) {
+		t.Errorf("Unexpected initial secret %x", initialSecret)
+	}
+	clientSecret := tls.HkdfExpandLabel(initialSecret, "client in", nil, tls.HashDigestSize(), BaseLabel)
+	if !bytes.Equal(clientSecret, unhex("c00cf151ca5be075ed0ebfb5c80323c42d6b7db67881289af4008f1f6c357aea")) {
+		t.Errorf("Unexpected client initial secret %x", clientSecret)
+	}
+	if key := tls.HkdfExpandLabel(clientSecret, "key", nil, tls.AEADKeySize(), QuicBaseLabel); !bytes.Equal(key, unhex("1f369613dd76d5467730efcbe3b1a22d")) {
+		t.Errorf("Unexpected key %x", key)
+	}
+	if iv := tls.HkdfExpandLabel(clientSecret, "iv", nil, 12, QuicBaseLabel); !bytes.Equal(iv, unhex("fa044b2f42a3fd3b46fb255c")) {
+		t.Errorf("Unexpected iv %x", iv)
+	}
+	if hp := tls.HkdfExpandLabel(clientSecret, "hp", nil, tls.AEADKeySize(), QuicBaseLabel); !bytes.Equal(hp, unhex("9f50449e04a0e810283a1e9933adedd2")) {
+		t.Errorf("Unexpected header protection key %x", hp)
+	} else if mask := tls.NewCipher(hp).Encrypt(unhex("d1b1c98dd7689fb8ec11d242b123dc9b"), make([]byte, 5)); !bytes.Equal(mask, unhex("437b9aec36")) {
+		t.Errorf("Unexpected header protection mask %x", mask)
+	}
+
+	encrypter, decrypter := tls.NewAEAD(clientSecret, true), tls.NewAEAD(clientSecret, false)
+	ciphertext := encrypter.Encrypt([]byte("payload"), 2, []byte("header"))
+	if len(ciphertext) != len("payload")+encrypter.Overhead() {
+		t.Errorf("Unexpected ciphertext length %d", len(ciphertext))
+	}
+	if cleartext := decrypter.Decrypt(ciphertext, 2, []byte("header")); string(cleartext) != "payload" {
+		t.Errorf("Unexpected cleartext %q", cleartext)
+	}
+	if cleartext := decrypter.Decrypt(ciphertext, 3, []byte("header")); cleartext != nil {
+		t.Error("Expected the decryption to fail with another packet number")
+	}
+
+	conn := &Connection{Tls: tls, Version: 0x00000001, DestinationCID: unhex("8394c8f03e515708")}
+	if cleartext := decrypter.Decrypt(NewInitialPacketProtection(conn).Write.Encrypt([]byte("payload"), 2, []byte("header")), 2, []byte("header")); string(cleartext) != "payload" {
+		t.Error("Expected the Initial packet protection of version 1 to use the client initial secret")
+	}
+}
+
+func TestNewTLSBackend_Version(t *testing.T) {
+	for version, draft := range map[uint32]bool{0xff00001d: true, 0xff000020: true, 0xff000021: false, 0x00000001: false, 0x6b3343cf: false} {
+		if isDraftBefore33(version) != draft {
+			t.Errorf("Expected isDraftBefore33(%#x) to be %v", version, draft)
+		}
+	}
+	if _, ok := NewTLSBackend(0x00000001, "example.com", "hq", nil).(*cryptoTLSBackend); !ok {
+		t.Error("Expected the crypto/tls backend to be used for QUIC version 1")
+	}
+	if !SupportsVersion(0x00000001) || SupportsVersion(0xff00001d) != (newDraftTLSBackend != nil) {
+		t.Error("Expected the drafts before draft-33 to require the picotls backend")
+	}
+	for version, salt := range map[uint32]string{
+		0xff00001c: "c3eef712c72ebb5a11a7d2432bb46365bef9f502",
+		0xff00001d: "afbfec289993d24c9e9786f19c6111e04390a899",
+		0xff000020: "afbfec289993d24c9e9786f19c6111e04390a899",
+		0xff000021: "38762cf7f55934b34d179ae6a4c80cadccbb7f0a",
+		0x00000001: "38762cf7f55934b34d179ae6a4c80cadccbb7f0a",
+	} {
+		if !bytes.Equal(quicVersionSalt(version), unhex(salt)) {
+			t.Errorf("Unexpected salt %x for version %#x", quicVersionSalt(version), version)
+		}
+	}
+}
+
+// Performs a handshake between the crypto/tls backend and a crypto/tls QUIC server.
+func TestCryptoTLSBackend_Handshake(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "example.com"}, DNSNames: []string{"example.com"}, NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := tls.QUICServer(&tls.QUICConfig{TLSConfig: &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{certificate}, PrivateKey: key}},
+		NextProtos:   []string{"hq-interop"},
+		MinVersion:   tls.VersionTLS13,
+	}})
+	defer server.Close()
+	serverParameters := []byte{0x0f, 0x04, 0x01, 0x02, 0x03, 0x04}
+	server.SetTransportParameters(serverParameters)
+	if err := server.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewCryptoTLSBackend("example.com", "hq-interop", nil)
+	defer client.Close()
+	clientParameters := []byte{0x0f, 0x04, 0x05, 0x06, 0x07, 0x08}
+	client.SetQUICTransportParameters(clientParameters)
+	messages, inProgress, err := client.HandleMessage(nil, EpochInitial)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverSecrets := make(map[Epoch][]byte) // The read secrets of the server
+	var receivedParameters []byte
+	serverDone := false
+	for i := 0; i < 10 && (inProgress || !serverDone); i++ {
+		for _, m := range messages {
+			if err := server.HandleData(epochToQUICLevel[m.Epoch], m.Data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		messages = nil
+		for e := server.NextEvent(); e.Kind != tls.QUICNoEvent; e = server.NextEvent() {
+			switch e.Kind {
+			case tls.QUICSetReadSecret:
+				serverSecrets[quicLevelToEpoch[e.Level]] = append([]byte{}, e.Data...)
+			case tls.QUICTransportParameters:
+				receivedParameters = append([]byte{}, e.Data...)
+			case tls.QUICHandshakeDone:
+				serverDone = true
+			case tls.QUICWriteData:
+				var response []TLSMessage
+				if response, inProgress, err = client.HandleMessage(e.Data, quicLevelToEpoch[e.Level]); err != nil {
+					t.Fatal(err)
+				}
+				messages = append(messages, response...)
+			}
+		}
+	}
+	if inProgress || !serverDone {
+		t.Fatal("Expected the handshake to complete")
+	}
+	if !bytes.Equal(client.ReceivedQUICTransportParameters(), serverParameters) || !bytes.Equal(receivedParameters, clientParameters) {
+		t.Error("Expected the transport parameters to be exchanged")
+	}
+	if !bytes.Equal(client.HandshakeWriteSecret(), serverSecrets[EpochHandshake]) || !bytes.Equal(client.ProtectedWriteSecret(), serverSecrets[Epoch1RTT]) {
+		t.Error("Expected the client and the server to derive the same secrets")
+	}
+	if len(client.ClientRandom()) != 32 {
+		t.Errorf("Unexpected client random %x", client.ClientRandom())
+	}
+}
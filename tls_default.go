@@ -0,0 +1,7 @@
+//go:build !pigotls
+
+package quictracker
+
+// Creates the TLS backend of connections using a draft older than draft-33. The picotls backend is only built with the
+// pigotls build tag, these drafts are not supported otherwise.
+var newDraftTLSBackend func(serverName string, ALPN string, resumptionTicket []byte) TLSBackend
@@ -0,0 +1,36 @@
+//go:build pigotls
+
+package quictracker
+
+import "github.com/PROGNOSISTool/pigotls"
+
+// Creates the TLS backend of connections using a draft older than draft-33. The picotls backend is built with the
+// pigotls build tag.
+var newDraftTLSBackend = NewPigotlsBackend
+
+// The pigotlsBackend implements the TLSBackend using picotls. It requires the picotls libraries to be built in the
+// module cache, but supports the transport parameters TLS extension codepoint of the drafts.
+type pigotlsBackend struct {
+	*pigotls.Connection
+}
+
+func NewPigotlsBackend(serverName string, ALPN string, resumptionTicket []byte) TLSBackend {
+	return pigotlsBackend{pigotls.NewConnection(serverName, ALPN, resumptionTicket)}
+}
+
+func (b pigotlsBackend) HandleMessage(data []byte, epoch Epoch) ([]TLSMessage, bool, error) {
+	messages, notCompleted, err := b.Connection.HandleMessage(data, pigotls.Epoch(epoch))
+	var tlsMessages []TLSMessage
+	for _, m := range messages {
+		tlsMessages = append(tlsMessages, TLSMessage{m.Data, Epoch(m.Epoch)})
+	}
+	return tlsMessages, notCompleted, err
+}
+
+func (b pigotlsBackend) NewAEAD(secret []byte, encryption bool) AEAD {
+	return b.Connection.NewAEAD(secret, encryption)
+}
+
+func (b pigotlsBackend) NewCipher(key []byte) HeaderCipher {
+	return b.Connection.NewCipher(key)
+}
@@ -6,7 +6,6 @@ import (
 	"time"
 	"unsafe"
 
-	"github.com/PROGNOSISTool/pigotls"
 )
 
 // Contains the result of a test run against a given host.
@@ -24,11 +23,11 @@ type Trace struct {
 	Pcap                []byte                 `json:"pcap"`       // The packet capture file associated with the trace
 	QLog                interface{}            `json:"qlog"`       // The QLog trace captured during the test run
 	ClientRandom        []byte                 `json:"client_random"`
-	Secrets				map[pigotls.Epoch]Secrets `json:"secrets"`
+	Secrets				map[Epoch]Secrets `json:"secrets"`
 }
 
 type Secrets struct {
-	Epoch pigotls.Epoch `json:"epoch"`
+	Epoch Epoch `json:"epoch"`
 	Read  []byte        `json:"read"`
 	Write []byte        `json:"write"`
 }
@@ -81,20 +80,23 @@ func (t *Trace) AttachTo(conn *Connection) {
 }
 
 func (t *Trace) Complete(conn *Connection) {
+	if violations := conn.ConformanceReport.Violations(); len(violations) > 0 {
+		t.Results["conformance_violations"] = violations
+	}
 	if len(t.ClientRandom) == 0 {
 		t.ClientRandom = conn.Tls.ClientRandom()
 	}
 	if t.Secrets == nil {
-		t.Secrets = make(map[pigotls.Epoch]Secrets)
+		t.Secrets = make(map[Epoch]Secrets)
 	}
-	if _, ok := t.Secrets[pigotls.Epoch0RTT]; !ok && len(conn.Tls.ZeroRTTSecret()) > 0 {
-		t.Secrets[pigotls.Epoch0RTT] = Secrets{Epoch: pigotls.Epoch0RTT, Write: conn.Tls.ZeroRTTSecret()}
+	if _, ok := t.Secrets[Epoch0RTT]; !ok && len(conn.Tls.ZeroRTTSecret()) > 0 {
+		t.Secrets[Epoch0RTT] = Secrets{Epoch: Epoch0RTT, Write: conn.Tls.ZeroRTTSecret()}
 	}
-	if _, ok := t.Secrets[pigotls.EpochHandshake]; !ok && len(conn.Tls.HandshakeReadSecret()) > 0 || len(conn.Tls.HandshakeWriteSecret()) > 0 {
-		t.Secrets[pigotls.EpochHandshake] = Secrets{Epoch: pigotls.EpochHandshake, Read: conn.Tls.HandshakeReadSecret(), Write: conn.Tls.HandshakeWriteSecret()}
+	if _, ok := t.Secrets[EpochHandshake]; !ok && len(conn.Tls.HandshakeReadSecret()) > 0 || len(conn.Tls.HandshakeWriteSecret()) > 0 {
+		t.Secrets[EpochHandshake] = Secrets{Epoch: EpochHandshake, Read: conn.Tls.HandshakeReadSecret(), Write: conn.Tls.HandshakeWriteSecret()}
 	}
-	if _, ok := t.Secrets[pigotls.Epoch1RTT]; !ok && len(conn.Tls.ProtectedReadSecret()) > 0 || len(conn.Tls.ProtectedWriteSecret()) > 0 {
-		t.Secrets[pigotls.Epoch1RTT] = Secrets{Epoch: pigotls.Epoch1RTT, Read: conn.Tls.ProtectedReadSecret(), Write: conn.Tls.ProtectedWriteSecret()}
+	if _, ok := t.Secrets[Epoch1RTT]; !ok && len(conn.Tls.ProtectedReadSecret()) > 0 || len(conn.Tls.ProtectedWriteSecret()) > 0 {
+		t.Secrets[Epoch1RTT] = Secrets{Epoch: Epoch1RTT, Read: conn.Tls.ProtectedReadSecret(), Write: conn.Tls.ProtectedWriteSecret()}
 	}
 }
 
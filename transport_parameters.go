@@ -28,6 +28,9 @@ const (
 	ActiveConnectionIdLimit                                 = 0x0e
 	InitialSourceConnectionId                               = 0x0f
 	RetrySourceConnectionId                                 = 0x10
+	MaxDatagramFrameSize                                    = 0x20 // See RFC 9221
+	MinAckDelay                                             = 0xff04de1b // See draft-ietf-quic-ack-frequency
+	GreaseQuicBit                                           = 0x2ab2 // See RFC 9287
 )
 
 type QuicTransportParameters struct {  // A set of QUIC transport parameters value
@@ -48,7 +51,11 @@ type QuicTransportParameters struct {  // A set of QUIC transport parameters val
 	ActiveConnectionIdLimit         uint64
 	InitialSourceConnectionId       ConnectionID
 	RetrySourceConnectionId         ConnectionID
+	MaxDatagramFrameSize            uint64
+	MinAckDelay                     uint64
+	GreaseQuicBit                   bool
 	AdditionalParameters            TransportParameterList
+	DuplicateParameters             []TransportParametersType // The parameters that were received more than once
 	ToJSON                          map[string]interface{}
 }
 
@@ -145,6 +152,13 @@ func (h *TLSTransportParameterHandler) GetExtensionData() ([]byte, error) {
 		addParameter(MaxUDPPacketSize, h.QuicTransportParameters.MaxPacketSize)
 	}
 	addParameter(InitialSourceConnectionId, h.QuicTransportParameters.InitialSourceConnectionId)
+	if h.QuicTransportParameters.MaxDatagramFrameSize > 0 {
+		addParameter(MaxDatagramFrameSize, h.QuicTransportParameters.MaxDatagramFrameSize)
+	}
+	if h.QuicTransportParameters.MinAckDelay > 0 {
+		addParameter(MinAckDelay, h.QuicTransportParameters.MinAckDelay)
+	}
+	addParameter(GreaseQuicBit, h.QuicTransportParameters.GreaseQuicBit)
 	for _, p := range h.QuicTransportParameters.AdditionalParameters {
 		parameters = append(parameters, p)
 	}
@@ -168,7 +182,6 @@ func (h *TLSTransportParameterHandler) GetExtensionData() ([]byte, error) {
 }
 
 func (h *TLSTransportParameterHandler) ReceiveExtensionData(data []byte) error {
-	// TODO: Check for duplicates ?
 	if h.EncryptedExtensionsTransportParameters == nil {
 		h.EncryptedExtensionsTransportParameters = &EncryptedExtensionsTransportParameters{}
 	}
@@ -177,6 +190,7 @@ func (h *TLSTransportParameterHandler) ReceiveExtensionData(data []byte) error {
 	receivedParameters.ToJSON = make(map[string]interface{})
 
 	buf := bytes.NewBuffer(data)
+	seen := make(map[TransportParametersType]bool)
 
 	for buf.Len() > 0 {
 		pType, err := ReadVarInt(buf)
@@ -196,6 +210,10 @@ func (h *TLSTransportParameterHandler) ReceiveExtensionData(data []byte) error {
 			return errors.New("end of TPs blob before parameter value")
 		}
 		pDataBuf := bytes.NewBuffer(pData)
+		if seen[TransportParametersType(pType.Value)] {
+			receivedParameters.DuplicateParameters = append(receivedParameters.DuplicateParameters, TransportParametersType(pType.Value))
+		}
+		seen[TransportParametersType(pType.Value)] = true
 		switch TransportParametersType(pType.Value) {
 		case OriginalDestinationConnectionId:
 			receivedParameters.OriginalDestinationConnectionId = ConnectionID(pDataBuf.Bytes())
@@ -248,6 +266,15 @@ func (h *TLSTransportParameterHandler) ReceiveExtensionData(data []byte) error {
 		case RetrySourceConnectionId:
 			receivedParameters.RetrySourceConnectionId = ConnectionID(pDataBuf.Bytes())
 			receivedParameters.ToJSON["retry_source_connection_id"] = ConnectionID(pData)
+		case MaxDatagramFrameSize:
+			receivedParameters.MaxDatagramFrameSize, _, err = lib.ReadVarIntValue(pDataBuf)
+			receivedParameters.ToJSON["max_datagram_frame_size"] = receivedParameters.MaxDatagramFrameSize
+		case MinAckDelay:
+			receivedParameters.MinAckDelay, _, err = lib.ReadVarIntValue(pDataBuf)
+			receivedParameters.ToJSON["min_ack_delay"] = receivedParameters.MinAckDelay
+		case GreaseQuicBit:
+			receivedParameters.GreaseQuicBit = true
+			receivedParameters.ToJSON["grease_quic_bit"] = true
 		default:
 			p := TransportParameter{ParameterType: TransportParametersType(pType.Value), Value: pDataBuf.Bytes()}
 			receivedParameters.AdditionalParameters.AddParameter(p)